@@ -61,15 +61,63 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The reconcilers issuing credentials share the GitHub client and the token refresh manager
+	tokens, err := controllers.NewTokenServices(mgr, cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to set up token services")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.GitRepositoryReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 		Config: cfg,
+		Tokens: tokens,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GitRepository")
 		os.Exit(1)
 	}
 
+	if err = (&controllers.HelmRepositoryReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Tokens: tokens,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HelmRepository")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.OCIRepositoryReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Tokens: tokens,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OCIRepository")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.ImageUpdateAutomationReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Tokens: tokens,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ImageUpdateAutomation")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.ProviderReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: cfg,
+		Tokens: tokens,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Provider")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.ConfigMapReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
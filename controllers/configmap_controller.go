@@ -11,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -28,15 +29,24 @@ const (
 	FluxSystemNamespace = "flux-system"
 )
 
+// Reasons of the events recorded on synced ConfigMaps and Namespaces
+const (
+	EventReasonConfigMapSynced       = "ConfigMapSynced"
+	EventReasonConfigMapSyncFailed   = "ConfigMapSyncFailed"
+	EventReasonConfigMapSyncConflict = "ConfigMapSyncConflict"
+)
+
 // ConfigMapReconciler reconciles ConfigMap objects in flux-system namespace
 type ConfigMapReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	logger logr.Logger
+	Scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	logger   logr.Logger
 }
 
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.logger.WithValues("configmap", req.NamespacedName)
@@ -74,6 +84,8 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	for _, namespace := range targetNamespaces {
 		if err := r.syncConfigMapToNamespace(ctx, configMap, namespace, logger); err != nil {
 			logger.Error(err, "Failed to sync ConfigMap to namespace", "targetNamespace", namespace)
+			r.recorder.Eventf(configMap, corev1.EventTypeWarning, EventReasonConfigMapSyncFailed,
+				"Failed to sync ConfigMap to namespace %s: %v", namespace, err)
 			return ctrl.Result{}, err
 		}
 	}
@@ -189,6 +201,8 @@ func (r *ConfigMapReconciler) syncConfigMapToNamespace(ctx context.Context, sour
 				return fmt.Errorf("failed to create ConfigMap in namespace %s: %w", targetNamespace, err)
 			}
 			logger.Info("Created synced ConfigMap", "targetNamespace", targetNamespace)
+			r.recorder.Eventf(sourceConfigMap, corev1.EventTypeNormal, EventReasonConfigMapSynced,
+				"Created ConfigMap in namespace %s", targetNamespace)
 		} else {
 			return fmt.Errorf("failed to check existing ConfigMap: %w", err)
 		}
@@ -202,6 +216,15 @@ func (r *ConfigMapReconciler) syncConfigMapToNamespace(ctx context.Context, sour
 				return fmt.Errorf("failed to update ConfigMap in namespace %s: %w", targetNamespace, err)
 			}
 			logger.Info("Updated synced ConfigMap", "targetNamespace", targetNamespace)
+			r.recorder.Eventf(sourceConfigMap, corev1.EventTypeNormal, EventReasonConfigMapSynced,
+				"Updated ConfigMap in namespace %s", targetNamespace)
+		} else {
+			// A ConfigMap of the same name that was not synced from this source is left alone
+			logger.Info("ConfigMap exists in target namespace and is not synced from this source, skipping",
+				"targetNamespace", targetNamespace)
+			r.recorder.Eventf(sourceConfigMap, corev1.EventTypeWarning, EventReasonConfigMapSyncConflict,
+				"ConfigMap %s/%s exists and is not synced from %s/%s", targetNamespace, sourceConfigMap.Name,
+				FluxSystemNamespace, sourceConfigMap.Name)
 		}
 	}
 
@@ -231,6 +254,7 @@ func (r *ConfigMapReconciler) cleanupSyncedConfigMaps(ctx context.Context, confi
 
 func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.logger = ctrl.Log.WithName("configmap-controller")
+	r.recorder = mgr.GetEventRecorderFor(EventSource)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.ConfigMap{}).
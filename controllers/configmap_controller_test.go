@@ -10,6 +10,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -150,9 +151,10 @@ func TestConfigMapReconciler_Reconcile(t *testing.T) {
 				Build()
 
 			reconciler := &ConfigMapReconciler{
-				Client: fakeClient,
-				Scheme: scheme,
-				logger: zap.New(zap.UseDevMode(true)),
+				Client:   fakeClient,
+				Scheme:   scheme,
+				recorder: &record.FakeRecorder{},
+				logger:   zap.New(zap.UseDevMode(true)),
 			}
 
 			req := ctrl.Request{
@@ -385,9 +387,10 @@ func TestConfigMapReconciler_cleanupSyncedConfigMaps(t *testing.T) {
 		Build()
 
 	reconciler := &ConfigMapReconciler{
-		Client: fakeClient,
-		Scheme: scheme,
-		logger: zap.New(zap.UseDevMode(true)),
+		Client:   fakeClient,
+		Scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		logger:   zap.New(zap.UseDevMode(true)),
 	}
 
 	result, err := reconciler.cleanupSyncedConfigMaps(ctx, configMapName, reconciler.logger)
@@ -8,6 +8,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -57,15 +58,17 @@ func TestConfigMapSync_IntegrationWorkflow(t *testing.T) {
 
 	// Create controllers
 	configMapReconciler := &ConfigMapReconciler{
-		Client: fakeClient,
-		Scheme: scheme,
-		logger: zap.New(zap.UseDevMode(true)),
+		Client:   fakeClient,
+		Scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		logger:   zap.New(zap.UseDevMode(true)),
 	}
 
 	namespaceReconciler := &NamespaceReconciler{
-		Client: fakeClient,
-		Scheme: scheme,
-		logger: zap.New(zap.UseDevMode(true)),
+		Client:   fakeClient,
+		Scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		logger:   zap.New(zap.UseDevMode(true)),
 	}
 
 	// Test 1: ConfigMap reconciliation should sync to target namespace
@@ -273,9 +276,10 @@ func TestConfigMapSync_EdgeCases(t *testing.T) {
 			Build()
 
 		reconciler := &ConfigMapReconciler{
-			Client: fakeClient,
-			Scheme: scheme,
-			logger: zap.New(zap.UseDevMode(true)),
+			Client:   fakeClient,
+			Scheme:   scheme,
+			recorder: &record.FakeRecorder{},
+			logger:   zap.New(zap.UseDevMode(true)),
 		}
 
 		req := ctrl.Request{
@@ -312,9 +316,10 @@ func TestConfigMapSync_EdgeCases(t *testing.T) {
 			Build()
 
 		reconciler := &NamespaceReconciler{
-			Client: fakeClient,
-			Scheme: scheme,
-			logger: zap.New(zap.UseDevMode(true)),
+			Client:   fakeClient,
+			Scheme:   scheme,
+			recorder: &record.FakeRecorder{},
+			logger:   zap.New(zap.UseDevMode(true)),
 		}
 
 		req := ctrl.Request{
@@ -365,10 +370,12 @@ func TestConfigMapSync_EdgeCases(t *testing.T) {
 			WithObjects(objects...).
 			Build()
 
+		recorder := record.NewFakeRecorder(10)
 		reconciler := &ConfigMapReconciler{
-			Client: fakeClient,
-			Scheme: scheme,
-			logger: zap.New(zap.UseDevMode(true)),
+			Client:   fakeClient,
+			Scheme:   scheme,
+			recorder: recorder,
+			logger:   zap.New(zap.UseDevMode(true)),
 		}
 
 		req := ctrl.Request{
@@ -392,5 +399,10 @@ func TestConfigMapSync_EdgeCases(t *testing.T) {
 
 		assert.Equal(t, "existing-value", conflictConfigMap.Data["key"])
 		assert.Empty(t, conflictConfigMap.Annotations[SyncSourceAnnotation])
+
+		// Verify the conflict was reported on the source ConfigMap
+		require.Len(t, recorder.Events, 1)
+		assert.Equal(t, "Warning ConfigMapSyncConflict ConfigMap conflict-ns/conflict-config exists and is not synced from flux-system/conflict-config",
+			<-recorder.Events)
 	})
 }
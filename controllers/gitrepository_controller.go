@@ -2,21 +2,27 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"sigs.k8s.io/controller-runtime/pkg/manager"
-
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	"github.com/nrfcloud/flux-extension-controller/pkg/config"
@@ -25,19 +31,56 @@ import (
 	"github.com/nrfcloud/flux-extension-controller/pkg/token"
 )
 
+const (
+	// TokenReadyCondition reports whether the GitHub token secret of a Flux source is up to date.
+	// The Ready condition belongs to source-controller and is never written by this controller.
+	TokenReadyCondition = "GitHubTokenReady"
+
+	// FieldOwner is the field manager of the fields applied by this controller
+	FieldOwner = "flux-extension-controller"
+
+	// EventSource is the component events of this controller are recorded for
+	EventSource = "flux-extension-controller"
+)
+
+// Reasons of the events recorded on GitRepositories
+const (
+	EventReasonTokenIssued             = "TokenIssued"
+	EventReasonTokenIssueFailed        = "TokenIssueFailed"
+	EventReasonSecretOwnershipConflict = "SecretOwnershipConflict"
+	EventReasonTokenRevoked            = "TokenRevoked"
+	EventReasonTokenRevokeFailed       = "TokenRevokeFailed"
+	EventReasonSecretRefGenerated      = "SecretRefGenerated"
+	EventReasonSecretRefReverted       = "SecretRefReverted"
+)
+
+// generatedSecretSuffix is appended to the name of a GitRepository to name its generated secret
+const generatedSecretSuffix = "-github-token"
+
 // GitRepositoryReconciler reconciles GitRepository objects
 type GitRepositoryReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Config *config.Config
 
+	// Tokens are the services shared with the other reconcilers, created by SetupWithManager if unset
+	Tokens *TokenServices
+
 	githubClient   github.GitHubClient
 	secretManager  *kubernetes.SecretManager
 	refreshManager token.RefreshManagerInterface
+	deployKeys     *token.DeployKeyIssuer
+	recorder       record.EventRecorder
 	logger         logr.Logger
+
+	// automationGVK is the served version of ImageUpdateAutomations, empty when the cluster does not
+	// serve them
+	automationGVK schema.GroupVersionKind
 }
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories/finalizers,verbs=update
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
@@ -57,14 +100,38 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// Revoke the token and delete the secret of a GitRepository being deleted
+	if !gitRepo.DeletionTimestamp.IsZero() {
+		var secretName string
+		if gitRepo.Spec.SecretRef != nil {
+			secretName = gitRepo.Spec.SecretRef.Name
+		}
+		return r.secrets().reconcileDelete(ctx, gitRepo, secretName, gitRepo.Spec.URL, logger)
+	}
+
+	// Release the secrets of the GitRepository being deleted, including secrets it no longer references
+	if released, err := r.secrets().releaseDeletedSecrets(ctx, gitRepo, gitRepo.Spec.URL, logger); err != nil {
+		return ctrl.Result{}, err
+	} else if released {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
 	// Check if namespace is excluded
 	if r.isNamespaceExcluded(gitRepo.Namespace) {
 		logger.V(1).Info("Skipping GitRepository in excluded namespace")
 		return ctrl.Result{}, nil
 	}
 
-	// Check if this is a repository from the target organization
+	// Check if this is a repository from one of the target organizations
 	if !r.isTargetOrganizationRepository(gitRepo.Spec.URL) {
+		if r.shouldReportUnmatchedOwner(ctx, gitRepo) {
+			message := fmt.Sprintf("No GitHub App configured for repository %s (configured organizations: %s)",
+				gitRepo.Spec.URL, strings.Join(r.Config.GitHub.Organizations(), ", "))
+			logger.Info("No GitHub App configured for repository owner", "url", gitRepo.Spec.URL)
+			r.recorder.Event(gitRepo, corev1.EventTypeWarning, "NoMatchingGitHubApp", message)
+			r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "NoMatchingGitHubApp", message)
+			return ctrl.Result{}, nil
+		}
 		logger.V(1).Info("Skipping repository from different organization", "url", gitRepo.Spec.URL)
 		return ctrl.Result{}, nil
 	}
@@ -72,6 +139,16 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// Validate repository URL
 	if err := r.githubClient.ValidateRepositoryURL(gitRepo.Spec.URL); err != nil {
 		logger.Error(err, "Repository URL validation failed")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, "ValidationFailed", "Repository URL validation failed: %v", err)
+		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "ValidationFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	// Read the permissions requested for the token
+	tokenOpts, err := token.TokenOptionsFor(gitRepo)
+	if err != nil {
+		logger.Error(err, "Token options validation failed")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, "ValidationFailed", "Token options validation failed: %v", err)
 		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "ValidationFailed", err.Error())
 		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
 	}
@@ -82,43 +159,68 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, nil
 	}
 
-	// Check if secretRef is specified
+	// Check if secretRef is specified, or generate one for GitRepositories that opted in
 	if gitRepo.Spec.SecretRef == nil {
-		logger.V(1).Info("No secretRef specified, skipping")
-		return ctrl.Result{}, nil
+		if !r.wantsSecretRef(gitRepo) {
+			logger.V(1).Info("No secretRef specified, skipping")
+			return ctrl.Result{}, nil
+		}
+		return r.reconcileSecretRef(ctx, gitRepo, logger)
 	}
 
 	secretName := gitRepo.Spec.SecretRef.Name
 	secretNamespace := gitRepo.Namespace
 
+	// Push secrets are left to the ImageUpdateAutomation they are issued for, whose token may push
+	if pushSecret, err := r.isPushSecret(ctx, gitRepo, secretName); err != nil {
+		logger.Error(err, "Failed to look up push secrets")
+		return ctrl.Result{}, err
+	} else if pushSecret {
+		logger.V(1).Info("Secret holds the push token of an ImageUpdateAutomation, skipping", "secret", secretName)
+		return ctrl.Result{}, nil
+	}
+
 	// Validate secret ownership
 	if err := r.secretManager.ValidateSecretOwnership(ctx, secretNamespace, secretName, gitRepo.Spec.URL); err != nil {
 		logger.Error(err, "Secret ownership validation failed")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict, "Cannot manage secret %s: %v", secretName, err)
 		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "SecretValidationFailed", err.Error())
 		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
 	}
 
+	// Add the finalizer, so the token is revoked when the GitRepository is deleted
+	if err := r.secrets().addFinalizer(ctx, gitRepo, logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Check if existing secret has a valid token
 	existingSecret, err := r.secretManager.GetSecret(ctx, secretNamespace, secretName)
+
+	// Repositories cloned over SSH authenticate with a deploy key instead of a token
+	if github.IsSSHRepositoryURL(gitRepo.Spec.URL) {
+		if err != nil {
+			existingSecret = nil
+		}
+		return r.reconcileDeployKey(ctx, gitRepo, existingSecret, logger)
+	}
+
+	tokenExpired := false
 	if err == nil && r.secretManager.IsSecretManagedByController(existingSecret) {
-		expiry, err := r.secretManager.GetTokenExpiry(existingSecret)
-		if err == nil {
-			refreshThreshold := r.Config.TokenRefresh.RefreshInterval
-			if time.Until(expiry) > refreshThreshold {
-				logger.V(1).Info("Token still valid, skipping regeneration", "expiresAt", expiry)
-				// Schedule token refresh as usual
-				if err := r.refreshManager.ScheduleRefresh(ctx, secretNamespace, secretName, gitRepo.Spec.URL); err != nil {
-					logger.Error(err, "Failed to schedule token refresh")
-				}
-				return ctrl.Result{RequeueAfter: time.Until(expiry) - 5*time.Minute}, nil
+		if expiry, err := r.secretManager.GetTokenExpiry(existingSecret); err == nil {
+			tokenExpired = time.Now().After(expiry)
+		}
+		if coversTokenOptions(existingSecret, tokenOpts) {
+			if result, ok := r.secrets().keepValidToken(ctx, existingSecret, gitRepo.Spec.URL, r.Config.TokenRefresh.RefreshInterval, logger); ok {
+				return result, nil
 			}
 		}
 	}
 
 	// Generate GitHub installation token
-	installationToken, err := r.githubClient.GenerateInstallationToken(ctx, gitRepo.Spec.URL)
+	installationToken, err := r.githubClient.GenerateInstallationToken(ctx, gitRepo.Spec.URL, tokenOpts)
 	if err != nil {
 		logger.Error(err, "Failed to generate installation token")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to generate GitHub token: %v", err)
 		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "TokenGenerationFailed", err.Error())
 		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
 	}
@@ -133,10 +235,14 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		gitRepo,
 	); err != nil {
 		logger.Error(err, "Failed to create or update secret")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to write GitHub token to secret %s: %v", secretName, err)
 		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "SecretUpdateFailed", err.Error())
 		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
 	}
 
+	r.recorder.Eventf(gitRepo, corev1.EventTypeNormal, EventReasonTokenIssued,
+		"Issued GitHub token in secret %s, expires at %s", secretName, installationToken.GetExpiresAt().Format(time.RFC3339))
+
 	// Schedule token refresh
 	if err := r.refreshManager.ScheduleRefresh(ctx, secretNamespace, secretName, gitRepo.Spec.URL); err != nil {
 		logger.Error(err, "Failed to schedule token refresh")
@@ -147,52 +253,296 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionTrue, "TokenCreated",
 		fmt.Sprintf("GitHub token created and scheduled for refresh at %s", installationToken.GetExpiresAt().Format(time.RFC3339)))
 
+	// Reconcile the source now rather than at its next interval if it failed on the old token
+	if requested, err := token.RequestReconcile(ctx, r.Client, gitRepo, tokenExpired, r.Config.TokenRefresh.ReconcileRequestInterval); err != nil {
+		logger.Error(err, "Failed to request reconciliation of GitRepository")
+	} else if requested {
+		logger.Info("Requested reconciliation of GitRepository with new token")
+	}
+
 	logger.Info("Successfully reconciled GitRepository")
 	return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
 }
 
-// isNamespaceExcluded checks if the namespace should be excluded from processing using glob patterns
-func (r *GitRepositoryReconciler) isNamespaceExcluded(namespace string) bool {
-	for _, excluded := range r.Config.Controller.ExcludedNamespaces {
-		// Use filepath.Match for glob pattern matching
-		matched, err := filepath.Match(excluded, namespace)
+// wantsSecretRef checks if a secretRef is generated for a GitRepository without one. The
+// auto-secret-ref annotation overrides the autoSecretRef setting.
+func (r *GitRepositoryReconciler) wantsSecretRef(gitRepo *sourcev1.GitRepository) bool {
+	if value, ok := gitRepo.Annotations[kubernetes.AnnotationAutoSecretRef]; ok {
+		enabled, err := strconv.ParseBool(value)
+		return err == nil && enabled
+	}
+	return r.Config.Controller.AutoSecretRef
+}
+
+// reconcileSecretRef points a GitRepository without secretRef at a generated secret. The secretRef
+// is written with server-side apply, so GitOps tools applying the GitRepository the same way leave
+// it alone. When the secretRef is removed while the generated secret exists, e.g. by a GitOps tool
+// restoring the manifest, the controller does not put it back, which would fight the tool. It marks
+// the GitRepository with the secret-ref-reverted annotation instead, which keeps it from generating
+// the secretRef again, reports the revert and revokes the token nobody references any more.
+func (r *GitRepositoryReconciler) reconcileSecretRef(ctx context.Context, gitRepo *sourcev1.GitRepository, logger logr.Logger) (ctrl.Result, error) {
+	secretName := generatedSecretName(gitRepo.Name)
+
+	// The secret is only created once the secretRef is in place, so an existing secret means the
+	// secretRef was reverted
+	secret, err := r.secretManager.GetSecret(ctx, gitRepo.Namespace, secretName)
+	if err == nil && r.secretManager.IsSecretManagedByController(secret) && metav1.IsControlledBy(secret, gitRepo) {
+		// The secret is only deleted once the revert is recorded, or the next reconcile would find
+		// neither and generate the secretRef again
+		patch := client.MergeFrom(gitRepo.DeepCopy())
+		if gitRepo.Annotations == nil {
+			gitRepo.Annotations = make(map[string]string)
+		}
+		gitRepo.Annotations[kubernetes.AnnotationSecretRefReverted] = secretName
+		if err := r.Patch(ctx, gitRepo, patch); err != nil {
+			logger.Error(err, "Failed to mark reverted secretRef")
+			return ctrl.Result{}, err
+		}
+
+		message := fmt.Sprintf("Generated secretRef %s was removed, add it to the GitRepository manifest to use a token", secretName)
+		logger.Info("Generated secretRef was reverted", "secret", secretName)
+		r.recorder.Event(gitRepo, corev1.EventTypeWarning, EventReasonSecretRefReverted, message)
+		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, EventReasonSecretRefReverted, message)
+
+		if err := r.secrets().deleteSecret(ctx, gitRepo, secret, gitRepo.Spec.URL, logger); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// The revert was recorded before and the generated secret is gone
+	if _, reverted := gitRepo.Annotations[kubernetes.AnnotationSecretRefReverted]; reverted {
+		logger.V(1).Info("Generated secretRef was reverted, skipping", "secret", secretName)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.secretManager.ValidateSecretOwnership(ctx, gitRepo.Namespace, secretName, gitRepo.Spec.URL); err != nil {
+		logger.Error(err, "Secret ownership validation failed")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict, "Cannot generate secret %s: %v", secretName, err)
+		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "SecretValidationFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	patch := &unstructured.Unstructured{}
+	patch.SetGroupVersionKind(sourcev1.GroupVersion.WithKind(sourcev1.GitRepositoryKind))
+	patch.SetNamespace(gitRepo.Namespace)
+	patch.SetName(gitRepo.Name)
+	if err := unstructured.SetNestedField(patch.Object, secretName, "spec", "secretRef", "name"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Patch(ctx, patch, client.Apply, client.FieldOwner(FieldOwner)); err != nil {
+		logger.Error(err, "Failed to set generated secretRef")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("Generated secretRef", "secret", secretName)
+	r.recorder.Eventf(gitRepo, corev1.EventTypeNormal, EventReasonSecretRefGenerated, "Set secretRef to generated secret %s", secretName)
+
+	// The secret is issued by the reconcile of the updated GitRepository
+	return ctrl.Result{RequeueAfter: time.Second}, nil
+}
+
+// generatedSecretName returns the name of the secret generated for a GitRepository. Names too long
+// for a secret are shortened and made unique with a hash.
+func generatedSecretName(gitRepoName string) string {
+	name := gitRepoName + generatedSecretSuffix
+	if len(name) <= validation.DNS1123SubdomainMaxLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(gitRepoName))
+	hash := hex.EncodeToString(sum[:])[:8]
+	prefix := gitRepoName[:validation.DNS1123SubdomainMaxLength-len(generatedSecretSuffix)-len(hash)-1]
+	return strings.TrimRight(prefix, "-.") + "-" + hash + generatedSecretSuffix
+}
+
+// reconcileDeployKey registers a deploy key for a GitRepository cloned over SSH and writes it to
+// its secret, unless the secret holds a deploy key that is not due for rotation
+func (r *GitRepositoryReconciler) reconcileDeployKey(ctx context.Context, gitRepo *sourcev1.GitRepository,
+	existingSecret *corev1.Secret, logger logr.Logger) (ctrl.Result, error) {
+
+	secretName := gitRepo.Spec.SecretRef.Name
+
+	if existingSecret != nil && r.secretManager.IsSecretManagedByController(existingSecret) && r.secretManager.GetDeployKeyID(existingSecret) != 0 {
+		rotateAt, err := r.secretManager.GetTokenExpiry(existingSecret)
+		if err == nil && time.Until(rotateAt) > r.Config.TokenRefresh.RefreshInterval {
+			logger.V(1).Info("Deploy key not due for rotation, skipping regeneration", "rotateAt", rotateAt)
+			if err := r.refreshManager.ScheduleRefresh(ctx, gitRepo.Namespace, secretName, gitRepo.Spec.URL); err != nil {
+				logger.Error(err, "Failed to schedule deploy key rotation")
+			}
+			return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
+		}
+	}
+
+	key, err := r.deployKeys.Issue(ctx, gitRepo.Namespace, secretName, gitRepo.Spec.URL, gitRepo)
+	if err != nil {
+		logger.Error(err, "Failed to issue deploy key")
+		r.recorder.Eventf(gitRepo, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to issue deploy key for secret %s: %v", secretName, err)
+		r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionFalse, "DeployKeyFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	r.recorder.Eventf(gitRepo, corev1.EventTypeNormal, EventReasonTokenIssued,
+		"Registered deploy key %d in secret %s, rotates at %s", key.ID, secretName, key.RotateAt.Format(time.RFC3339))
+
+	// Rotations run on the refresh schedule
+	if err := r.refreshManager.ScheduleRefresh(ctx, gitRepo.Namespace, secretName, gitRepo.Spec.URL); err != nil {
+		logger.Error(err, "Failed to schedule deploy key rotation")
+	}
+
+	r.updateGitRepositoryStatus(ctx, gitRepo, metav1.ConditionTrue, "DeployKeyCreated",
+		fmt.Sprintf("Deploy key registered and scheduled for rotation at %s", key.RotateAt.Format(time.RFC3339)))
+
+	// Reconcile the source now rather than at its next interval if it failed without the key.
+	// Deploy keys don't expire, so only failing sources are reconciled.
+	if requested, err := token.RequestReconcile(ctx, r.Client, gitRepo, false, r.Config.TokenRefresh.ReconcileRequestInterval); err != nil {
+		logger.Error(err, "Failed to request reconciliation of GitRepository")
+	} else if requested {
+		logger.Info("Requested reconciliation of GitRepository with new deploy key")
+	}
+
+	logger.Info("Successfully reconciled GitRepository")
+	return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
+}
+
+// secrets returns the lifecycle of the secrets issued to GitRepositories
+func (r *GitRepositoryReconciler) secrets() issuedSecrets {
+	return issuedSecrets{
+		client:         r.Client,
+		githubClient:   r.githubClient,
+		secretManager:  r.secretManager,
+		refreshManager: r.refreshManager,
+		recorder:       r.recorder,
+	}
+}
+
+// coversTokenOptions checks if the token in the secret was granted every requested permission
+// and covers every requested repository
+func coversTokenOptions(secret *corev1.Secret, opts github.TokenOptions) bool {
+	if len(opts.Permissions) > 0 {
+		granted, err := github.ParsePermissions(secret.Annotations[kubernetes.AnnotationPermissions])
 		if err != nil {
-			// If pattern is invalid, fall back to exact string matching
-			r.logger.V(1).Info("Invalid glob pattern, using exact match", "pattern", excluded, "error", err)
-			if namespace == excluded {
-				return true
+			return false
+		}
+		for name, level := range opts.Permissions {
+			if granted[name] != level {
+				return false
 			}
-		} else if matched {
-			return true
 		}
 	}
-	return false
+
+	if len(opts.Repositories) > 0 {
+		covered := make(map[string]bool)
+		for _, name := range strings.Split(secret.Annotations[kubernetes.AnnotationRepositories], ",") {
+			covered[strings.ToLower(name)] = true
+		}
+		for _, repository := range opts.Repositories {
+			name := repository[strings.LastIndex(repository, "/")+1:]
+			if !covered[strings.ToLower(strings.TrimSuffix(name, ".git"))] {
+				return false
+			}
+		}
+	}
+
+	return true
 }
 
-// isTargetOrganizationRepository checks if the repository URL belongs to the configured organization
+// isNamespaceExcluded checks if the namespace should be excluded from processing using glob patterns
+func (r *GitRepositoryReconciler) isNamespaceExcluded(namespace string) bool {
+	return isNamespaceExcluded(r.Config, namespace, r.logger)
+}
+
+// isTargetOrganizationRepository checks if the repository URL belongs to one of the configured organizations
 func (r *GitRepositoryReconciler) isTargetOrganizationRepository(url string) bool {
-	orgPrefix := fmt.Sprintf("https://github.com/%s/", r.Config.GitHub.Organization)
-	return strings.HasPrefix(url, orgPrefix)
+	return isTargetOrganizationRepository(r.Config, url)
 }
 
-// updateGitRepositoryStatus updates the GitRepository status
-func (r *GitRepositoryReconciler) updateGitRepositoryStatus(ctx context.Context, gitRepo *sourcev1.GitRepository,
-	status metav1.ConditionStatus, reason, message string) {
+// shouldReportUnmatchedOwner checks if a repository on the configured GitHub host, whose owner
+// has no GitHub App configured, expects a token from this controller. That is the case when its
+// secret does not exist yet or was previously managed by the controller. Secrets maintained by
+// hand are left alone.
+func (r *GitRepositoryReconciler) shouldReportUnmatchedOwner(ctx context.Context, gitRepo *sourcev1.GitRepository) bool {
+	if gitRepo.Spec.SecretRef == nil {
+		return false
+	}
+
+	ref, err := github.ParseRepositoryRef(gitRepo.Spec.URL)
+	if err != nil || ref.Host != r.Config.GitHub.Host() {
+		return false
+	}
+
+	secret, err := r.secretManager.GetSecret(ctx, gitRepo.Namespace, gitRepo.Spec.SecretRef.Name)
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
 
-	// Find existing condition or create new one
-	condition := metav1.Condition{
-		Type:               "Ready",
-		Status:             status,
-		Reason:             reason,
-		Message:            message,
-		LastTransitionTime: metav1.Now(),
+	return r.secretManager.IsSecretManagedByController(secret)
+}
+
+// isPushSecret checks if the secret is the push secret of an ImageUpdateAutomation pushing through
+// the GitRepository, whether or not the automation issued its token to it yet
+func (r *GitRepositoryReconciler) isPushSecret(ctx context.Context, gitRepo *sourcev1.GitRepository, secretName string) (bool, error) {
+	if secret, err := r.secretManager.GetSecret(ctx, gitRepo.Namespace, secretName); err == nil && r.secretManager.IsPushSecret(secret) {
+		return true, nil
+	}
+	if r.automationGVK.Empty() {
+		return false, nil
 	}
 
-	// Update the condition
-	meta.SetStatusCondition(&gitRepo.Status.Conditions, condition)
+	automations := &unstructured.UnstructuredList{}
+	automations.SetGroupVersionKind(r.automationGVK.GroupVersion().WithKind(r.automationGVK.Kind + "List"))
+	if err := r.List(ctx, automations, client.InNamespace(gitRepo.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list ImageUpdateAutomations: %w", err)
+	}
+
+	for i := range automations.Items {
+		automation := &automations.Items[i]
+		sourceRef, ok := automationSourceRef(automation)
+		if ok && sourceRef == client.ObjectKeyFromObject(gitRepo) && pushSecretName(automation) == secretName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// updateGitRepositoryStatus sets the GitHubTokenReady condition on the GitRepository. The status is
+// patched with an optimistic lock and only changes the GitHubTokenReady condition, so the Ready
+// condition and the rest of the status stay with source-controller. Conflicts with concurrent
+// status updates are retried on a fresh copy.
+func (r *GitRepositoryReconciler) updateGitRepositoryStatus(ctx context.Context, gitRepo *sourcev1.GitRepository,
+	status metav1.ConditionStatus, reason, message string) {
 
-	// Update the status
-	if err := r.Status().Update(ctx, gitRepo); err != nil {
+	current := gitRepo
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if current == nil {
+			current = &sourcev1.GitRepository{}
+			if err := r.Get(ctx, client.ObjectKeyFromObject(gitRepo), current); err != nil {
+				return err
+			}
+		}
+		base := current
+		current = nil
+
+		latest := base.DeepCopy()
+		changed := meta.SetStatusCondition(&latest.Status.Conditions, metav1.Condition{
+			Type:               TokenReadyCondition,
+			Status:             status,
+			ObservedGeneration: latest.Generation,
+			Reason:             reason,
+			Message:            message,
+		})
+		if !changed {
+			return nil
+		}
+
+		return r.Status().Patch(ctx, latest, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(FieldOwner))
+	})
+	if err != nil {
 		r.logger.Error(err, "Failed to update GitRepository status")
 	}
 }
@@ -202,48 +552,33 @@ func (r *GitRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Initialize logger
 	r.logger = ctrl.Log.WithName("controllers").WithName("GitRepository")
 
-	// Initialize GitHub client
-	githubClient, err := github.NewClient(&r.Config.GitHub)
+	// Share the GitHub client and refresh manager with the other reconcilers issuing credentials
+	if r.Tokens == nil {
+		tokens, err := NewTokenServices(mgr, r.Config)
+		if err != nil {
+			return err
+		}
+		r.Tokens = tokens
+	}
+	r.githubClient = r.Tokens.GitHubClient
+	r.secretManager = r.Tokens.SecretManager
+	r.refreshManager = r.Tokens.RefreshManager
+	r.deployKeys = r.Tokens.DeployKeys
+	r.recorder = r.Tokens.Recorder
+
+	// Secrets that an ImageUpdateAutomation names as its push secret are left to the automation
+	automationGVK, _, err := servedVersion(mgr, kubernetes.ImageAutomationGroup, kubernetes.ImageUpdateAutomationKind)
 	if err != nil {
-		return fmt.Errorf("failed to create GitHub client: %w", err)
+		return err
 	}
-	r.githubClient = githubClient
-
-	// Initialize secret manager
-	r.secretManager = kubernetes.NewSecretManager(r.Client)
-
-	// Initialize refresh manager (but don't start it yet)
-	r.refreshManager = token.NewRefreshManager(
-		r.Client,
-		r.githubClient,
-		r.secretManager,
-		r.Config.TokenRefresh.RefreshInterval,
-		r.logger,
-	)
-
-	// Create predicate to filter events
-	namespacePredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
-		return !r.isNamespaceExcluded(object.GetNamespace())
-	})
+	r.automationGVK = automationGVK
 
 	// Build the controller
 	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.GitRepository{}).
-		WithEventFilter(namespacePredicate)
-
-	// Add a runnable to start the refresh manager after the manager starts
-	err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
-		// Wait for the cache to sync before starting the refresh manager
-		if !mgr.GetCache().WaitForCacheSync(ctx) {
-			return fmt.Errorf("failed to wait for cache sync")
-		}
-
-		r.logger.Info("Cache synced, starting refresh manager")
-		return r.refreshManager.Start(ctx)
-	}))
-	if err != nil {
-		return fmt.Errorf("failed to add refresh manager runnable: %w", err)
-	}
+		// Watch managed secrets for deletion, so their tokens are revoked and the secrets recreated
+		Owns(&corev1.Secret{}, builder.WithPredicates(secretDeletionPredicate())).
+		WithEventFilter(namespacePredicate(r.Config, r.logger))
 
 	return controllerBuilder.Complete(r)
 }
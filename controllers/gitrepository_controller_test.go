@@ -2,6 +2,17 @@ package controllers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,17 +23,27 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/fluxcd/pkg/apis/meta"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
 	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
 )
 
 // MockGitHubClient for testing
@@ -35,7 +56,15 @@ func (m *MockGitHubClient) ValidateRepositoryURL(repoURL string) error {
 	return args.Error(0)
 }
 
-func (m *MockGitHubClient) GenerateInstallationToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+func (m *MockGitHubClient) GenerateInstallationToken(ctx context.Context, repoURL string, opts ghclient.TokenOptions) (*github.InstallationToken, error) {
+	args := m.Called(ctx, repoURL, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*github.InstallationToken), args.Error(1)
+}
+
+func (m *MockGitHubClient) GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
 	args := m.Called(ctx, repoURL)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -43,6 +72,29 @@ func (m *MockGitHubClient) GenerateInstallationToken(ctx context.Context, repoUR
 	return args.Get(0).(*github.InstallationToken), args.Error(1)
 }
 
+func (m *MockGitHubClient) RevokeInstallationToken(ctx context.Context, repoURL, token string) error {
+	args := m.Called(ctx, repoURL, token)
+	return args.Error(0)
+}
+
+func (m *MockGitHubClient) RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error) {
+	args := m.Called(ctx, repoURL, title, publicKey)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockGitHubClient) DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error {
+	args := m.Called(ctx, repoURL, keyID)
+	return args.Error(0)
+}
+
+func (m *MockGitHubClient) KnownHosts(ctx context.Context, repoURL string) ([]string, error) {
+	args := m.Called(ctx, repoURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // MockRefreshManager for testing
 type MockRefreshManager struct {
 	mock.Mock
@@ -66,6 +118,82 @@ func (m *MockRefreshManager) Stop() {
 	m.Called()
 }
 
+// newTestTokenConfig creates the configuration of the tests of the reconcilers issuing credentials
+// to sources, ImageUpdateAutomations and Providers
+func newTestTokenConfig() *config.Config {
+	return &config.Config{
+		GitHub: config.GitHubConfig{Organization: "testorg"},
+		Controller: config.ControllerConfig{
+			ExcludedNamespaces: []string{"flux-system"},
+		},
+		TokenRefresh: config.TokenRefreshConfig{RefreshInterval: 5 * time.Minute},
+	}
+}
+
+// newTestUnstructured creates an object of a kind this controller reads as unstructured
+func newTestUnstructured(gvk schema.GroupVersionKind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.Object["spec"] = spec
+	return obj
+}
+
+// newTestUnstructuredClient creates a fake client serving GitRepositories and the kind as
+// unstructured objects
+func newTestUnstructuredClient(t *testing.T, gvk schema.GroupVersionKind, objects ...client.Object) client.Client {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+	s.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objects...).
+		WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).
+		Build()
+}
+
+// newTestManagedSecret creates a managed secret in the default namespace holding a token of repoURL
+// that expires in an hour, controlled by the owner of the kind
+func newTestManagedSecret(name, repoURL string, ownerGVK schema.GroupVersionKind, ownerName string, ownerUID types.UID,
+	data map[string][]byte) *corev1.Secret {
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationRepositoryURL: repoURL,
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: ownerGVK.GroupVersion().String(),
+				Kind:       ownerGVK.Kind,
+				Name:       ownerName,
+				UID:        ownerUID,
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: data,
+	}
+}
+
+// newTestUnstructuredReconciler creates the state shared by the reconcilers of an unstructured kind
+func newTestUnstructuredReconciler(c client.Client, gvk schema.GroupVersionKind, githubClient ghclient.GitHubClient,
+	refreshManager token.RefreshManagerInterface, recorder record.EventRecorder) unstructuredReconciler {
+
+	return unstructuredReconciler{
+		client:         c,
+		gvk:            gvk,
+		githubClient:   githubClient,
+		secretManager:  kubernetes.NewSecretManager(c),
+		refreshManager: refreshManager,
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+}
+
 func TestGitRepositoryReconciler_Reconcile_Success(t *testing.T) {
 	// Set up test scheme
 	s := scheme.Scheme
@@ -110,10 +238,11 @@ func TestGitRepositoryReconciler_Reconcile_Success(t *testing.T) {
 
 	// Set up mock expectations
 	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
-	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository").Return(installationToken, nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", mock.Anything).Return(installationToken, nil)
 	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "test-secret", "https://github.com/testorg/test-repository").Return(nil)
 
 	// Create reconciler
+	recorder := record.NewFakeRecorder(10)
 	reconciler := &GitRepositoryReconciler{
 		Client:         fakeClient,
 		Scheme:         s,
@@ -121,6 +250,7 @@ func TestGitRepositoryReconciler_Reconcile_Success(t *testing.T) {
 		githubClient:   mockGitHubClient,
 		secretManager:  kubernetes.NewSecretManager(fakeClient),
 		refreshManager: mockRefreshManager,
+		recorder:       recorder,
 		logger:         logr.Discard(),
 	}
 
@@ -148,6 +278,11 @@ func TestGitRepositoryReconciler_Reconcile_Success(t *testing.T) {
 	assert.Equal(t, []byte("git"), secret.Data["username"])
 	assert.Equal(t, []byte("test-token-123"), secret.Data["password"])
 	assert.Equal(t, "flux-extension-controller", secret.Annotations[kubernetes.AnnotationManagedBy])
+	assert.Contains(t, secret.Finalizers, kubernetes.FinalizerRevokeToken)
+
+	// Verify the issued token was recorded as an event
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenIssued Issued GitHub token in secret test-secret")
 
 	// Verify GitRepository status was updated
 	updatedGitRepo := &sourcev1.GitRepository{}
@@ -157,6 +292,8 @@ func TestGitRepositoryReconciler_Reconcile_Success(t *testing.T) {
 	}, updatedGitRepo)
 	require.NoError(t, err)
 
+	assert.Contains(t, updatedGitRepo.Finalizers, kubernetes.FinalizerRevokeToken)
+
 	// Check that status conditions were set (may be empty in fake client)
 	// In a real cluster, the status would be updated, but fake client doesn't persist status updates
 	// So we'll verify the reconciliation completed successfully instead
@@ -194,10 +331,12 @@ func TestGitRepositoryReconciler_Reconcile_NonTargetOrganization(t *testing.T) {
 	}
 
 	reconciler := &GitRepositoryReconciler{
-		Client: fakeClient,
-		Scheme: s,
-		Config: cfg,
-		logger: logr.Discard(),
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
 	}
 
 	ctx := context.Background()
@@ -241,10 +380,12 @@ func TestGitRepositoryReconciler_Reconcile_ExcludedNamespace(t *testing.T) {
 	}
 
 	reconciler := &GitRepositoryReconciler{
-		Client: fakeClient,
-		Scheme: s,
-		Config: cfg,
-		logger: logr.Discard(),
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
 	}
 
 	ctx := context.Background()
@@ -292,11 +433,13 @@ func TestGitRepositoryReconciler_Reconcile_NoSecretRef(t *testing.T) {
 	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
 
 	reconciler := &GitRepositoryReconciler{
-		Client:       fakeClient,
-		Scheme:       s,
-		Config:       cfg,
-		githubClient: mockGitHubClient,
-		logger:       logr.Discard(),
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		githubClient:  mockGitHubClient,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
 	}
 
 	ctx := context.Background()
@@ -352,6 +495,7 @@ func TestGitRepositoryReconciler_Reconcile_ValidationFailure(t *testing.T) {
 		Config:        cfg,
 		githubClient:  mockGitHubClient,
 		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
 		logger:        logr.Discard(),
 	}
 
@@ -411,7 +555,7 @@ func TestGitRepositoryReconciler_Reconcile_TokenGenerationFailure(t *testing.T)
 
 	mockGitHubClient := &MockGitHubClient{}
 	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
-	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository").Return(nil, assert.AnError)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", mock.Anything).Return(nil, assert.AnError)
 
 	reconciler := &GitRepositoryReconciler{
 		Client:        fakeClient,
@@ -419,6 +563,7 @@ func TestGitRepositoryReconciler_Reconcile_TokenGenerationFailure(t *testing.T)
 		Config:        cfg,
 		githubClient:  mockGitHubClient,
 		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
 		logger:        logr.Discard(),
 	}
 
@@ -459,6 +604,8 @@ func TestGitRepositoryReconciler_Reconcile_DeletedResource(t *testing.T) {
 		Scheme:         s,
 		Config:         cfg,
 		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
 		logger:         logr.Discard(),
 	}
 
@@ -527,11 +674,13 @@ func TestGitRepositoryReconciler_Reconcile_SkipNonGenericProviders(t *testing.T)
 			mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
 
 			reconciler := &GitRepositoryReconciler{
-				Client:       fakeClient,
-				Scheme:       s,
-				Config:       cfg,
-				githubClient: mockGitHubClient,
-				logger:       logr.Discard(),
+				Client:        fakeClient,
+				Scheme:        s,
+				Config:        cfg,
+				githubClient:  mockGitHubClient,
+				recorder:      &record.FakeRecorder{},
+				secretManager: kubernetes.NewSecretManager(fakeClient),
+				logger:        logr.Discard(),
 			}
 
 			// Test reconciliation
@@ -592,11 +741,13 @@ func TestGitRepositoryReconciler_Reconcile_SkipNonGenericProvidersNoSecretRef(t
 	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
 
 	reconciler := &GitRepositoryReconciler{
-		Client:       fakeClient,
-		Scheme:       s,
-		Config:       cfg,
-		githubClient: mockGitHubClient,
-		logger:       logr.Discard(),
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		githubClient:  mockGitHubClient,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
 	}
 
 	// Test reconciliation
@@ -667,7 +818,7 @@ func TestGitRepositoryReconciler_Reconcile_GenericProviderStillWorks(t *testing.
 
 			mockGitHubClient := &MockGitHubClient{}
 			mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
-			mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository").Return(mockToken, nil)
+			mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", mock.Anything).Return(mockToken, nil)
 
 			mockRefreshManager := &MockRefreshManager{}
 			mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "test-secret", "https://github.com/testorg/test-repository").Return(nil)
@@ -679,6 +830,7 @@ func TestGitRepositoryReconciler_Reconcile_GenericProviderStillWorks(t *testing.
 				githubClient:   mockGitHubClient,
 				secretManager:  kubernetes.NewSecretManager(fakeClient),
 				refreshManager: mockRefreshManager,
+				recorder:       &record.FakeRecorder{},
 				logger:         logr.Discard(),
 			}
 
@@ -826,6 +978,29 @@ func TestIsNamespaceExcludedWithInvalidGlobPattern(t *testing.T) {
 	}
 }
 
+func TestNamespacePredicate(t *testing.T) {
+	cfg := &config.Config{
+		Controller: config.ControllerConfig{ExcludedNamespaces: []string{"kube-*"}},
+	}
+	filter := namespacePredicate(cfg, logr.Discard())
+
+	newSecret := func(namespace string, deleting bool) *corev1.Secret {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace}}
+		if deleting {
+			secret.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			secret.Finalizers = []string{kubernetes.FinalizerRevokeToken}
+		}
+		return secret
+	}
+
+	assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: newSecret("default", false), ObjectNew: newSecret("default", false)}))
+	assert.False(t, filter.Update(event.UpdateEvent{ObjectOld: newSecret("kube-system", false), ObjectNew: newSecret("kube-system", false)}))
+
+	// Objects being deleted in an excluded namespace still get their finalizer removed
+	assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: newSecret("kube-system", false), ObjectNew: newSecret("kube-system", true)}))
+	assert.True(t, filter.Create(event.CreateEvent{Object: newSecret("kube-system", true)}))
+}
+
 func TestIsTargetOrganizationRepository(t *testing.T) {
 	cfg := &config.Config{
 		GitHub: config.GitHubConfig{
@@ -845,6 +1020,193 @@ func TestIsTargetOrganizationRepository(t *testing.T) {
 		{"https://github.com/testorg/another-repo", true},
 		{"https://github.com/other-org/test-repo", false},
 		{"https://gitlab.com/testorg/test-repo", false},
+		{"ssh://git@github.com/testorg/test-repo", true},
+		{"ssh://git@github.com/other-org/test-repo", false},
+		{"git@github.com:testorg/test-repo.git", true},
+		{"https://github.com/TestOrg/test-repo", true},
+		{"https://github.com/testorg/test-repo/tree/main", true},
+		{"https://github.com/testorg-fork/test-repo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			result := reconciler.isTargetOrganizationRepository(tt.url)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestIsTargetOrganizationRepository_MultipleApps(t *testing.T) {
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{
+			Apps: []config.GitHubAppConfig{
+				{AppID: 1, Organization: "org-a"},
+				{AppID: 2, Organization: "org-b"},
+			},
+		},
+	}
+
+	reconciler := &GitRepositoryReconciler{
+		Config: cfg,
+	}
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://github.com/org-a/test-repo", true},
+		{"https://github.com/org-b/test-repo", true},
+		{"https://github.com/Org-B/test-repo", true},
+		{"https://github.com/org-c/test-repo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			result := reconciler.isTargetOrganizationRepository(tt.url)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_Reconcile_NoMatchingApp(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "default",
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/org-c/test-repository",
+			SecretRef: &meta.LocalObjectReference{
+				Name: "test-secret",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).WithStatusSubresource(gitRepo).Build()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{
+			Apps: []config.GitHubAppConfig{
+				{AppID: 1, Organization: "org-a"},
+				{AppID: 2, Organization: "org-b"},
+			},
+		},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+
+	reconciler := &GitRepositoryReconciler{
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		githubClient:  mockGitHubClient,
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
+		logger:        logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test-repo",
+			Namespace: "default",
+		},
+	}
+
+	result, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	updatedGitRepo := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, updatedGitRepo))
+	require.Len(t, updatedGitRepo.Status.Conditions, 1)
+	assert.Equal(t, "NoMatchingGitHubApp", updatedGitRepo.Status.Conditions[0].Reason)
+	assert.Contains(t, updatedGitRepo.Status.Conditions[0].Message, "configured organizations: org-a, org-b")
+
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything)
+}
+
+func TestGitRepositoryReconciler_Reconcile_NoMatchingAppUnmanagedSecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "default",
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/org-c/test-repository",
+			SecretRef: &meta.LocalObjectReference{
+				Name: "hand-made-secret",
+			},
+		},
+	}
+
+	// A secret maintained by hand, e.g. holding a personal access token
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "hand-made-secret",
+			Namespace: "default",
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).WithStatusSubresource(gitRepo).Build()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{
+			Organization: "org-a",
+		},
+	}
+
+	reconciler := &GitRepositoryReconciler{
+		Client:        fakeClient,
+		Scheme:        s,
+		Config:        cfg,
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
+		logger:        logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test-repo",
+			Namespace: "default",
+		},
+	}
+
+	result, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	updatedGitRepo := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, updatedGitRepo))
+	assert.Empty(t, updatedGitRepo.Status.Conditions)
+}
+
+func TestIsTargetOrganizationRepository_Enterprise(t *testing.T) {
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{
+			Organization: "testorg",
+			BaseURL:      "https://github.example.com/api/v3/",
+		},
+	}
+
+	reconciler := &GitRepositoryReconciler{
+		Config: cfg,
+	}
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://github.example.com/testorg/test-repo", true},
+		{"https://github.example.com/other-org/test-repo", false},
+		{"https://github.com/testorg/test-repo", false},
 	}
 
 	for _, tt := range tests {
@@ -921,6 +1283,7 @@ func TestGitRepositoryReconciler_Reconcile_SkipsRegenerationIfTokenValid(t *test
 		githubClient:   mockGitHubClient,
 		secretManager:  kubernetes.NewSecretManager(fakeClient),
 		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
 		logger:         logr.Discard(),
 	}
 
@@ -948,3 +1311,1069 @@ func TestGitRepositoryReconciler_Reconcile_SkipsRegenerationIfTokenValid(t *test
 	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything)
 	mockRefreshManager.AssertExpectations(t)
 }
+
+func TestGitRepositoryReconciler_updateGitRepositoryStatus_KeepsFluxConditions(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repo",
+			Namespace:  "default",
+			Generation: 3,
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repository",
+		},
+		Status: sourcev1.GitRepositoryStatus{
+			Conditions: []metav1.Condition{
+				{
+					Type:               meta.ReadyCondition,
+					Status:             metav1.ConditionFalse,
+					Reason:             "GitOperationFailed",
+					Message:            "authentication required",
+					LastTransitionTime: metav1.Now(),
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).WithStatusSubresource(gitRepo).Build()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:        fakeClient,
+		Scheme:        s,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
+	}
+
+	ctx := context.Background()
+	current := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, current))
+
+	reconciler.updateGitRepositoryStatus(ctx, current, metav1.ConditionTrue, "TokenCreated", "GitHub token created")
+
+	updatedGitRepo := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, updatedGitRepo))
+	require.Len(t, updatedGitRepo.Status.Conditions, 2)
+
+	// The Ready condition of source-controller is left alone
+	ready := apimeta.FindStatusCondition(updatedGitRepo.Status.Conditions, meta.ReadyCondition)
+	require.NotNil(t, ready)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status)
+	assert.Equal(t, "GitOperationFailed", ready.Reason)
+
+	tokenReady := apimeta.FindStatusCondition(updatedGitRepo.Status.Conditions, TokenReadyCondition)
+	require.NotNil(t, tokenReady)
+	assert.Equal(t, metav1.ConditionTrue, tokenReady.Status)
+	assert.Equal(t, "TokenCreated", tokenReady.Reason)
+	assert.Equal(t, int64(3), tokenReady.ObservedGeneration)
+}
+
+func TestGitRepositoryReconciler_updateGitRepositoryStatus_RetriesOnConflict(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "default",
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repository",
+		},
+	}
+
+	// source-controller updates the status while our first patch is in flight,
+	// so the API server rejects the patch carrying the old resource version
+	var patches int
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(gitRepo).
+		WithStatusSubresource(gitRepo).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				// A merge patch of the status, no apply taking ownership of every condition
+				assert.Equal(t, types.MergePatchType, patch.Type())
+				patches++
+				if patches == 1 {
+					fluxUpdate := &sourcev1.GitRepository{}
+					require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(obj), fluxUpdate))
+					apimeta.SetStatusCondition(&fluxUpdate.Status.Conditions, metav1.Condition{
+						Type:    meta.ReadyCondition,
+						Status:  metav1.ConditionTrue,
+						Reason:  meta.SucceededReason,
+						Message: "stored artifact",
+					})
+					require.NoError(t, c.Status().Update(ctx, fluxUpdate))
+					return apierrors.NewConflict(sourcev1.GroupVersion.WithResource("gitrepositories").GroupResource(),
+						obj.GetName(), assert.AnError)
+				}
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:        fakeClient,
+		Scheme:        s,
+		recorder:      &record.FakeRecorder{},
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		logger:        logr.Discard(),
+	}
+
+	ctx := context.Background()
+	current := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, current))
+
+	reconciler.updateGitRepositoryStatus(ctx, current, metav1.ConditionFalse, "TokenGenerationFailed", "rate limited")
+	assert.Equal(t, 2, patches)
+
+	updatedGitRepo := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, updatedGitRepo))
+
+	// The patch was retried on a fresh copy without dropping the condition written in between
+	assert.True(t, apimeta.IsStatusConditionTrue(updatedGitRepo.Status.Conditions, meta.ReadyCondition))
+	assert.True(t, apimeta.IsStatusConditionFalse(updatedGitRepo.Status.Conditions, TokenReadyCondition))
+}
+
+// fakeGitHubServer records the installation tokens revoked through the GitHub API
+type fakeGitHubServer struct {
+	// host is the GitHub host the client set serves, repositories on other hosts are refused
+	host string
+
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (f *fakeGitHubServer) revokedTokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.revoked...)
+}
+
+// newFakeGitHubServer starts a fake GitHub API and returns a client set of the testorg GitHub App talking to it
+func newFakeGitHubServer(t *testing.T) (*fakeGitHubServer, *ghclient.ClientSet) {
+	t.Helper()
+
+	fake := &fakeGitHubServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/v3/installation/token", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.revoked = append(fake.revoked, r.Header.Get("Authorization"))
+		fake.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKeyPath := filepath.Join(t.TempDir(), "private-key.pem")
+	require.NoError(t, os.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}), 0600))
+
+	clientSet, err := ghclient.NewClientSet(&config.GitHubConfig{
+		AppID:          123456,
+		InstallationID: 42,
+		PrivateKeyPath: privateKeyPath,
+		Organization:   "testorg",
+		BaseURL:        server.URL + "/api/v3/",
+	}, nil, nil)
+	require.NoError(t, err)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	fake.host = serverURL.Hostname()
+
+	return fake, clientSet
+}
+
+// newDeletedGitRepository returns a GitRepository being deleted and the managed secret it owns
+func newDeletedGitRepository(token string) (*sourcev1.GitRepository, *corev1.Secret) {
+	now := metav1.Now()
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-repo",
+			Namespace:         "default",
+			UID:               "test-repo-uid",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{kubernetes.FinalizerRevokeToken},
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repository",
+			SecretRef: &meta.LocalObjectReference{
+				Name: "test-secret",
+			},
+		},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repository",
+			},
+			Finalizers: []string{kubernetes.FinalizerRevokeToken},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.GitRepositoryKind,
+				Name:       "test-repo",
+				UID:        "test-repo-uid",
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: map[string][]byte{
+			"username": []byte("git"),
+			"password": []byte(token),
+		},
+		Type: kubernetes.SecretTypeGitRepository,
+	}
+
+	return gitRepo, secret
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletionRevokesToken(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	githubServer, githubClient := newFakeGitHubServer(t)
+	gitRepo, secret := newDeletedGitRepository("ghs_deleted")
+	secret.Annotations[kubernetes.AnnotationRepositoryURL] = "https://" + githubServer.host + "/testorg/test-repository"
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret).Build()
+
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-secret").Return()
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   githubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	// The token was revoked with itself as credential
+	assert.Equal(t, []string{"Bearer ghs_deleted"}, githubServer.revokedTokens())
+
+	// The secret is gone
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Releasing the finalizer lets the GitRepository go
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, &sourcev1.GitRepository{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenRevoked Revoked GitHub token and deleted secret test-secret")
+
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletionKeepsSharedToken(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo, secret := newDeletedGitRepository("ghs_shared")
+
+	// Another GitRepository of the same repository holds the same cached token
+	otherSecret := secret.DeepCopy()
+	otherSecret.Namespace = "other"
+	otherSecret.OwnerReferences = nil
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret, otherSecret).Build()
+	githubServer, githubClient := newFakeGitHubServer(t)
+
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-secret").Return()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   githubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	// The token is still in use and not revoked, but the secret of the deleted GitRepository is gone
+	assert.Empty(t, githubServer.revokedTokens())
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "other"}, &corev1.Secret{})
+	assert.NoError(t, err)
+
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletedSecretRevokesToken(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	// The deleted secret is released whether or not the GitRepository still issues tokens to it
+	tests := []struct {
+		name   string
+		update func(gitRepo *sourcev1.GitRepository, cfg *config.Config)
+	}{
+		{
+			name:   "referenced secret",
+			update: func(*sourcev1.GitRepository, *config.Config) {},
+		},
+		{
+			name: "secretRef renamed",
+			update: func(gitRepo *sourcev1.GitRepository, _ *config.Config) {
+				gitRepo.Spec.SecretRef.Name = "renamed-secret"
+			},
+		},
+		{
+			name: "provider switched",
+			update: func(gitRepo *sourcev1.GitRepository, _ *config.Config) {
+				gitRepo.Spec.Provider = sourcev1.GitProviderGitHub
+			},
+		},
+		{
+			name: "organization no longer configured",
+			update: func(_ *sourcev1.GitRepository, cfg *config.Config) {
+				cfg.GitHub.Organization = "otherorg"
+			},
+		},
+		{
+			name: "namespace excluded",
+			update: func(_ *sourcev1.GitRepository, cfg *config.Config) {
+				cfg.Controller.ExcludedNamespaces = []string{"default"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo, secret := newDeletedGitRepository("ghs_deleted_secret")
+			gitRepo.DeletionTimestamp = nil
+			now := metav1.Now()
+			secret.DeletionTimestamp = &now
+
+			cfg := &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}}
+			tt.update(gitRepo, cfg)
+
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret).Build()
+			mockGitHubClient := &MockGitHubClient{}
+			mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", "ghs_deleted_secret").Return(nil)
+			mockRefreshManager := &MockRefreshManager{}
+			mockRefreshManager.On("CancelRefresh", "default", "test-secret").Return()
+
+			reconciler := &GitRepositoryReconciler{
+				Client:         fakeClient,
+				Scheme:         s,
+				Config:         cfg,
+				githubClient:   mockGitHubClient,
+				secretManager:  kubernetes.NewSecretManager(fakeClient),
+				refreshManager: mockRefreshManager,
+				recorder:       &record.FakeRecorder{},
+				logger:         logr.Discard(),
+			}
+
+			ctx := context.Background()
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ctrl.Result{RequeueAfter: time.Second}, result)
+
+			// The token was revoked and the secret released, so it is recreated on the next reconciliation
+			mockGitHubClient.AssertExpectations(t)
+			mockRefreshManager.AssertExpectations(t)
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletionRevokesUnreferencedSecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	// The secretRef was renamed after the token was issued to test-secret
+	gitRepo, secret := newDeletedGitRepository("ghs_unreferenced")
+	gitRepo.Spec.SecretRef = &meta.LocalObjectReference{Name: "renamed-secret"}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", "ghs_unreferenced").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-secret").Return()
+	mockRefreshManager.On("CancelRefresh", "default", "renamed-secret").Return()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, &sourcev1.GitRepository{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_RequestedPermissions(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationPermissions: "contents:read",
+			},
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repository",
+			SecretRef: &meta.LocalObjectReference{
+				Name: "test-secret",
+			},
+		},
+	}
+
+	// The token in the secret is still valid, but was issued with other permissions
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repository",
+				kubernetes.AnnotationPermissions:   "contents:write,metadata:read",
+			},
+		},
+		Data: map[string][]byte{
+			"username": []byte("git"),
+			"password": []byte("existing-token"),
+		},
+		Type: kubernetes.SecretTypeGitRepository,
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+
+	cfg := &config.Config{
+		GitHub: config.GitHubConfig{
+			Organization: "testorg",
+		},
+		TokenRefresh: config.TokenRefreshConfig{
+			RefreshInterval: 30 * time.Minute,
+		},
+	}
+
+	installationToken := &github.InstallationToken{
+		Token:       github.String("scoped-token"),
+		ExpiresAt:   &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		Permissions: &github.InstallationPermissions{Contents: github.String("read")},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repository",
+		ghclient.TokenOptions{Permissions: map[string]string{"contents": "read"}, Requested: true}).Return(installationToken, nil)
+
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "test-secret", "https://github.com/testorg/test-repository").Return(nil)
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         cfg,
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	updatedSecret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, updatedSecret))
+	assert.Equal(t, []byte("scoped-token"), updatedSecret.Data["password"])
+	assert.Equal(t, "contents:read", updatedSecret.Annotations[kubernetes.AnnotationPermissions])
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_InvalidPermissions(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationPermissions: "contents:everything",
+			},
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repository",
+			SecretRef: &meta.LocalObjectReference{
+				Name: "test-secret",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).WithStatusSubresource(gitRepo).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: &MockRefreshManager{},
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 5 * time.Minute}, result)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning ValidationFailed Token options validation failed")
+
+	updatedGitRepo := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, updatedGitRepo))
+	condition := apimeta.FindStatusCondition(updatedGitRepo.Status.Conditions, TokenReadyCondition)
+	require.NotNil(t, condition)
+	assert.Equal(t, "ValidationFailed", condition.Reason)
+
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCoversTokenOptions(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				kubernetes.AnnotationPermissions:  "contents:read,metadata:read",
+				kubernetes.AnnotationRepositories: "charts,test-repository",
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		opts     ghclient.TokenOptions
+		expected bool
+	}{
+		{name: "no options", expected: true},
+		{name: "granted permission", opts: ghclient.TokenOptions{Permissions: map[string]string{"contents": "read"}}, expected: true},
+		{name: "other access level", opts: ghclient.TokenOptions{Permissions: map[string]string{"contents": "write"}}},
+		{name: "covered repository", opts: ghclient.TokenOptions{Repositories: []string{"testorg/Charts"}}, expected: true},
+		{name: "missing repository", opts: ghclient.TokenOptions{Repositories: []string{"charts", "infra"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, coversTokenOptions(secret, tt.opts))
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_Reconcile_SSHDeployKey(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	repoURL := "ssh://git@github.com/testorg/test-repository"
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-repo", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       repoURL,
+			SecretRef: &meta.LocalObjectReference{Name: "test-secret"},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("KnownHosts", mock.Anything, mock.Anything).Return([]string{"github.com ssh-ed25519 AAAA"}, nil)
+	mockGitHubClient.On("RegisterDeployKey", mock.Anything, repoURL, "flux-extension-controller default/test-secret", mock.Anything).Return(int64(7), nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "test-secret", repoURL).Return(nil)
+
+	secretManager := kubernetes.NewSecretManager(fakeClient)
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  secretManager,
+		refreshManager: mockRefreshManager,
+		deployKeys:     token.NewDeployKeyIssuer(mockGitHubClient, secretManager, 0),
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"}}
+	result, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+
+	// The secret holds the private key in the format of source-controller, and no token
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret))
+	assert.Contains(t, string(secret.Data["identity"]), "PRIVATE KEY")
+	assert.Equal(t, []byte("github.com ssh-ed25519 AAAA\n"), secret.Data["known_hosts"])
+	assert.NotContains(t, secret.Data, "password")
+	assert.Equal(t, int64(7), secretManager.GetDeployKeyID(secret))
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenIssued Registered deploy key 7 in secret test-secret")
+
+	// A deploy key that is not due for rotation is kept
+	result, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+	mockGitHubClient.AssertNumberOfCalls(t, "RegisterDeployKey", 1)
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_SSHDeployKeyRequestsReconcile(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	// source-controller reports the missing key until the next interval of the GitRepository
+	repoURL := "ssh://git@github.com/testorg/test-repository"
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-repo", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       repoURL,
+			SecretRef: &meta.LocalObjectReference{Name: "test-secret"},
+		},
+		Status: sourcev1.GitRepositoryStatus{
+			Conditions: []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionFalse, Reason: "AuthenticationFailed"}},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("KnownHosts", mock.Anything, mock.Anything).Return([]string{"github.com ssh-ed25519 AAAA"}, nil)
+	mockGitHubClient.On("RegisterDeployKey", mock.Anything, repoURL, mock.Anything, mock.Anything).Return(int64(7), nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "test-secret", repoURL).Return(nil)
+
+	secretManager := kubernetes.NewSecretManager(fakeClient)
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  secretManager,
+		refreshManager: mockRefreshManager,
+		deployKeys:     token.NewDeployKeyIssuer(mockGitHubClient, secretManager, 0),
+		recorder:       record.NewFakeRecorder(10),
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"}}
+	_, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	updated := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, updated))
+	assert.NotEmpty(t, updated.Annotations[meta.ReconcileRequestAnnotation])
+	mockGitHubClient.AssertNumberOfCalls(t, "RegisterDeployKey", 1)
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletionRemovesDeployKey(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo, secret := newDeletedGitRepository("")
+	gitRepo.Spec.URL = "ssh://git@github.com/testorg/test-repository"
+	secret.Annotations[kubernetes.AnnotationRepositoryURL] = gitRepo.Spec.URL
+	secret.Annotations[kubernetes.AnnotationDeployKeyID] = "7"
+	secret.Data = map[string][]byte{"identity": []byte("private")}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("DeleteDeployKey", mock.Anything, gitRepo.Spec.URL, int64(7)).Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-secret").Return()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	// The deploy key was removed from the repository along with the secret
+	mockGitHubClient.AssertExpectations(t)
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestGitRepositoryReconciler_Reconcile_GeneratesSecretRef(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		autoSecretRef bool
+		wantSecretRef bool
+	}{
+		{name: "annotation opts in", annotations: map[string]string{kubernetes.AnnotationAutoSecretRef: "true"}, wantSecretRef: true},
+		{name: "config default", autoSecretRef: true, wantSecretRef: true},
+		{name: "annotation opts out", annotations: map[string]string{kubernetes.AnnotationAutoSecretRef: "false"}, autoSecretRef: true},
+		{name: "not enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo := &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-repo", Namespace: "default", Annotations: tt.annotations},
+				Spec:       sourcev1.GitRepositorySpec{URL: "https://github.com/testorg/test-repository"},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).WithStatusSubresource(gitRepo).Build()
+
+			mockGitHubClient := &MockGitHubClient{}
+			mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &GitRepositoryReconciler{
+				Client: fakeClient,
+				Scheme: s,
+				Config: &config.Config{
+					GitHub:     config.GitHubConfig{Organization: "testorg"},
+					Controller: config.ControllerConfig{AutoSecretRef: tt.autoSecretRef},
+				},
+				githubClient:  mockGitHubClient,
+				secretManager: kubernetes.NewSecretManager(fakeClient),
+				recorder:      recorder,
+				logger:        logr.Discard(),
+			}
+
+			ctx := context.Background()
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+			})
+			require.NoError(t, err)
+
+			updated := &sourcev1.GitRepository{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, updated))
+			if !tt.wantSecretRef {
+				assert.Nil(t, updated.Spec.SecretRef)
+				assert.Empty(t, recorder.Events)
+				return
+			}
+
+			require.NotNil(t, updated.Spec.SecretRef)
+			assert.Equal(t, "test-repo-github-token", updated.Spec.SecretRef.Name)
+			assert.Equal(t, "https://github.com/testorg/test-repository", updated.Spec.URL)
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, "Normal SecretRefGenerated Set secretRef to generated secret test-repo-github-token")
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_Reconcile_ReportsRevertedSecretRef(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-repo",
+			Namespace:   "default",
+			UID:         "test-repo-uid",
+			Annotations: map[string]string{kubernetes.AnnotationAutoSecretRef: "true"},
+		},
+		Spec: sourcev1.GitRepositorySpec{URL: "https://github.com/testorg/test-repository"},
+	}
+	// The generated secret exists, but a GitOps tool removed the secretRef again
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo-github-token",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repository",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+			},
+			Finalizers: []string{kubernetes.FinalizerRevokeToken},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.GitRepositoryKind,
+				Name:       "test-repo",
+				UID:        "test-repo-uid",
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: map[string][]byte{
+			"username": []byte("git"),
+			"password": []byte("ghs_reverted"),
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret).WithStatusSubresource(gitRepo).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", "ghs_reverted").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-repo-github-token").Return()
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"}}
+	result, err := reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	// The token nobody references is revoked and its secret deleted
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo-github-token", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+
+	// The reported revert keeps the secretRef from being generated again once the secret is gone
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	// The secretRef is not put back
+	updated := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, updated))
+	assert.Nil(t, updated.Spec.SecretRef)
+
+	assert.Equal(t, "test-repo-github-token", updated.Annotations[kubernetes.AnnotationSecretRefReverted])
+
+	condition := apimeta.FindStatusCondition(updated.Status.Conditions, TokenReadyCondition)
+	require.NotNil(t, condition)
+	assert.Equal(t, EventReasonSecretRefReverted, condition.Reason)
+	require.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "Warning SecretRefReverted")
+	assert.Contains(t, <-recorder.Events, "Normal TokenRevoked Revoked GitHub token and deleted secret test-repo-github-token")
+}
+
+func TestGitRepositoryReconciler_Reconcile_RecordsRevertedSecretRefBeforeDeletingSecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-repo",
+			Namespace:   "default",
+			UID:         "test-repo-uid",
+			Annotations: map[string]string{kubernetes.AnnotationAutoSecretRef: "true"},
+		},
+		Spec: sourcev1.GitRepositorySpec{URL: "https://github.com/testorg/test-repository"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo-github-token",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repository",
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.GitRepositoryKind,
+				Name:       "test-repo",
+				UID:        "test-repo-uid",
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: map[string][]byte{"password": []byte("ghs_reverted")},
+	}
+	// The first annotation patch fails, and so does every status write
+	var patches int
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(s).
+		WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).
+		WithObjects(gitRepo, secret).
+		WithStatusSubresource(gitRepo).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if _, ok := obj.(*sourcev1.GitRepository); ok {
+					patches++
+					if patches == 1 {
+						return assert.AnError
+					}
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				return assert.AnError
+			},
+		}).
+		Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repository").Return(nil)
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", "ghs_reverted").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-repo-github-token").Return()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       record.NewFakeRecorder(10),
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"}}
+
+	// The secret is kept until the revert is recorded
+	_, err := reconciler.Reconcile(ctx, req)
+	require.Error(t, err)
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{}))
+	mockGitHubClient.AssertNotCalled(t, "RevokeInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+	err = fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Without the condition, the annotation keeps the secretRef from being generated again
+	_, err = reconciler.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	updated := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, updated))
+	assert.Nil(t, updated.Spec.SecretRef)
+	assert.Empty(t, updated.Status.Conditions)
+	assert.Equal(t, "test-repo-github-token", updated.Annotations[kubernetes.AnnotationSecretRefReverted])
+	mockGitHubClient.AssertNumberOfCalls(t, "RevokeInstallationToken", 1)
+}
+
+func TestGitRepositoryReconciler_Reconcile_DeletionRevokesGeneratedSecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	// The generated secretRef was reverted, so the GitRepository no longer references its secret
+	gitRepo, secret := newDeletedGitRepository("ghs_generated")
+	gitRepo.Spec.SecretRef = nil
+	secret.Name = generatedSecretName(gitRepo.Name)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(gitRepo, secret).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/test-repository", "ghs_generated").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "test-repo-github-token").Return()
+
+	reconciler := &GitRepositoryReconciler{
+		Client:         fakeClient,
+		Scheme:         s,
+		Config:         &config.Config{GitHub: config.GitHubConfig{Organization: "testorg"}},
+		githubClient:   mockGitHubClient,
+		secretManager:  kubernetes.NewSecretManager(fakeClient),
+		refreshManager: mockRefreshManager,
+		recorder:       &record.FakeRecorder{},
+		logger:         logr.Discard(),
+	}
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-repo", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo-github-token", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-repo", Namespace: "default"}, &sourcev1.GitRepository{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGeneratedSecretName(t *testing.T) {
+	assert.Equal(t, "app-github-token", generatedSecretName("app"))
+
+	long := strings.Repeat("a", 250)
+	name := generatedSecretName(long)
+	assert.LessOrEqual(t, len(name), 253)
+	assert.True(t, strings.HasSuffix(name, "-github-token"))
+	assert.NotEqual(t, name, generatedSecretName(strings.Repeat("a", 249)+"b"))
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+)
+
+// helmRepositorySource describes HelmRepositories of type oci, which pull charts from an OCI registry
+var helmRepositorySource = registrySource{
+	kind:      sourcev1.HelmRepositoryKind,
+	newObject: func() sourceObject { return &sourcev1.HelmRepository{} },
+	pullSpec: func(obj sourceObject) (string, string, bool) {
+		helmRepo := obj.(*sourcev1.HelmRepository)
+		if helmRepo.Spec.Type != sourcev1.HelmRepositoryTypeOCI || !isGenericProvider(helmRepo.Spec.Provider) {
+			return helmRepo.Spec.URL, "", false
+		}
+		if helmRepo.Spec.SecretRef == nil {
+			return helmRepo.Spec.URL, "", true
+		}
+		return helmRepo.Spec.URL, helmRepo.Spec.SecretRef.Name, true
+	},
+}
+
+// HelmRepositoryReconciler issues GitHub Packages pull credentials to HelmRepositories of type oci
+type HelmRepositoryReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *config.Config
+
+	// Tokens are the services shared with the other reconcilers, created by SetupWithManager if unset
+	Tokens *TokenServices
+
+	reconciler *registrySourceReconciler
+}
+
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmrepositories,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmrepositories/finalizers,verbs=update
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmrepositories/status,verbs=get;update;patch
+
+// Reconcile implements the reconciliation logic for HelmRepository resources
+func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconciler.Reconcile(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *HelmRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	reconciler, err := newRegistrySourceReconciler(mgr, r.Config, r.Tokens, helmRepositorySource)
+	if err != nil {
+		return err
+	}
+	r.reconciler = reconciler
+
+	return r.reconciler.setupWithManager(mgr)
+}
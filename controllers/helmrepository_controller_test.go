@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestHelmRepositoryReconciler_Reconcile_OCI(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	helmRepo := &sourcev1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "charts", Namespace: "default"},
+		Spec: sourcev1.HelmRepositorySpec{
+			URL:       "oci://ghcr.io/testorg/charts",
+			Type:      sourcev1.HelmRepositoryTypeOCI,
+			SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(helmRepo).WithStatusSubresource(helmRepo).Build()
+
+	packageToken := &github.InstallationToken{
+		Token:     github.String("ghs_packages"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "oci://ghcr.io/testorg/charts").Return(nil)
+	mockGitHubClient.On("GeneratePackageToken", mock.Anything, "oci://ghcr.io/testorg/charts").Return(packageToken, nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "ghcr-auth", "oci://ghcr.io/testorg/charts").Return(nil)
+
+	reconciler := &HelmRepositoryReconciler{
+		reconciler: newTestRegistrySourceReconciler(fakeClient, helmRepositorySource, mockGitHubClient, mockRefreshManager, record.NewFakeRecorder(10)),
+	}
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "charts", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "ghcr-auth", Namespace: "default"}, secret))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.True(t, metav1.IsControlledBy(secret, helmRepo))
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestHelmRepositoryReconciler_Reconcile_SkipsHTTPRepositories(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	helmRepo := &sourcev1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "charts", Namespace: "default"},
+		Spec: sourcev1.HelmRepositorySpec{
+			URL:       "https://testorg.github.io/charts",
+			SecretRef: &meta.LocalObjectReference{Name: "charts-auth"},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(helmRepo).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	reconciler := newTestRegistrySourceReconciler(fakeClient, helmRepositorySource, mockGitHubClient, &MockRefreshManager{}, record.NewFakeRecorder(10))
+
+	result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "charts", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	err = fakeClient.Get(context.Background(), types.NamespacedName{Name: "charts-auth", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	mockGitHubClient.AssertExpectations(t)
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// imageUpdateAutomationKind describes ImageUpdateAutomations, which push image updates to Git
+var imageUpdateAutomationKind = unstructuredKind{
+	group:        kubernetes.ImageAutomationGroup,
+	kind:         kubernetes.ImageUpdateAutomationKind,
+	name:         "imageupdateautomation",
+	notInstalled: "ImageUpdateAutomation API not installed, not issuing push tokens",
+}
+
+// pushSecretSuffix is appended to the name of an ImageUpdateAutomation to name its push secret,
+// unless the push-secret annotation names another one
+const pushSecretSuffix = "-github-push"
+
+// ImageUpdateAutomationReconciler issues write-scoped tokens to the ImageUpdateAutomations pushing
+// to GitHub. The token is written to a push secret of its own, so the read-only token that
+// source-controller uses for the GitRepository is not widened. image-automation-controller pushes
+// with the secretRef of the GitRepository it references, so automations are expected to reference
+// a GitRepository dedicated to pushing whose secretRef names the push secret.
+//
+// The image automation API is not a dependency of this controller, so automations are read as
+// unstructured objects in the version served by the cluster.
+type ImageUpdateAutomationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *config.Config
+
+	// Tokens are the services shared with the other reconcilers, created by SetupWithManager if unset
+	Tokens *TokenServices
+
+	unstructuredReconciler
+}
+
+// +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imageupdateautomations,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imageupdateautomations/finalizers,verbs=update
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories,verbs=get;list;watch
+
+// Reconcile issues the push token of an ImageUpdateAutomation and writes it to its push secret
+func (r *ImageUpdateAutomationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.logger.WithValues("imageupdateautomation", req.NamespacedName)
+
+	automation := r.newObject()
+	if err := r.Get(ctx, req.NamespacedName, automation); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get ImageUpdateAutomation")
+		return ctrl.Result{}, err
+	}
+
+	// Revoke the token and delete the push secret of an automation being deleted
+	if !automation.GetDeletionTimestamp().IsZero() {
+		return r.secrets().reconcileDelete(ctx, automation, pushSecretName(automation), "", logger)
+	}
+
+	// Release the secrets of the automation being deleted, including secrets it no longer references
+	if released, err := r.secrets().releaseDeletedSecrets(ctx, automation, "", logger); err != nil {
+		return ctrl.Result{}, err
+	} else if released {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	if isNamespaceExcluded(r.Config, automation.GetNamespace(), r.logger) {
+		logger.V(1).Info("Skipping ImageUpdateAutomation in excluded namespace")
+		return ctrl.Result{}, nil
+	}
+
+	sourceRef, ok := automationSourceRef(automation)
+	if !ok {
+		logger.V(1).Info("Skipping ImageUpdateAutomation without a GitRepository source")
+		return ctrl.Result{}, nil
+	}
+
+	// Owner references, and so push secrets, cannot cross namespaces
+	if sourceRef.Namespace != automation.GetNamespace() {
+		logger.V(1).Info("Skipping ImageUpdateAutomation with a source in another namespace", "source", sourceRef)
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, "ValidationFailed",
+			"Cannot issue a push token for GitRepository %s in another namespace", sourceRef)
+		return ctrl.Result{}, nil
+	}
+
+	gitRepo := &sourcev1.GitRepository{}
+	if err := r.Get(ctx, sourceRef, gitRepo); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.V(1).Info("Source GitRepository not found", "source", sourceRef)
+			return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		logger.Error(err, "Failed to get source GitRepository")
+		return ctrl.Result{}, err
+	}
+	url := gitRepo.Spec.URL
+
+	if !isTargetOrganizationRepository(r.Config, url) {
+		logger.V(1).Info("Skipping repository from different organization", "url", url)
+		return ctrl.Result{}, nil
+	}
+
+	// Tokens push over HTTPS only, SSH sources authenticate with their deploy key
+	if github.IsSSHRepositoryURL(url) || !isGenericProvider(gitRepo.Spec.Provider) {
+		logger.V(1).Info("Skipping source not pushing over HTTPS with static credentials", "url", url)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.githubClient.ValidateRepositoryURL(url); err != nil {
+		logger.Error(err, "Repository URL validation failed")
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, "ValidationFailed", "Repository URL validation failed: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	tokenOpts, err := token.PushTokenOptionsFor(automation)
+	if err != nil {
+		logger.Error(err, "Token options validation failed")
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, "ValidationFailed", "Token options validation failed: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	secretName := pushSecretName(automation)
+
+	if err := r.secretManager.ValidateSecretOwnership(ctx, automation.GetNamespace(), secretName, url); err != nil {
+		logger.Error(err, "Secret ownership validation failed")
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict, "Cannot manage secret %s: %v", secretName, err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	// Add the finalizer, so the token is revoked when the automation is deleted
+	if err := r.secrets().addFinalizer(ctx, automation, logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existingSecret, err := r.secretManager.GetSecret(ctx, automation.GetNamespace(), secretName)
+	if err == nil && r.secretManager.IsSecretManagedByController(existingSecret) {
+		// A secret another object issues tokens to is not taken over, both would keep rewriting it
+		if owner := metav1.GetControllerOf(existingSecret); owner != nil && owner.UID != automation.GetUID() {
+			logger.Info("Push secret is controlled by another object", "secret", secretName, "owner", owner.Kind+"/"+owner.Name)
+			r.recorder.Eventf(automation, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict,
+				"Cannot manage push secret %s controlled by %s %s, delete it to issue the push token", secretName, owner.Kind, owner.Name)
+			return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		if coversTokenOptions(existingSecret, tokenOpts) {
+			if result, ok := r.secrets().keepValidToken(ctx, existingSecret, url, r.Config.TokenRefresh.RefreshInterval, logger); ok {
+				return result, nil
+			}
+		}
+	}
+
+	installationToken, err := r.githubClient.GenerateInstallationToken(ctx, url, tokenOpts)
+	if err != nil {
+		logger.Error(err, "Failed to generate push token")
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to generate GitHub push token: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if err := r.secretManager.CreateOrUpdateSecret(ctx, automation.GetNamespace(), secretName, installationToken, url, automation); err != nil {
+		logger.Error(err, "Failed to create or update secret")
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to write GitHub push token to secret %s: %v", secretName, err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	r.recorder.Eventf(automation, corev1.EventTypeNormal, EventReasonTokenIssued,
+		"Issued GitHub push token in secret %s, expires at %s", secretName, installationToken.GetExpiresAt().Format(time.RFC3339))
+
+	// The token is only used for pushes once the source authenticates with the push secret
+	if gitRepo.Spec.SecretRef == nil || gitRepo.Spec.SecretRef.Name != secretName {
+		r.recorder.Eventf(automation, corev1.EventTypeWarning, "PushSecretNotReferenced",
+			"GitRepository %s does not reference push secret %s, point a GitRepository dedicated to this automation at it",
+			gitRepo.Name, secretName)
+	}
+
+	if err := r.refreshManager.ScheduleRefresh(ctx, automation.GetNamespace(), secretName, url); err != nil {
+		logger.Error(err, "Failed to schedule token refresh")
+	}
+
+	logger.Info("Successfully reconciled ImageUpdateAutomation")
+	return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
+}
+
+// automationSourceRef returns the GitRepository an ImageUpdateAutomation pushes through. Its
+// namespace defaults to the namespace of the automation.
+func automationSourceRef(automation *unstructured.Unstructured) (types.NamespacedName, bool) {
+	kind, _, _ := unstructured.NestedString(automation.Object, "spec", "sourceRef", "kind")
+	name, _, _ := unstructured.NestedString(automation.Object, "spec", "sourceRef", "name")
+	namespace, _, _ := unstructured.NestedString(automation.Object, "spec", "sourceRef", "namespace")
+	if kind != sourcev1.GitRepositoryKind || name == "" {
+		return types.NamespacedName{}, false
+	}
+	if namespace == "" {
+		namespace = automation.GetNamespace()
+	}
+
+	return types.NamespacedName{Namespace: namespace, Name: name}, true
+}
+
+// pushSecretName returns the name of the secret receiving the push token of an automation
+func pushSecretName(automation metav1.Object) string {
+	if name := automation.GetAnnotations()[kubernetes.AnnotationPushSecret]; name != "" {
+		return name
+	}
+	return automation.GetName() + pushSecretSuffix
+}
+
+// SetupWithManager sets up the controller with the Manager. Clusters without the image automation
+// API are left alone.
+func (r *ImageUpdateAutomationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.setupWithManager(mgr, r.Config, r.Tokens, imageUpdateAutomationKind, r)
+}
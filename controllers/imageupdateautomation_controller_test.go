@@ -0,0 +1,375 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+var testAutomationGVK = schema.GroupVersionKind{
+	Group:   kubernetes.ImageAutomationGroup,
+	Version: "v1",
+	Kind:    kubernetes.ImageUpdateAutomationKind,
+}
+
+// newTestAutomationReconciler creates an ImageUpdateAutomation reconciler for tests
+func newTestAutomationReconciler(c client.Client, githubClient ghclient.GitHubClient,
+	refreshManager token.RefreshManagerInterface, recorder record.EventRecorder) *ImageUpdateAutomationReconciler {
+
+	return &ImageUpdateAutomationReconciler{
+		Client:                 c,
+		Config:                 newTestTokenConfig(),
+		unstructuredReconciler: newTestUnstructuredReconciler(c, testAutomationGVK, githubClient, refreshManager, recorder),
+	}
+}
+
+// newTestAutomation creates an ImageUpdateAutomation pushing through the GitRepository sourceName
+func newTestAutomation(namespace, sourceName string) *unstructured.Unstructured {
+	return newTestUnstructured(testAutomationGVK, namespace, "app-images", map[string]interface{}{
+		"sourceRef": map[string]interface{}{
+			"kind": sourcev1.GitRepositoryKind,
+			"name": sourceName,
+		},
+	})
+}
+
+func TestImageUpdateAutomationReconciler_Reconcile_Success(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-push", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "https://github.com/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "app-images-github-push"},
+		},
+	}
+	automation := newTestAutomation("default", "app-push")
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, gitRepo, automation)
+
+	pushToken := &github.InstallationToken{
+		Token:       github.String("ghs_push"),
+		ExpiresAt:   &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		Permissions: &github.InstallationPermissions{Contents: github.String("write")},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/app",
+		ghclient.TokenOptions{Permissions: map[string]string{"contents": "write"}}).Return(pushToken, nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "app-images-github-push", "https://github.com/testorg/app").Return(nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := newTestAutomationReconciler(fakeClient, mockGitHubClient, mockRefreshManager, recorder)
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-images", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "app-images-github-push", Namespace: "default"}, secret))
+	assert.Equal(t, "ghs_push", string(secret.Data["password"]))
+	assert.Equal(t, "contents:write", secret.Annotations[kubernetes.AnnotationPermissions])
+	assert.True(t, kubernetes.NewSecretManager(fakeClient).IsPushSecret(secret))
+
+	updated := newTestAutomation("default", "app-push")
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "app-images", Namespace: "default"}, updated))
+	assert.Contains(t, updated.GetFinalizers(), kubernetes.FinalizerRevokeToken)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenIssued Issued GitHub push token in secret app-images-github-push")
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestImageUpdateAutomationReconciler_Reconcile_PushSecretNotReferenced(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "https://github.com/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "app-auth"},
+		},
+	}
+	automation := newTestAutomation("default", "app")
+	automation.SetAnnotations(map[string]string{kubernetes.AnnotationPushSecret: "app-push-auth"})
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, gitRepo, automation)
+
+	pushToken := &github.InstallationToken{
+		Token:     github.String("ghs_push"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/app", mock.Anything).Return(pushToken, nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "app-push-auth", "https://github.com/testorg/app").Return(nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := newTestAutomationReconciler(fakeClient, mockGitHubClient, mockRefreshManager, recorder)
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-images", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	// The read secret of the GitRepository is not touched
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "app-auth", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "app-push-auth", Namespace: "default"}, &corev1.Secret{}))
+
+	require.Len(t, recorder.Events, 2)
+	<-recorder.Events
+	assert.Contains(t, <-recorder.Events, "Warning PushSecretNotReferenced")
+}
+
+func TestImageUpdateAutomationReconciler_Reconcile_RefusesSecretOfGitRepository(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-push", Namespace: "default", UID: "gitrepo-uid"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "https://github.com/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "app-images-github-push"},
+		},
+	}
+	readSecret := newTestManagedSecret("app-images-github-push", "https://github.com/testorg/app",
+		sourcev1.GroupVersion.WithKind(sourcev1.GitRepositoryKind), "app-push", "gitrepo-uid",
+		map[string][]byte{"username": []byte("x-access-token"), "password": []byte("ghs_read")})
+	automation := newTestAutomation("default", "app-push")
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, gitRepo, readSecret, automation)
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := newTestAutomationReconciler(fakeClient, mockGitHubClient, &MockRefreshManager{}, recorder)
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-images", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 5 * time.Minute}, result)
+
+	// The secret stays with the GitRepository, so the two controllers don't keep rewriting it
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "app-images-github-push", Namespace: "default"}, secret))
+	assert.Equal(t, "ghs_read", string(secret.Data["password"]))
+	assert.True(t, metav1.IsControlledBy(secret, gitRepo))
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events,
+		"Warning SecretOwnershipConflict Cannot manage push secret app-images-github-push controlled by GitRepository app-push")
+}
+
+func TestImageUpdateAutomationReconciler_Reconcile_Skips(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		gitRepo   *sourcev1.GitRepository
+		sourceNS  string
+	}{
+		{
+			name:      "excluded namespace",
+			namespace: "flux-system",
+			gitRepo: &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "flux-system"},
+				Spec:       sourcev1.GitRepositorySpec{URL: "https://github.com/testorg/app"},
+			},
+		},
+		{
+			name:      "other organization",
+			namespace: "default",
+			gitRepo: &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec:       sourcev1.GitRepositorySpec{URL: "https://github.com/otherorg/app"},
+			},
+		},
+		{
+			name:      "ssh source",
+			namespace: "default",
+			gitRepo: &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec:       sourcev1.GitRepositorySpec{URL: "ssh://git@github.com/testorg/app"},
+			},
+		},
+		{
+			name:      "source in another namespace",
+			namespace: "default",
+			sourceNS:  "apps",
+			gitRepo: &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "apps"},
+				Spec:       sourcev1.GitRepositorySpec{URL: "https://github.com/testorg/app"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			automation := newTestAutomation(tt.namespace, "app")
+			if tt.sourceNS != "" {
+				require.NoError(t, unstructured.SetNestedField(automation.Object, tt.sourceNS, "spec", "sourceRef", "namespace"))
+			}
+			fakeClient := newTestUnstructuredClient(t, testAutomationGVK, tt.gitRepo, automation)
+
+			mockGitHubClient := &MockGitHubClient{}
+			reconciler := newTestAutomationReconciler(fakeClient, mockGitHubClient, &MockRefreshManager{}, record.NewFakeRecorder(10))
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "app-images", Namespace: tt.namespace},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ctrl.Result{}, result)
+			mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestImageUpdateAutomationReconciler_Reconcile_DeletionRevokesToken(t *testing.T) {
+	automation := newTestAutomation("default", "app-push")
+	automation.SetUID("automation-uid")
+	automation.SetFinalizers([]string{kubernetes.FinalizerRevokeToken})
+	automation.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+
+	secret := newTestManagedSecret("app-images-github-push", "https://github.com/testorg/app", testAutomationGVK, "app-images", "automation-uid",
+		map[string][]byte{"username": []byte("x-access-token"), "password": []byte("ghs_push")})
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, automation, secret)
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/app", "ghs_push").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "app-images-github-push").Return()
+
+	reconciler := newTestAutomationReconciler(fakeClient, mockGitHubClient, mockRefreshManager, record.NewFakeRecorder(10))
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-images", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "app-images-github-push", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestGitRepositoryReconciler_Reconcile_SkipsPushSecret(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-push", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "https://github.com/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "app-images-github-push"},
+		},
+	}
+	pushSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-images-github-push",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/app",
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: testAutomationGVK.GroupVersion().String(),
+				Kind:       kubernetes.ImageUpdateAutomationKind,
+				Name:       "app-images",
+				UID:        "automation-uid",
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: map[string][]byte{"username": []byte("x-access-token"), "password": []byte("ghs_push")},
+	}
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, gitRepo, pushSecret)
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+
+	reconciler := &GitRepositoryReconciler{
+		Client: fakeClient,
+		Config: &config.Config{
+			GitHub: config.GitHubConfig{Organization: "testorg"},
+		},
+		githubClient:  mockGitHubClient,
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
+		logger:        logr.Discard(),
+	}
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-push", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "app-images-github-push", Namespace: "default"}, secret))
+	assert.Equal(t, "ghs_push", string(secret.Data["password"]))
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGitRepositoryReconciler_Reconcile_LeavesPushSecretToAutomation(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-push", Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "https://github.com/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "app-images-github-push"},
+		},
+	}
+	automation := newTestAutomation("default", "app-push")
+	fakeClient := newTestUnstructuredClient(t, testAutomationGVK, gitRepo, automation)
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+
+	reconciler := &GitRepositoryReconciler{
+		Client:        fakeClient,
+		Config:        newTestTokenConfig(),
+		githubClient:  mockGitHubClient,
+		secretManager: kubernetes.NewSecretManager(fakeClient),
+		recorder:      &record.FakeRecorder{},
+		logger:        logr.Discard(),
+		automationGVK: testAutomationGVK,
+	}
+
+	// The push secret does not exist yet, the GitRepository must not issue its read token to it first
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "app-push", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "app-images-github-push", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -9,6 +9,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -18,12 +19,14 @@ import (
 // NamespaceReconciler reconciles Namespace objects for ConfigMap syncing
 type NamespaceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	logger logr.Logger
+	Scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	logger   logr.Logger
 }
 
 // +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.logger.WithValues("namespace", req.Name)
@@ -64,6 +67,8 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if r.shouldSyncToNamespace(namespace, &configMap) {
 			if err := r.syncConfigMapToNamespace(ctx, &configMap, namespace.Name, logger); err != nil {
 				logger.Error(err, "Failed to sync ConfigMap", "configMap", configMap.Name)
+				r.recorder.Eventf(namespace, corev1.EventTypeWarning, EventReasonConfigMapSyncFailed,
+					"Failed to sync ConfigMap %s/%s: %v", FluxSystemNamespace, configMap.Name, err)
 				return ctrl.Result{}, err
 			}
 			syncedCount++
@@ -149,8 +154,9 @@ func (r *NamespaceReconciler) shouldSyncToNamespace(namespace *corev1.Namespace,
 func (r *NamespaceReconciler) syncConfigMapToNamespace(ctx context.Context, sourceConfigMap *corev1.ConfigMap, targetNamespace string, logger logr.Logger) error {
 	// This is similar to the ConfigMapReconciler method, but we'll reuse the logic
 	configMapReconciler := &ConfigMapReconciler{
-		Client: r.Client,
-		Scheme: r.Scheme,
+		Client:   r.Client,
+		Scheme:   r.Scheme,
+		recorder: r.recorder,
 	}
 	return configMapReconciler.syncConfigMapToNamespace(ctx, sourceConfigMap, targetNamespace, logger)
 }
@@ -177,6 +183,7 @@ func (r *NamespaceReconciler) cleanupSyncedConfigMapsInNamespace(ctx context.Con
 
 func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.logger = ctrl.Log.WithName("namespace-controller")
+	r.recorder = mgr.GetEventRecorderFor(EventSource)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Namespace{}).
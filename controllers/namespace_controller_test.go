@@ -10,6 +10,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -152,9 +153,10 @@ func TestNamespaceReconciler_Reconcile(t *testing.T) {
 				Build()
 
 			reconciler := &NamespaceReconciler{
-				Client: fakeClient,
-				Scheme: scheme,
-				logger: zap.New(zap.UseDevMode(true)),
+				Client:   fakeClient,
+				Scheme:   scheme,
+				recorder: &record.FakeRecorder{},
+				logger:   zap.New(zap.UseDevMode(true)),
 			}
 
 			req := ctrl.Request{
@@ -405,9 +407,10 @@ func TestNamespaceReconciler_cleanupSyncedConfigMapsInNamespace(t *testing.T) {
 		Build()
 
 	reconciler := &NamespaceReconciler{
-		Client: fakeClient,
-		Scheme: scheme,
-		logger: zap.New(zap.UseDevMode(true)),
+		Client:   fakeClient,
+		Scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		logger:   zap.New(zap.UseDevMode(true)),
 	}
 
 	result, err := reconciler.cleanupSyncedConfigMapsInNamespace(ctx, namespaceName, reconciler.logger)
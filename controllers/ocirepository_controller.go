@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+)
+
+// ociRepositorySource describes OCIRepositories, which pull artifacts from an OCI registry
+var ociRepositorySource = registrySource{
+	kind:      sourcev1.OCIRepositoryKind,
+	newObject: func() sourceObject { return &sourcev1.OCIRepository{} },
+	pullSpec: func(obj sourceObject) (string, string, bool) {
+		ociRepo := obj.(*sourcev1.OCIRepository)
+		if !isGenericProvider(ociRepo.Spec.Provider) {
+			return ociRepo.Spec.URL, "", false
+		}
+		if ociRepo.Spec.SecretRef == nil {
+			return ociRepo.Spec.URL, "", true
+		}
+		return ociRepo.Spec.URL, ociRepo.Spec.SecretRef.Name, true
+	},
+}
+
+// OCIRepositoryReconciler issues GitHub Packages pull credentials to OCIRepositories
+type OCIRepositoryReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *config.Config
+
+	// Tokens are the services shared with the other reconcilers, created by SetupWithManager if unset
+	Tokens *TokenServices
+
+	reconciler *registrySourceReconciler
+}
+
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=ocirepositories,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=ocirepositories/finalizers,verbs=update
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=ocirepositories/status,verbs=get;update;patch
+
+// Reconcile implements the reconciliation logic for OCIRepository resources
+func (r *OCIRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconciler.Reconcile(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *OCIRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	reconciler, err := newRegistrySourceReconciler(mgr, r.Config, r.Tokens, ociRepositorySource)
+	if err != nil {
+		return err
+	}
+	r.reconciler = reconciler
+
+	return r.reconciler.setupWithManager(mgr)
+}
@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// newTestRegistrySourceReconciler creates the reconciler of a kind of registry source for tests
+func newTestRegistrySourceReconciler(c client.Client, source registrySource, githubClient ghclient.GitHubClient,
+	refreshManager token.RefreshManagerInterface, recorder record.EventRecorder) *registrySourceReconciler {
+
+	return &registrySourceReconciler{
+		Client:         c,
+		config:         newTestTokenConfig(),
+		source:         source,
+		githubClient:   githubClient,
+		secretManager:  kubernetes.NewSecretManager(c),
+		refreshManager: refreshManager,
+		recorder:       recorder,
+		logger:         logr.Discard(),
+	}
+}
+
+func TestOCIRepositoryReconciler_Reconcile_Success(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	ociRepo := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-artifact", Namespace: "default"},
+		Spec: sourcev1.OCIRepositorySpec{
+			URL:       "oci://ghcr.io/testorg/manifests/app",
+			SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(ociRepo).WithStatusSubresource(ociRepo).Build()
+
+	packageToken := &github.InstallationToken{
+		Token:       github.String("ghs_packages"),
+		ExpiresAt:   &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		Permissions: &github.InstallationPermissions{Packages: github.String("read")},
+	}
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "oci://ghcr.io/testorg/manifests/app").Return(nil)
+	mockGitHubClient.On("GeneratePackageToken", mock.Anything, "oci://ghcr.io/testorg/manifests/app").Return(packageToken, nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "ghcr-auth", "oci://ghcr.io/testorg/manifests/app").Return(nil)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &OCIRepositoryReconciler{
+		reconciler: newTestRegistrySourceReconciler(fakeClient, ociRepositorySource, mockGitHubClient, mockRefreshManager, recorder),
+	}
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "ghcr-auth", Namespace: "default"}, secret))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	require.NoError(t, json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &dockerConfig))
+	assert.Equal(t, "x-access-token", dockerConfig.Auths["ghcr.io"].Username)
+	assert.Equal(t, "ghs_packages", dockerConfig.Auths["ghcr.io"].Password)
+	assert.Equal(t, "oci://ghcr.io/testorg/manifests/app", secret.Annotations[kubernetes.AnnotationRepositoryURL])
+	assert.True(t, metav1.IsControlledBy(secret, ociRepo))
+
+	updated := &sourcev1.OCIRepository{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-artifact", Namespace: "default"}, updated))
+	assert.Contains(t, updated.Finalizers, kubernetes.FinalizerRevokeToken)
+	condition := apimeta.FindStatusCondition(updated.Status.Conditions, TokenReadyCondition)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenIssued Issued GitHub package token in secret ghcr-auth")
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestOCIRepositoryReconciler_Reconcile_Skips(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	tests := []struct {
+		name      string
+		namespace string
+		spec      sourcev1.OCIRepositorySpec
+	}{
+		{
+			name:      "other registry",
+			namespace: "default",
+			spec: sourcev1.OCIRepositorySpec{
+				URL:       "oci://docker.io/testorg/app",
+				SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+			},
+		},
+		{
+			name:      "other organization",
+			namespace: "default",
+			spec: sourcev1.OCIRepositorySpec{
+				URL:       "oci://ghcr.io/otherorg/app",
+				SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+			},
+		},
+		{
+			name:      "cloud provider",
+			namespace: "default",
+			spec: sourcev1.OCIRepositorySpec{
+				URL:       "oci://ghcr.io/testorg/app",
+				Provider:  sourcev1.AzureOCIProvider,
+				SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+			},
+		},
+		{
+			name:      "no secretRef",
+			namespace: "default",
+			spec: sourcev1.OCIRepositorySpec{
+				URL: "oci://ghcr.io/testorg/app",
+			},
+		},
+		{
+			name:      "excluded namespace",
+			namespace: "flux-system",
+			spec: sourcev1.OCIRepositorySpec{
+				URL:       "oci://ghcr.io/testorg/app",
+				SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ociRepo := &sourcev1.OCIRepository{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-artifact", Namespace: tt.namespace},
+				Spec:       tt.spec,
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(ociRepo).Build()
+
+			// No GitHub call is expected
+			mockGitHubClient := &MockGitHubClient{}
+			reconciler := newTestRegistrySourceReconciler(fakeClient, ociRepositorySource, mockGitHubClient, &MockRefreshManager{}, record.NewFakeRecorder(10))
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: tt.namespace},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ctrl.Result{}, result)
+
+			err = fakeClient.Get(context.Background(), types.NamespacedName{Name: "ghcr-auth", Namespace: tt.namespace}, &corev1.Secret{})
+			assert.True(t, apierrors.IsNotFound(err))
+			mockGitHubClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOCIRepositoryReconciler_Reconcile_SkipsRegenerationIfTokenValid(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	ociRepo := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-artifact",
+			Namespace:  "default",
+			Finalizers: []string{kubernetes.FinalizerRevokeToken},
+		},
+		Spec: sourcev1.OCIRepositorySpec{
+			URL:       "oci://ghcr.io/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ghcr-auth",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "oci://ghcr.io/testorg/app",
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(ociRepo, secret).Build()
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "oci://ghcr.io/testorg/app").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "ghcr-auth", "oci://ghcr.io/testorg/app").Return(nil)
+
+	reconciler := newTestRegistrySourceReconciler(fakeClient, ociRepositorySource, mockGitHubClient, mockRefreshManager, record.NewFakeRecorder(10))
+
+	result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Greater(t, result.RequeueAfter, 50*time.Minute)
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
+
+func TestOCIRepositoryReconciler_Reconcile_DeletionRevokesToken(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	now := metav1.Now()
+	ociRepo := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-artifact",
+			Namespace:         "default",
+			UID:               "test-artifact-uid",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{kubernetes.FinalizerRevokeToken},
+		},
+		Spec: sourcev1.OCIRepositorySpec{
+			URL:       "oci://containers.127.0.0.1/testorg/app",
+			SecretRef: &meta.LocalObjectReference{Name: "ghcr-auth"},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ghcr-auth",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(time.Hour).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "oci://containers.127.0.0.1/testorg/app",
+			},
+			Finalizers: []string{kubernetes.FinalizerRevokeToken},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.OCIRepositoryKind,
+				Name:       "test-artifact",
+				UID:        "test-artifact-uid",
+				Controller: ptr.To(true),
+			}},
+		},
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"containers.127.0.0.1":{"username":"x-access-token","password":"ghs_deleted"}}}`),
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithIndex(&corev1.Secret{}, kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint).WithObjects(ociRepo, secret).Build()
+	githubServer, githubClient := newFakeGitHubServer(t)
+
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "ghcr-auth").Return()
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := newTestRegistrySourceReconciler(fakeClient, ociRepositorySource, githubClient, mockRefreshManager, recorder)
+
+	ctx := context.Background()
+	result, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	assert.Equal(t, []string{"Bearer ghs_deleted"}, githubServer.revokedTokens())
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "ghcr-auth", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "test-artifact", Namespace: "default"}, &sourcev1.OCIRepository{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenRevoked Revoked GitHub token and deleted secret ghcr-auth")
+
+	mockRefreshManager.AssertExpectations(t)
+}
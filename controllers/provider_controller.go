@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// providerKind describes notification Providers, which post events to external services
+var providerKind = unstructuredKind{
+	group:        kubernetes.NotificationGroup,
+	kind:         kubernetes.ProviderKind,
+	name:         "provider",
+	notInstalled: "Provider API not installed, not issuing notification tokens",
+}
+
+// ProviderReconciler issues tokens to the Flux notification Providers of type github, which posts
+// commit statuses, and githubdispatch, which dispatches repository events. The token is scoped to
+// the repository in the address of the Provider and written to the token key of its secretRef.
+//
+// The notification API is not a dependency of this controller, so Providers are read as
+// unstructured objects in the version served by the cluster.
+type ProviderReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *config.Config
+
+	// Tokens are the services shared with the other reconcilers, created by SetupWithManager if unset
+	Tokens *TokenServices
+
+	unstructuredReconciler
+}
+
+// +kubebuilder:rbac:groups=notification.toolkit.fluxcd.io,resources=providers,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=notification.toolkit.fluxcd.io,resources=providers/finalizers,verbs=update
+
+// Reconcile issues the token of a Provider and writes it to the secret it references
+func (r *ProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.logger.WithValues("provider", req.NamespacedName)
+
+	provider := r.newObject()
+	if err := r.Get(ctx, req.NamespacedName, provider); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get Provider")
+		return ctrl.Result{}, err
+	}
+
+	// Revoke the token and delete the secret of a Provider being deleted
+	if !provider.GetDeletionTimestamp().IsZero() {
+		_, address, secretName := providerSpec(provider)
+		return r.secrets().reconcileDelete(ctx, provider, secretName, address, logger)
+	}
+
+	// Release the secrets of the Provider being deleted, including secrets it no longer references
+	if released, err := r.secrets().releaseDeletedSecrets(ctx, provider, "", logger); err != nil {
+		return ctrl.Result{}, err
+	} else if released {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	if isNamespaceExcluded(r.Config, provider.GetNamespace(), r.logger) {
+		logger.V(1).Info("Skipping Provider in excluded namespace")
+		return ctrl.Result{}, nil
+	}
+
+	providerType, address, secretName := providerSpec(provider)
+	if !token.IsGitHubProviderType(providerType) {
+		logger.V(1).Info("Skipping Provider not posting to GitHub", "type", providerType)
+		return ctrl.Result{}, nil
+	}
+	if secretName == "" {
+		logger.V(1).Info("No secretRef specified, skipping")
+		return ctrl.Result{}, nil
+	}
+
+	if !isTargetOrganizationRepository(r.Config, address) {
+		if r.shouldReportUnmatchedOwner(ctx, provider, address, secretName) {
+			logger.Info("No GitHub App configured for repository owner", "address", address)
+			r.recorder.Eventf(provider, corev1.EventTypeWarning, "NoMatchingGitHubApp",
+				"No GitHub App configured for repository %s (configured organizations: %s)",
+				address, strings.Join(r.Config.GitHub.Organizations(), ", "))
+			return ctrl.Result{}, nil
+		}
+		logger.V(1).Info("Skipping repository from different organization", "address", address)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.githubClient.ValidateRepositoryURL(address); err != nil {
+		logger.Error(err, "Repository URL validation failed")
+		r.recorder.Eventf(provider, corev1.EventTypeWarning, "ValidationFailed", "Repository URL validation failed: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	tokenOpts, err := token.ProviderTokenOptionsFor(providerType)
+	if err != nil {
+		logger.Error(err, "Token options validation failed")
+		r.recorder.Eventf(provider, corev1.EventTypeWarning, "ValidationFailed", "Token options validation failed: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if err := r.secretManager.ValidateSecretOwnership(ctx, provider.GetNamespace(), secretName, address); err != nil {
+		logger.Error(err, "Secret ownership validation failed")
+		r.recorder.Eventf(provider, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict, "Cannot manage secret %s: %v", secretName, err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	// Add the finalizer, so the token is revoked when the Provider is deleted
+	if err := r.secrets().addFinalizer(ctx, provider, logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existingSecret, err := r.secretManager.GetSecret(ctx, provider.GetNamespace(), secretName)
+	if err == nil && r.secretManager.IsSecretManagedByController(existingSecret) {
+		if r.secretManager.IsProviderSecret(existingSecret) && coversTokenOptions(existingSecret, tokenOpts) {
+			if result, ok := r.secrets().keepValidToken(ctx, existingSecret, address, r.Config.TokenRefresh.RefreshInterval, logger); ok {
+				return result, nil
+			}
+		}
+	}
+
+	installationToken, err := r.githubClient.GenerateInstallationToken(ctx, address, tokenOpts)
+	if err != nil {
+		logger.Error(err, "Failed to generate installation token")
+		r.recorder.Eventf(provider, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to generate GitHub token: %v", err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if err := r.secretManager.CreateOrUpdateProviderSecret(ctx, provider.GetNamespace(), secretName, installationToken, address, provider); err != nil {
+		logger.Error(err, "Failed to create or update secret")
+		r.recorder.Eventf(provider, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to write GitHub token to secret %s: %v", secretName, err)
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	r.recorder.Eventf(provider, corev1.EventTypeNormal, EventReasonTokenIssued,
+		"Issued GitHub token in secret %s, expires at %s", secretName, installationToken.GetExpiresAt().Format(time.RFC3339))
+
+	if err := r.refreshManager.ScheduleRefresh(ctx, provider.GetNamespace(), secretName, address); err != nil {
+		logger.Error(err, "Failed to schedule token refresh")
+	}
+
+	logger.Info("Successfully reconciled Provider")
+	return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
+}
+
+// shouldReportUnmatchedOwner checks if a Provider posting to a repository on the configured GitHub
+// host, whose owner has no GitHub App configured, expects a token from this controller. That is the
+// case when its secret does not exist yet or was previously managed by the controller.
+func (r *ProviderReconciler) shouldReportUnmatchedOwner(ctx context.Context, provider client.Object, address, secretName string) bool {
+	ref, err := github.ParseRepositoryRef(address)
+	if err != nil || ref.Host != r.Config.GitHub.Host() {
+		return false
+	}
+
+	secret, err := r.secretManager.GetSecret(ctx, provider.GetNamespace(), secretName)
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	return r.secretManager.IsSecretManagedByController(secret)
+}
+
+// providerSpec returns the type, the address and the name of the secretRef of a Provider
+func providerSpec(provider *unstructured.Unstructured) (providerType, address, secretName string) {
+	providerType, _, _ = unstructured.NestedString(provider.Object, "spec", "type")
+	address, _, _ = unstructured.NestedString(provider.Object, "spec", "address")
+	secretName, _, _ = unstructured.NestedString(provider.Object, "spec", "secretRef", "name")
+	return providerType, address, secretName
+}
+
+// SetupWithManager sets up the controller with the Manager. Clusters without the notification API
+// are left alone.
+func (r *ProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.setupWithManager(mgr, r.Config, r.Tokens, providerKind, r)
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+var testProviderGVK = schema.GroupVersionKind{
+	Group:   kubernetes.NotificationGroup,
+	Version: "v1beta3",
+	Kind:    kubernetes.ProviderKind,
+}
+
+// newTestProviderReconciler creates a Provider reconciler for tests
+func newTestProviderReconciler(c client.Client, githubClient ghclient.GitHubClient,
+	refreshManager token.RefreshManagerInterface, recorder record.EventRecorder) *ProviderReconciler {
+
+	return &ProviderReconciler{
+		Client:                 c,
+		Config:                 newTestTokenConfig(),
+		unstructuredReconciler: newTestUnstructuredReconciler(c, testProviderGVK, githubClient, refreshManager, recorder),
+	}
+}
+
+// newTestProvider creates a Provider of the type posting to address with the token in secretName
+func newTestProvider(namespace, providerType, address, secretName string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"type":    providerType,
+		"address": address,
+	}
+	if secretName != "" {
+		spec["secretRef"] = map[string]interface{}{"name": secretName}
+	}
+	return newTestUnstructured(testProviderGVK, namespace, "github-status", spec)
+}
+
+func TestProviderReconciler_Reconcile_Success(t *testing.T) {
+	tests := []struct {
+		providerType string
+		permissions  map[string]string
+	}{
+		{providerType: "github", permissions: map[string]string{"statuses": "write"}},
+		{providerType: "githubdispatch", permissions: map[string]string{"contents": "write"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.providerType, func(t *testing.T) {
+			provider := newTestProvider("default", tt.providerType, "https://github.com/testorg/app", "github-token")
+			fakeClient := newTestUnstructuredClient(t, testProviderGVK, provider)
+
+			installationToken := &github.InstallationToken{
+				Token:     github.String("ghs_notify"),
+				ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+			}
+
+			mockGitHubClient := &MockGitHubClient{}
+			mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+			mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/app",
+				ghclient.TokenOptions{Permissions: tt.permissions}).Return(installationToken, nil)
+			mockRefreshManager := &MockRefreshManager{}
+			mockRefreshManager.On("ScheduleRefresh", mock.Anything, "default", "github-token", "https://github.com/testorg/app").Return(nil)
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := newTestProviderReconciler(fakeClient, mockGitHubClient, mockRefreshManager, recorder)
+
+			ctx := context.Background()
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "github-status", Namespace: "default"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Minute}, result)
+
+			secret := &corev1.Secret{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "github-token", Namespace: "default"}, secret))
+			assert.Equal(t, map[string][]byte{"token": []byte("ghs_notify")}, secret.Data)
+			assert.True(t, metav1.IsControlledBy(secret, provider))
+
+			updated := newTestProvider("default", tt.providerType, "", "")
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "github-status", Namespace: "default"}, updated))
+			assert.Contains(t, updated.GetFinalizers(), kubernetes.FinalizerRevokeToken)
+
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, "Normal TokenIssued Issued GitHub token in secret github-token")
+
+			mockGitHubClient.AssertExpectations(t)
+			mockRefreshManager.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProviderReconciler_Reconcile_Skips(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *unstructured.Unstructured
+	}{
+		{
+			name:     "excluded namespace",
+			provider: newTestProvider("flux-system", "github", "https://github.com/testorg/app", "github-token"),
+		},
+		{
+			name:     "other provider type",
+			provider: newTestProvider("default", "slack", "https://hooks.slack.com/services/x", "slack-token"),
+		},
+		{
+			name:     "no secretRef",
+			provider: newTestProvider("default", "github", "https://github.com/testorg/app", ""),
+		},
+		{
+			name:     "other host",
+			provider: newTestProvider("default", "github", "https://gitlab.com/testorg/app", "github-token"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := newTestUnstructuredClient(t, testProviderGVK, tt.provider)
+
+			mockGitHubClient := &MockGitHubClient{}
+			reconciler := newTestProviderReconciler(fakeClient, mockGitHubClient, &MockRefreshManager{}, record.NewFakeRecorder(10))
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(tt.provider),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ctrl.Result{}, result)
+			mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestProviderReconciler_Reconcile_ReportsFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		setupMock func(m *MockGitHubClient)
+		result    ctrl.Result
+		event     string
+	}{
+		{
+			name:      "owner without GitHub App",
+			address:   "https://github.com/otherorg/app",
+			setupMock: func(*MockGitHubClient) {},
+			result:    ctrl.Result{},
+			event:     "Warning NoMatchingGitHubApp No GitHub App configured for repository https://github.com/otherorg/app",
+		},
+		{
+			name:    "token generation failed",
+			address: "https://github.com/testorg/app",
+			setupMock: func(m *MockGitHubClient) {
+				m.On("ValidateRepositoryURL", "https://github.com/testorg/app").Return(nil)
+				m.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/app", mock.Anything).
+					Return(nil, assert.AnError)
+			},
+			result: ctrl.Result{RequeueAfter: 5 * time.Minute},
+			event:  "Warning TokenIssueFailed Failed to generate GitHub token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider("default", "github", tt.address, "github-token")
+			fakeClient := newTestUnstructuredClient(t, testProviderGVK, provider)
+
+			mockGitHubClient := &MockGitHubClient{}
+			tt.setupMock(mockGitHubClient)
+			recorder := record.NewFakeRecorder(10)
+			reconciler := newTestProviderReconciler(fakeClient, mockGitHubClient, &MockRefreshManager{}, recorder)
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(provider),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.result, result)
+
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, tt.event)
+			mockGitHubClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProviderReconciler_Reconcile_DeletionRevokesToken(t *testing.T) {
+	provider := newTestProvider("default", "github", "https://github.com/testorg/app", "github-token")
+	provider.SetUID("provider-uid")
+	provider.SetFinalizers([]string{kubernetes.FinalizerRevokeToken})
+	provider.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+
+	secret := newTestManagedSecret("github-token", "https://github.com/testorg/app", testProviderGVK, "github-status", "provider-uid",
+		map[string][]byte{kubernetes.ProviderTokenKey: []byte("ghs_notify")})
+	fakeClient := newTestUnstructuredClient(t, testProviderGVK, provider, secret)
+
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("RevokeInstallationToken", mock.Anything, "https://github.com/testorg/app", "ghs_notify").Return(nil)
+	mockRefreshManager := &MockRefreshManager{}
+	mockRefreshManager.On("CancelRefresh", "default", "github-token").Return()
+
+	reconciler := newTestProviderReconciler(fakeClient, mockGitHubClient, mockRefreshManager, record.NewFakeRecorder(10))
+
+	ctx := context.Background()
+	_, err := reconciler.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: "github-status", Namespace: "default"},
+	})
+	require.NoError(t, err)
+
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "github-token", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	mockGitHubClient.AssertExpectations(t)
+	mockRefreshManager.AssertExpectations(t)
+}
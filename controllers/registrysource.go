@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// sourceObject is a Flux source reporting conditions
+type sourceObject interface {
+	client.Object
+	GetConditions() []metav1.Condition
+	SetConditions(conditions []metav1.Condition)
+}
+
+// registrySource describes a kind of Flux source pulling from an OCI registry
+type registrySource struct {
+	kind string
+
+	// newObject creates an empty source of the kind
+	newObject func() sourceObject
+
+	// pullSpec returns the URL and the name of the secretRef of a source. ok is false for sources
+	// that don't pull from an OCI registry with static credentials.
+	pullSpec func(obj sourceObject) (url, secretName string, ok bool)
+}
+
+// registrySourceReconciler issues package tokens to the Flux sources of one kind that pull from
+// the container registry of the GitHub host, and stores them as docker config secrets
+type registrySourceReconciler struct {
+	client.Client
+	config *config.Config
+	source registrySource
+
+	githubClient   github.GitHubClient
+	secretManager  *kubernetes.SecretManager
+	refreshManager token.RefreshManagerInterface
+	recorder       record.EventRecorder
+	logger         logr.Logger
+}
+
+// isGenericProvider checks if the source authenticates with the credentials in its secretRef
+// rather than with the workload identity of a cloud provider
+func isGenericProvider(provider string) bool {
+	return provider == "" || provider == sourcev1.GenericOCIProvider
+}
+
+// Reconcile issues the package token of a source and writes it to the secret it references
+func (r *registrySourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.logger.WithValues(strings.ToLower(r.source.kind), req.NamespacedName)
+
+	obj := r.source.newObject()
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get source")
+		return ctrl.Result{}, err
+	}
+
+	// Revoke the token and delete the secret of a source being deleted
+	if !obj.GetDeletionTimestamp().IsZero() {
+		url, secretName, _ := r.source.pullSpec(obj)
+		return r.secrets().reconcileDelete(ctx, obj, secretName, url, logger)
+	}
+
+	// Release the secrets of the source being deleted, including secrets it no longer references
+	if released, err := r.secrets().releaseDeletedSecrets(ctx, obj, "", logger); err != nil {
+		return ctrl.Result{}, err
+	} else if released {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	if isNamespaceExcluded(r.config, obj.GetNamespace(), r.logger) {
+		logger.V(1).Info("Skipping source in excluded namespace")
+		return ctrl.Result{}, nil
+	}
+
+	url, secretName, ok := r.source.pullSpec(obj)
+	if !ok {
+		logger.V(1).Info("Skipping source not pulling from an OCI registry with static credentials")
+		return ctrl.Result{}, nil
+	}
+	if secretName == "" {
+		logger.V(1).Info("No secretRef specified, skipping")
+		return ctrl.Result{}, nil
+	}
+
+	// Check if the packages belong to one of the target organizations
+	if !r.isTargetOrganizationRegistry(url) {
+		if r.shouldReportUnmatchedOwner(ctx, obj, url, secretName) {
+			message := fmt.Sprintf("No GitHub App configured for repository %s (configured organizations: %s)",
+				url, strings.Join(r.config.GitHub.Organizations(), ", "))
+			logger.Info("No GitHub App configured for repository owner", "url", url)
+			r.recorder.Event(obj, corev1.EventTypeWarning, "NoMatchingGitHubApp", message)
+			r.updateStatus(ctx, obj, metav1.ConditionFalse, "NoMatchingGitHubApp", message)
+			return ctrl.Result{}, nil
+		}
+		logger.V(1).Info("Skipping repository from different registry or organization", "url", url)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.githubClient.ValidateRepositoryURL(url); err != nil {
+		logger.Error(err, "Repository URL validation failed")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, "ValidationFailed", "Repository URL validation failed: %v", err)
+		r.updateStatus(ctx, obj, metav1.ConditionFalse, "ValidationFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if err := r.secretManager.ValidateSecretOwnership(ctx, obj.GetNamespace(), secretName, url); err != nil {
+		logger.Error(err, "Secret ownership validation failed")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonSecretOwnershipConflict, "Cannot manage secret %s: %v", secretName, err)
+		r.updateStatus(ctx, obj, metav1.ConditionFalse, "SecretValidationFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	// Add the finalizer, so the token is revoked when the source is deleted
+	if err := r.secrets().addFinalizer(ctx, obj, logger); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	tokenExpired := false
+	existingSecret, err := r.secretManager.GetSecret(ctx, obj.GetNamespace(), secretName)
+	if err == nil && r.secretManager.IsSecretManagedByController(existingSecret) {
+		expiry, err := r.secretManager.GetTokenExpiry(existingSecret)
+		tokenExpired = err == nil && time.Now().After(expiry)
+		if r.secretManager.IsRegistrySecret(existingSecret) {
+			if result, ok := r.secrets().keepValidToken(ctx, existingSecret, url, r.config.TokenRefresh.RefreshInterval, logger); ok {
+				return result, nil
+			}
+		}
+	}
+
+	packageToken, err := r.githubClient.GeneratePackageToken(ctx, url)
+	if err != nil {
+		logger.Error(err, "Failed to generate package token")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to generate GitHub package token: %v", err)
+		r.updateStatus(ctx, obj, metav1.ConditionFalse, "TokenGenerationFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	if err := r.secretManager.CreateOrUpdateRegistrySecret(ctx, obj.GetNamespace(), secretName, packageToken, url, obj); err != nil {
+		logger.Error(err, "Failed to create or update secret")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonTokenIssueFailed, "Failed to write GitHub package token to secret %s: %v", secretName, err)
+		r.updateStatus(ctx, obj, metav1.ConditionFalse, "SecretUpdateFailed", err.Error())
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	r.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonTokenIssued,
+		"Issued GitHub package token in secret %s, expires at %s", secretName, packageToken.GetExpiresAt().Format(time.RFC3339))
+
+	if err := r.refreshManager.ScheduleRefresh(ctx, obj.GetNamespace(), secretName, url); err != nil {
+		logger.Error(err, "Failed to schedule token refresh")
+	}
+
+	r.updateStatus(ctx, obj, metav1.ConditionTrue, "TokenCreated",
+		fmt.Sprintf("GitHub package token created and scheduled for refresh at %s", packageToken.GetExpiresAt().Format(time.RFC3339)))
+
+	// Reconcile the source now rather than at its next interval if it failed on the old token
+	if requested, err := token.RequestReconcile(ctx, r.Client, obj, tokenExpired, r.config.TokenRefresh.ReconcileRequestInterval); err != nil {
+		logger.Error(err, "Failed to request reconciliation of source")
+	} else if requested {
+		logger.Info("Requested reconciliation of source with new token")
+	}
+
+	logger.Info("Successfully reconciled source")
+	return ctrl.Result{RequeueAfter: 30 * time.Minute}, nil
+}
+
+// secrets returns the lifecycle of the secrets issued to sources of the kind
+func (r *registrySourceReconciler) secrets() issuedSecrets {
+	return issuedSecrets{
+		client:         r.Client,
+		githubClient:   r.githubClient,
+		secretManager:  r.secretManager,
+		refreshManager: r.refreshManager,
+		recorder:       r.recorder,
+	}
+}
+
+// isTargetOrganizationRegistry checks if the OCI repository URL points at the container registry
+// of the GitHub host and belongs to one of the configured organizations
+func (r *registrySourceReconciler) isTargetOrganizationRegistry(url string) bool {
+	if !github.IsOCIRepositoryURL(url) {
+		return false
+	}
+
+	ref, err := github.ParseRepositoryRef(url)
+	if err != nil || ref.Host != r.config.GitHub.RegistryHost() {
+		return false
+	}
+
+	for _, organization := range r.config.GitHub.Organizations() {
+		if ref.HasOwner(organization) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldReportUnmatchedOwner checks if a source pulling from the container registry of the GitHub
+// host, whose owner has no GitHub App configured, expects a token from this controller. That is the
+// case when its secret does not exist yet or was previously managed by the controller.
+func (r *registrySourceReconciler) shouldReportUnmatchedOwner(ctx context.Context, obj sourceObject, url, secretName string) bool {
+	if !github.IsOCIRepositoryURL(url) {
+		return false
+	}
+
+	ref, err := github.ParseRepositoryRef(url)
+	if err != nil || ref.Host != r.config.GitHub.RegistryHost() {
+		return false
+	}
+
+	secret, err := r.secretManager.GetSecret(ctx, obj.GetNamespace(), secretName)
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	return r.secretManager.IsSecretManagedByController(secret)
+}
+
+// updateStatus sets the GitHubTokenReady condition on the source, like updateGitRepositoryStatus
+// does for GitRepositories
+func (r *registrySourceReconciler) updateStatus(ctx context.Context, obj sourceObject,
+	status metav1.ConditionStatus, reason, message string) {
+
+	current := obj
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if current == nil {
+			current = r.source.newObject()
+			if err := r.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+				return err
+			}
+		}
+		base := current
+		current = nil
+
+		latest := base.DeepCopyObject().(sourceObject)
+		conditions := latest.GetConditions()
+		changed := meta.SetStatusCondition(&conditions, metav1.Condition{
+			Type:               TokenReadyCondition,
+			Status:             status,
+			ObservedGeneration: latest.GetGeneration(),
+			Reason:             reason,
+			Message:            message,
+		})
+		if !changed {
+			return nil
+		}
+		latest.SetConditions(conditions)
+
+		return r.Status().Patch(ctx, latest, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(FieldOwner))
+	})
+	if err != nil {
+		r.logger.Error(err, "Failed to update source status", "kind", r.source.kind)
+	}
+}
+
+// newRegistrySourceReconciler creates the reconciler of a kind of source, sharing tokens with the
+// other reconcilers. The token services are created when tokens is nil.
+func newRegistrySourceReconciler(mgr ctrl.Manager, cfg *config.Config, tokens *TokenServices, source registrySource) (*registrySourceReconciler, error) {
+	if tokens == nil {
+		var err error
+		tokens, err = NewTokenServices(mgr, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &registrySourceReconciler{
+		Client:         mgr.GetClient(),
+		config:         cfg,
+		source:         source,
+		githubClient:   tokens.GitHubClient,
+		secretManager:  tokens.SecretManager,
+		refreshManager: tokens.RefreshManager,
+		recorder:       tokens.Recorder,
+		logger:         ctrl.Log.WithName("controllers").WithName(source.kind),
+	}, nil
+}
+
+// setupWithManager sets up the controller of the source kind with the Manager
+func (r *registrySourceReconciler) setupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(r.source.newObject()).
+		// Watch managed secrets for deletion, so their tokens are revoked and the secrets recreated
+		Owns(&corev1.Secret{}, builder.WithPredicates(secretDeletionPredicate())).
+		WithEventFilter(namespacePredicate(r.config, r.logger)).
+		Complete(r)
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// TokenServices are the GitHub client, secret manager and refresh manager shared by the
+// reconcilers issuing credentials. A single refresh manager refreshes every managed secret,
+// whichever source owns it.
+type TokenServices struct {
+	GitHubClient   github.GitHubClient
+	SecretManager  *kubernetes.SecretManager
+	RefreshManager token.RefreshManagerInterface
+	DeployKeys     *token.DeployKeyIssuer
+	Recorder       record.EventRecorder
+}
+
+// NewTokenServices creates the token services and adds the private key watcher and the refresh
+// manager to the manager
+func NewTokenServices(mgr ctrl.Manager, cfg *config.Config) (*TokenServices, error) {
+	logger := ctrl.Log.WithName("controllers").WithName("TokenRefresh")
+
+	// Initialize one GitHub client per configured GitHub App
+	githubClient, err := github.NewClientSet(&cfg.GitHub, mgr.GetAPIReader(), mgr.GetCache())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	// Reload rotated GitHub App private keys while the manager runs
+	if err := mgr.Add(githubClient); err != nil {
+		return nil, fmt.Errorf("failed to add private key watcher: %w", err)
+	}
+
+	// Revocations look up the other secrets holding a token through this index rather than
+	// going through every secret in the cluster
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Secret{},
+		kubernetes.IndexTokenFingerprint, kubernetes.IndexSecretTokenFingerprint); err != nil {
+		return nil, fmt.Errorf("failed to index secrets by token: %w", err)
+	}
+
+	secretManager := kubernetes.NewSecretManager(mgr.GetClient())
+	recorder := mgr.GetEventRecorderFor(EventSource)
+
+	refreshManager := token.NewRefreshManager(
+		mgr.GetClient(),
+		githubClient,
+		secretManager,
+		recorder,
+		cfg.TokenRefresh,
+		logger,
+	)
+
+	// Add a runnable to start the refresh manager after the manager starts
+	err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		// Wait for the cache to sync before starting the refresh manager
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return fmt.Errorf("failed to wait for cache sync")
+		}
+
+		logger.Info("Cache synced, starting refresh manager")
+		return refreshManager.Start(ctx)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add refresh manager runnable: %w", err)
+	}
+
+	return &TokenServices{
+		GitHubClient:   githubClient,
+		SecretManager:  secretManager,
+		RefreshManager: refreshManager,
+		DeployKeys:     token.NewDeployKeyIssuer(githubClient, secretManager, cfg.TokenRefresh.DeployKeyRotation),
+		Recorder:       recorder,
+	}, nil
+}
+
+// revokeToken revokes the token stored in a managed secret, or removes its deploy key from the
+// repository. Expired tokens and tokens that other secrets still hold through the token cache
+// are not revoked.
+func revokeToken(ctx context.Context, githubClient github.GitHubClient, secretManager *kubernetes.SecretManager,
+	secret *corev1.Secret, repoURL string, logger logr.Logger) error {
+
+	if url := secret.Annotations[kubernetes.AnnotationRepositoryURL]; url != "" {
+		repoURL = url
+	}
+
+	if keyID := secretManager.GetDeployKeyID(secret); keyID != 0 {
+		return githubClient.DeleteDeployKey(ctx, repoURL, keyID)
+	}
+
+	token := secretManager.GetToken(secret)
+	if token == "" {
+		return nil
+	}
+
+	if expiry, err := secretManager.GetTokenExpiry(secret); err == nil && time.Now().After(expiry) {
+		logger.V(1).Info("Token already expired, skipping revocation", "secret", secret.Name)
+		return nil
+	}
+
+	shared, err := secretManager.IsTokenShared(ctx, secret)
+	if err != nil {
+		return err
+	}
+	if shared {
+		logger.Info("Token is shared with other secrets, skipping revocation", "secret", secret.Name)
+		return nil
+	}
+
+	return githubClient.RevokeInstallationToken(ctx, repoURL, token)
+}
+
+// issuedSecrets manages the secrets the reconcilers issue credentials to on behalf of the objects
+// owning them: the finalizer of the owner, the revocation of tokens and the refresh jobs. The
+// reconcilers only supply the secret, the repository URL and the token options.
+type issuedSecrets struct {
+	client         client.Client
+	githubClient   github.GitHubClient
+	secretManager  *kubernetes.SecretManager
+	refreshManager token.RefreshManagerInterface
+	recorder       record.EventRecorder
+}
+
+// addFinalizer adds the token revocation finalizer to the owner, so its tokens are revoked when
+// it is deleted
+func (s issuedSecrets) addFinalizer(ctx context.Context, owner client.Object, logger logr.Logger) error {
+	if controllerutil.ContainsFinalizer(owner, kubernetes.FinalizerRevokeToken) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(owner.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+	controllerutil.AddFinalizer(owner, kubernetes.FinalizerRevokeToken)
+	if err := s.client.Patch(ctx, owner, patch); err != nil {
+		logger.Error(err, "Failed to add finalizer")
+		return err
+	}
+
+	return nil
+}
+
+// releaseDeletedSecrets revokes the tokens of the secrets controlled by the owner that are being
+// deleted, removes their finalizer so they can go, and cancels their refresh jobs. The secrets are
+// found through their owner reference rather than the secretRef of the owner, so secrets it no
+// longer references or no longer issues tokens to are released as well. It returns whether a
+// secret was released; the owner recreates the secret it references once that is gone.
+func (s issuedSecrets) releaseDeletedSecrets(ctx context.Context, owner client.Object, repoURL string, logger logr.Logger) (bool, error) {
+	secrets, err := s.secretManager.ListControlledSecrets(ctx, owner)
+	if err != nil {
+		logger.Error(err, "Failed to list secrets")
+		return false, err
+	}
+
+	released := false
+	for i := range secrets {
+		secret := &secrets[i]
+		if secret.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(secret, kubernetes.FinalizerRevokeToken) {
+			continue
+		}
+
+		if err := revokeToken(ctx, s.githubClient, s.secretManager, secret, repoURL, logger); err != nil {
+			logger.Error(err, "Failed to revoke token of deleted secret", "secret", secret.Name)
+			s.recorder.Eventf(owner, corev1.EventTypeWarning, EventReasonTokenRevokeFailed, "Failed to revoke GitHub token in secret %s: %v", secret.Name, err)
+			return released, err
+		}
+		if err := s.secretManager.RemoveFinalizer(ctx, secret); err != nil {
+			logger.Error(err, "Failed to remove finalizer from secret", "secret", secret.Name)
+			return released, err
+		}
+		s.refreshManager.CancelRefresh(secret.Namespace, secret.Name)
+
+		s.recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonTokenRevoked, "Revoked GitHub token in deleted secret %s", secret.Name)
+		released = true
+	}
+
+	return released, nil
+}
+
+// keepValidToken checks if the token in a managed secret stays valid for longer than the refresh
+// interval. Such a token is not reissued: its refresh is scheduled and the returned result
+// requeues the owner before the token expires.
+func (s issuedSecrets) keepValidToken(ctx context.Context, secret *corev1.Secret, repoURL string,
+	refreshInterval time.Duration, logger logr.Logger) (ctrl.Result, bool) {
+
+	expiry, err := s.secretManager.GetTokenExpiry(secret)
+	if err != nil || time.Until(expiry) <= refreshInterval {
+		return ctrl.Result{}, false
+	}
+
+	logger.V(1).Info("Token still valid, skipping regeneration", "expiresAt", expiry)
+	if err := s.refreshManager.ScheduleRefresh(ctx, secret.Namespace, secret.Name, repoURL); err != nil {
+		logger.Error(err, "Failed to schedule token refresh")
+	}
+
+	return ctrl.Result{RequeueAfter: time.Until(expiry) - 5*time.Minute}, true
+}
+
+// deleteSecret revokes the token of a secret issued for the owner, deletes the secret and cancels
+// its refresh job
+func (s issuedSecrets) deleteSecret(ctx context.Context, owner client.Object, secret *corev1.Secret,
+	repoURL string, logger logr.Logger) error {
+
+	if err := revokeToken(ctx, s.githubClient, s.secretManager, secret, repoURL, logger); err != nil {
+		logger.Error(err, "Failed to revoke token", "secret", secret.Name)
+		s.recorder.Eventf(owner, corev1.EventTypeWarning, EventReasonTokenRevokeFailed, "Failed to revoke GitHub token in secret %s: %v", secret.Name, err)
+		return err
+	}
+	if err := s.secretManager.DeleteSecret(ctx, secret); err != nil {
+		logger.Error(err, "Failed to delete secret", "secret", secret.Name)
+		return err
+	}
+	s.refreshManager.CancelRefresh(secret.Namespace, secret.Name)
+
+	s.recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonTokenRevoked, "Revoked GitHub token and deleted secret %s", secret.Name)
+	return nil
+}
+
+// reconcileDelete revokes the tokens of an owner being deleted, deletes every secret it controls
+// and cancels their refresh jobs before it releases the finalizer. The refresh job of the secret
+// the owner references is cancelled as well. Secrets not issued for the owner are left alone.
+func (s issuedSecrets) reconcileDelete(ctx context.Context, owner client.Object, secretName, repoURL string,
+	logger logr.Logger) (ctrl.Result, error) {
+
+	if !controllerutil.ContainsFinalizer(owner, kubernetes.FinalizerRevokeToken) {
+		return ctrl.Result{}, nil
+	}
+
+	secrets, err := s.secretManager.ListControlledSecrets(ctx, owner)
+	if err != nil {
+		logger.Error(err, "Failed to list secrets")
+		return ctrl.Result{}, err
+	}
+
+	for i := range secrets {
+		if err := s.deleteSecret(ctx, owner, &secrets[i], repoURL, logger); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if secretName != "" {
+		s.refreshManager.CancelRefresh(owner.GetNamespace(), secretName)
+	}
+
+	patch := client.MergeFromWithOptions(owner.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(owner, kubernetes.FinalizerRevokeToken)
+	if err := s.client.Patch(ctx, owner, patch); err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("Cleaned up deleted object")
+	return ctrl.Result{}, nil
+}
+
+// isNamespaceExcluded checks if the namespace matches one of the excluded glob patterns
+func isNamespaceExcluded(cfg *config.Config, namespace string, logger logr.Logger) bool {
+	for _, excluded := range cfg.Controller.ExcludedNamespaces {
+		// Use filepath.Match for glob pattern matching
+		matched, err := filepath.Match(excluded, namespace)
+		if err != nil {
+			// If pattern is invalid, fall back to exact string matching
+			logger.V(1).Info("Invalid glob pattern, using exact match", "pattern", excluded, "error", err)
+			if namespace == excluded {
+				return true
+			}
+		} else if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// namespacePredicate passes events of objects outside the excluded namespaces. Objects being deleted
+// always pass, so the finalizers they got before their namespace was excluded are still removed.
+func namespacePredicate(cfg *config.Config, logger logr.Logger) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return !object.GetDeletionTimestamp().IsZero() || !isNamespaceExcluded(cfg, object.GetNamespace(), logger)
+	})
+}
+
+// isTargetOrganizationRepository checks if the repository URL is on the configured GitHub host and
+// belongs to one of the configured organizations
+func isTargetOrganizationRepository(cfg *config.Config, url string) bool {
+	ref, err := github.ParseRepositoryRef(url)
+	if err != nil || ref.Host != cfg.GitHub.Host() {
+		return false
+	}
+
+	for _, organization := range cfg.GitHub.Organizations() {
+		if ref.HasOwner(organization) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretDeletionPredicate passes events of managed secrets being deleted, so their tokens are
+// revoked and the secrets recreated
+func secretDeletionPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !e.ObjectNew.GetDeletionTimestamp().IsZero()
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
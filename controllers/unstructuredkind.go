@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+	"github.com/nrfcloud/flux-extension-controller/pkg/token"
+)
+
+// unstructuredKind describes a kind of another Flux controller whose API is not a dependency of
+// this controller. Its objects are read as unstructured objects in the version served by the cluster.
+type unstructuredKind struct {
+	group string
+	kind  string
+
+	// name names the controller reconciling the kind
+	name string
+
+	// notInstalled is logged when the cluster does not serve the API
+	notInstalled string
+}
+
+// unstructuredReconciler holds the served version of an unstructured kind and the token services
+// of the reconciler issuing tokens to its objects
+type unstructuredReconciler struct {
+	client         client.Client
+	gvk            schema.GroupVersionKind
+	githubClient   github.GitHubClient
+	secretManager  *kubernetes.SecretManager
+	refreshManager token.RefreshManagerInterface
+	recorder       record.EventRecorder
+	logger         logr.Logger
+}
+
+// newObject creates an empty object of the kind in the served version
+func (r *unstructuredReconciler) newObject() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.gvk)
+	return obj
+}
+
+// secrets returns the lifecycle of the secrets issued to objects of the kind
+func (r *unstructuredReconciler) secrets() issuedSecrets {
+	return issuedSecrets{
+		client:         r.client,
+		githubClient:   r.githubClient,
+		secretManager:  r.secretManager,
+		refreshManager: r.refreshManager,
+		recorder:       r.recorder,
+	}
+}
+
+// setupWithManager looks up the version of the kind served by the cluster and sets up its
+// controller with reconciler, sharing tokens with the other reconcilers. The token services are
+// created when tokens is nil. Clusters without the API are left alone.
+func (r *unstructuredReconciler) setupWithManager(mgr ctrl.Manager, cfg *config.Config, tokens *TokenServices,
+	kind unstructuredKind, reconciler reconcile.Reconciler) error {
+
+	r.logger = ctrl.Log.WithName("controllers").WithName(kind.kind)
+
+	gvk, installed, err := servedVersion(mgr, kind.group, kind.kind)
+	if err != nil {
+		return err
+	}
+	if !installed {
+		r.logger.Info(kind.notInstalled)
+		return nil
+	}
+	r.gvk = gvk
+
+	if tokens == nil {
+		tokens, err = NewTokenServices(mgr, cfg)
+		if err != nil {
+			return err
+		}
+	}
+	r.client = mgr.GetClient()
+	r.githubClient = tokens.GitHubClient
+	r.secretManager = tokens.SecretManager
+	r.refreshManager = tokens.RefreshManager
+	r.recorder = tokens.Recorder
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(kind.name).
+		For(r.newObject()).
+		// Watch managed secrets for deletion, so their tokens are revoked and the secrets recreated
+		Owns(&corev1.Secret{}, builder.WithPredicates(secretDeletionPredicate())).
+		WithEventFilter(namespacePredicate(cfg, r.logger)).
+		Complete(reconciler)
+}
+
+// servedVersion looks up the version of the kind served by the cluster. installed is false when
+// the cluster does not serve the API.
+func servedVersion(mgr ctrl.Manager, group, kind string) (gvk schema.GroupVersionKind, installed bool, err error) {
+	mapping, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{Group: group, Kind: kind})
+	if meta.IsNoMatchError(err) {
+		return schema.GroupVersionKind{}, false, nil
+	}
+	if err != nil {
+		return schema.GroupVersionKind{}, false, fmt.Errorf("failed to look up %s API: %w", kind, err)
+	}
+
+	return mapping.GroupVersionKind, true, nil
+}
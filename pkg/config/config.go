@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -19,12 +21,210 @@ type Config struct {
 	HealthProbe    HealthProbeConfig    `yaml:"healthProbe"`
 }
 
+// DefaultGitHubHost is the host repositories are served from when no BaseURL is configured
+const DefaultGitHubHost = "github.com"
+
+// DefaultRegistryHost is the host of the container registry of github.com
+const DefaultRegistryHost = "ghcr.io"
+
+// DefaultHTTPTimeout bounds requests to the GitHub API when no timeout is configured
+const DefaultHTTPTimeout = 30 * time.Second
+
+// DefaultRateLimitReserve is the number of remaining GitHub API requests kept for reconciles
+const DefaultRateLimitReserve = 500
+
 // GitHubConfig holds GitHub App configuration
 type GitHubConfig struct {
 	AppID          int64  `yaml:"appId"`
 	InstallationID int64  `yaml:"installationId,omitempty"`
 	PrivateKeyPath string `yaml:"privateKeyPath"`
 	Organization   string `yaml:"organization"`
+
+	// PrivateKeySecretRef selects a Secret the private key is read from through the Kubernetes
+	// API, instead of PrivateKeyPath
+	PrivateKeySecretRef *SecretKeyReference `yaml:"privateKeySecretRef,omitempty"`
+
+	// RemoteSigner signs JWTs with a key held by a remote signing service, instead of a
+	// private key read by the controller
+	RemoteSigner *RemoteSignerConfig `yaml:"remoteSigner,omitempty"`
+
+	// BaseURL is the API endpoint of a GitHub Enterprise Server instance,
+	// e.g. https://github.example.com/api/v3/. Leave empty for github.com.
+	BaseURL string `yaml:"baseUrl,omitempty"`
+	// UploadURL is the upload endpoint of a GitHub Enterprise Server instance.
+	// Defaults to the scheme and host of BaseURL.
+	UploadURL string `yaml:"uploadUrl,omitempty"`
+
+	// Permissions limits installation tokens to the given permissions, e.g. contents: read.
+	// GitRepositories can request other permissions with an annotation. Leave empty to
+	// request every permission granted to the installation.
+	Permissions map[string]string `yaml:"permissions,omitempty"`
+
+	// AnnotationPermissions caps the permissions Flux objects can request with the permissions
+	// annotation. Defaults to Permissions, so an annotation can only narrow the configured
+	// permissions.
+	AnnotationPermissions map[string]string `yaml:"annotationPermissions,omitempty"`
+
+	// HTTP configures the HTTP clients calling the GitHub API
+	HTTP HTTPConfig `yaml:"http,omitempty"`
+
+	// RateLimitReserve is the number of remaining GitHub API requests kept for reconciles. Token
+	// refreshes that can wait are deferred until the rate limit resets once fewer requests remain.
+	RateLimitReserve int `yaml:"rateLimitReserve,omitempty"`
+
+	// Apps lists additional GitHub Apps, each serving one organization
+	Apps []GitHubAppConfig `yaml:"apps,omitempty"`
+}
+
+// GitHubAppConfig holds the configuration of one GitHub App and the organization it is installed on
+type GitHubAppConfig struct {
+	AppID          int64  `yaml:"appId"`
+	InstallationID int64  `yaml:"installationId,omitempty"`
+	PrivateKeyPath string `yaml:"privateKeyPath"`
+	Organization   string `yaml:"organization"`
+
+	// PrivateKeySecretRef selects a Secret the private key is read from, instead of PrivateKeyPath
+	PrivateKeySecretRef *SecretKeyReference `yaml:"privateKeySecretRef,omitempty"`
+
+	// RemoteSigner signs JWTs with a key held by a remote signing service
+	RemoteSigner *RemoteSignerConfig `yaml:"remoteSigner,omitempty"`
+
+	// Permissions overrides the default token permissions for this App
+	Permissions map[string]string `yaml:"permissions,omitempty"`
+
+	// AnnotationPermissions overrides the cap of the permissions requested with annotations for this App
+	AnnotationPermissions map[string]string `yaml:"annotationPermissions,omitempty"`
+}
+
+// SecretKeyReference selects a key of a Kubernetes Secret
+type SecretKeyReference struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	Key       string `yaml:"key"`
+}
+
+// String returns the reference as namespace/name:key
+func (r *SecretKeyReference) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Namespace, r.Name, r.Key)
+}
+
+// RemoteSignerConfig selects a remote service signing JWTs with the GitHub App key, e.g. a
+// proxy in front of a KMS or HSM
+type RemoteSignerConfig struct {
+	// URL is the base URL of the signing service
+	URL string `yaml:"url"`
+
+	// TokenPath is a file holding a bearer token sent to the signing service. Optional.
+	TokenPath string `yaml:"tokenPath,omitempty"`
+}
+
+// HTTPConfig configures how the GitHub API is reached
+type HTTPConfig struct {
+	// ProxyURL is the proxy requests are sent through. Defaults to the HTTPS_PROXY and NO_PROXY
+	// environment variables.
+	ProxyURL string `yaml:"proxyUrl,omitempty"`
+
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system ones,
+	// e.g. of a proxy re-signing TLS
+	CAFile string `yaml:"caFile,omitempty"`
+
+	// CertFile and KeyFile hold a client certificate presented to the proxy or GitHub
+	CertFile string `yaml:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty"`
+
+	// Timeout bounds each request including reading its response. Defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// AppConfigs returns one GitHubConfig per configured GitHub App. The App
+// configured at the top level comes first, followed by the entries in Apps.
+// Every returned config shares the endpoint settings of c.
+func (c *GitHubConfig) AppConfigs() []GitHubConfig {
+	var configs []GitHubConfig
+
+	if c.AppID != 0 || len(c.Apps) == 0 {
+		appConfig := *c
+		appConfig.Apps = nil
+		configs = append(configs, appConfig)
+	}
+
+	for _, app := range c.Apps {
+		appConfig := *c
+		appConfig.AppID = app.AppID
+		appConfig.InstallationID = app.InstallationID
+		appConfig.PrivateKeyPath = app.PrivateKeyPath
+		appConfig.PrivateKeySecretRef = app.PrivateKeySecretRef
+		appConfig.RemoteSigner = app.RemoteSigner
+		appConfig.Organization = app.Organization
+		if len(app.Permissions) > 0 {
+			appConfig.Permissions = app.Permissions
+		}
+		if len(app.AnnotationPermissions) > 0 {
+			appConfig.AnnotationPermissions = app.AnnotationPermissions
+		}
+		appConfig.Apps = nil
+		configs = append(configs, appConfig)
+	}
+
+	return configs
+}
+
+// RequestablePermissions returns the most Flux objects can request with the permissions annotation:
+// AnnotationPermissions, or Permissions when unset. An empty result leaves requests to the
+// permissions granted to the installation.
+func (c *GitHubConfig) RequestablePermissions() map[string]string {
+	if len(c.AnnotationPermissions) > 0 {
+		return c.AnnotationPermissions
+	}
+	return c.Permissions
+}
+
+// Organizations returns the organizations served by the configured GitHub Apps
+func (c *GitHubConfig) Organizations() []string {
+	var organizations []string
+	for _, appConfig := range c.AppConfigs() {
+		if appConfig.Organization != "" {
+			organizations = append(organizations, appConfig.Organization)
+		}
+	}
+	return organizations
+}
+
+// Host returns the hostname that repositories are served from. It is derived
+// from BaseURL and falls back to github.com when BaseURL is unset.
+func (c *GitHubConfig) Host() string {
+	if c.BaseURL == "" {
+		return DefaultGitHubHost
+	}
+
+	parsedURL, err := url.Parse(c.BaseURL)
+	if err != nil || parsedURL.Hostname() == "" {
+		return DefaultGitHubHost
+	}
+
+	// api.github.com and the api.<subdomain>.ghe.com endpoints serve the API from a dedicated
+	// host, while repositories live on the bare host. GitHub Enterprise Server serves both from
+	// the same host, whatever its name.
+	host := strings.ToLower(parsedURL.Hostname())
+	if bareHost, ok := strings.CutPrefix(host, "api."); ok {
+		if bareHost == DefaultGitHubHost {
+			return bareHost
+		}
+		if subdomain, ok := strings.CutSuffix(bareHost, ".ghe.com"); ok && subdomain != "" && !strings.Contains(subdomain, ".") {
+			return bareHost
+		}
+	}
+	return host
+}
+
+// RegistryHost returns the host of the GitHub Packages container registry: ghcr.io for github.com
+// and containers.<host> for GitHub Enterprise Server
+func (c *GitHubConfig) RegistryHost() string {
+	host := c.Host()
+	if host == DefaultGitHubHost {
+		return DefaultRegistryHost
+	}
+	return "containers." + host
 }
 
 // ControllerConfig holds controller-specific configuration
@@ -32,6 +232,8 @@ type ControllerConfig struct {
 	ExcludedNamespaces []string `yaml:"excludedNamespaces"`
 	WatchAllNamespaces bool     `yaml:"watchAllNamespaces"`
 	Replicas           int      `yaml:"replicas"`
+	// AutoSecretRef generates a secretRef for GitRepositories without one, unless they opt out
+	AutoSecretRef bool `yaml:"autoSecretRef"`
 }
 
 // LeaderElectionConfig holds leader election configuration
@@ -40,10 +242,35 @@ type LeaderElectionConfig struct {
 	ID      string `yaml:"id"`
 }
 
+// Defaults for the token refresh workers
+const (
+	DefaultRefreshConcurrency = 4
+	DefaultRefreshRateLimit   = 10
+	DefaultRefreshBurst       = 20
+
+	// DefaultDeployKeyRotation is how long a deploy key is used before it is replaced
+	DefaultDeployKeyRotation = 30 * 24 * time.Hour
+
+	// DefaultReconcileRequestInterval is the minimum time between two reconciliations requested
+	// for the same source
+	DefaultReconcileRequestInterval = 5 * time.Minute
+)
+
 // TokenRefreshConfig holds token refresh configuration
 type TokenRefreshConfig struct {
 	RefreshInterval time.Duration `yaml:"refreshInterval"`
 	TokenLifetime   time.Duration `yaml:"tokenLifetime"`
+	// Concurrency is the number of token refreshes running in parallel
+	Concurrency int `yaml:"concurrency"`
+	// RateLimit is the number of token refreshes started per second
+	RateLimit float64 `yaml:"rateLimit"`
+	// Burst is the number of token refreshes that may start at once
+	Burst int `yaml:"burst"`
+	// DeployKeyRotation is how long the deploy key of an SSH GitRepository is used before it is replaced
+	DeployKeyRotation time.Duration `yaml:"deployKeyRotation"`
+	// ReconcileRequestInterval is the minimum time between two reconciliations requested for a
+	// source after its token was replaced
+	ReconcileRequestInterval time.Duration `yaml:"reconcileRequestInterval"`
 }
 
 // MetricsConfig holds metrics configuration
@@ -69,8 +296,13 @@ func LoadConfig(configPath string) (*Config, error) {
 			ID:      "flux-extension-controller", // Default leader election ID
 		},
 		TokenRefresh: TokenRefreshConfig{
-			RefreshInterval: 50 * time.Minute,
-			TokenLifetime:   60 * time.Minute,
+			RefreshInterval:          50 * time.Minute,
+			TokenLifetime:            60 * time.Minute,
+			Concurrency:              DefaultRefreshConcurrency,
+			RateLimit:                DefaultRefreshRateLimit,
+			Burst:                    DefaultRefreshBurst,
+			DeployKeyRotation:        DefaultDeployKeyRotation,
+			ReconcileRequestInterval: DefaultReconcileRequestInterval,
 		},
 		Metrics: MetricsConfig{
 			Address: "0.0.0.0:8080",
@@ -117,6 +349,14 @@ func LoadConfig(configPath string) (*Config, error) {
 		cfg.GitHub.Organization = organization
 	}
 
+	if baseURL := os.Getenv("GITHUB_BASE_URL"); baseURL != "" {
+		cfg.GitHub.BaseURL = baseURL
+	}
+
+	if uploadURL := os.Getenv("GITHUB_UPLOAD_URL"); uploadURL != "" {
+		cfg.GitHub.UploadURL = uploadURL
+	}
+
 	// Override leader election settings from environment variables
 	if leaderElectionEnabled := os.Getenv("LEADER_ELECTION_ENABLED"); leaderElectionEnabled != "" {
 		cfg.LeaderElection.Enabled = leaderElectionEnabled == "true"
@@ -144,17 +384,146 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 
 	// Validate required fields
-	if cfg.GitHub.AppID == 0 {
-		return nil, fmt.Errorf("GitHub App ID is required")
+	if err := validateGitHubApps(&cfg.GitHub); err != nil {
+		return nil, err
 	}
 
-	if cfg.GitHub.PrivateKeyPath == "" {
-		return nil, fmt.Errorf("GitHub private key path is required")
+	if err := validateEndpointURL(cfg.GitHub.BaseURL); err != nil {
+		return nil, fmt.Errorf("invalid GitHub base URL: %w", err)
 	}
 
-	if cfg.GitHub.Organization == "" {
-		return nil, fmt.Errorf("GitHub organization is required")
+	if err := validateEndpointURL(cfg.GitHub.UploadURL); err != nil {
+		return nil, fmt.Errorf("invalid GitHub upload URL: %w", err)
+	}
+
+	if err := validateHTTPConfig(&cfg.GitHub.HTTP); err != nil {
+		return nil, fmt.Errorf("invalid GitHub HTTP configuration: %w", err)
 	}
 
 	return cfg, nil
 }
+
+// validateGitHubApps checks that every configured GitHub App is complete and
+// that each organization is served by exactly one App
+func validateGitHubApps(cfg *GitHubConfig) error {
+	organizations := make(map[string]bool)
+
+	for i, appConfig := range cfg.AppConfigs() {
+		prefix := ""
+		if len(cfg.Apps) > 0 {
+			prefix = fmt.Sprintf("github app %d: ", i)
+		}
+
+		if appConfig.AppID == 0 {
+			return fmt.Errorf("%sGitHub App ID is required", prefix)
+		}
+
+		if err := validatePrivateKeySource(&appConfig); err != nil {
+			return fmt.Errorf("%s%w", prefix, err)
+		}
+
+		if appConfig.Organization == "" {
+			return fmt.Errorf("%sGitHub organization is required", prefix)
+		}
+
+		// GitHub organization names are case-insensitive
+		organization := strings.ToLower(appConfig.Organization)
+		if organizations[organization] {
+			return fmt.Errorf("%sGitHub organization %s is configured more than once", prefix, appConfig.Organization)
+		}
+		organizations[organization] = true
+
+		for _, permissions := range []map[string]string{appConfig.Permissions, appConfig.AnnotationPermissions} {
+			for name, level := range permissions {
+				if level != "read" && level != "write" && level != "admin" {
+					return fmt.Errorf("%sinvalid access level %q for permission %s, expected read, write or admin", prefix, level, name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePrivateKeySource checks that the App has exactly one source of its private key or signatures
+func validatePrivateKeySource(appConfig *GitHubConfig) error {
+	sources := 0
+	if appConfig.PrivateKeyPath != "" {
+		sources++
+	}
+	if appConfig.PrivateKeySecretRef != nil {
+		sources++
+	}
+	if appConfig.RemoteSigner != nil {
+		sources++
+	}
+
+	switch {
+	case sources == 0:
+		return fmt.Errorf("GitHub private key path is required")
+	case sources > 1:
+		return fmt.Errorf("GitHub private key path, private key secret and remote signer are mutually exclusive")
+	}
+
+	if ref := appConfig.PrivateKeySecretRef; ref != nil && (ref.Namespace == "" || ref.Name == "" || ref.Key == "") {
+		return fmt.Errorf("GitHub private key secret requires namespace, name and key")
+	}
+
+	if signer := appConfig.RemoteSigner; signer != nil {
+		if err := validateEndpointURL(signer.URL); err != nil || signer.URL == "" {
+			return fmt.Errorf("GitHub remote signer requires an absolute http or https URL")
+		}
+	}
+
+	return nil
+}
+
+// validateHTTPConfig checks the proxy URL and that client certificates come with their key
+func validateHTTPConfig(cfg *HTTPConfig) error {
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy URL scheme must be http, https or socks5, got %q", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return fmt.Errorf("proxy URL requires a host")
+		}
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("client certificate and key files must be set together")
+	}
+
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	return nil
+}
+
+// validateEndpointURL checks that an optional endpoint URL is absolute
+func validateEndpointURL(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	parsedURL, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", parsedURL.Scheme)
+	}
+
+	if parsedURL.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	return nil
+}
@@ -120,6 +120,11 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	assert.True(t, cfg.Controller.WatchAllNamespaces)
 	assert.Equal(t, 50*time.Minute, cfg.TokenRefresh.RefreshInterval)
 	assert.Equal(t, 60*time.Minute, cfg.TokenRefresh.TokenLifetime)
+	assert.Equal(t, DefaultRefreshConcurrency, cfg.TokenRefresh.Concurrency)
+	assert.Equal(t, float64(DefaultRefreshRateLimit), cfg.TokenRefresh.RateLimit)
+	assert.Equal(t, DefaultRefreshBurst, cfg.TokenRefresh.Burst)
+	assert.Equal(t, DefaultDeployKeyRotation, cfg.TokenRefresh.DeployKeyRotation)
+	assert.Equal(t, DefaultReconcileRequestInterval, cfg.TokenRefresh.ReconcileRequestInterval)
 }
 
 func TestLoadConfig_ValidationErrors(t *testing.T) {
@@ -203,3 +208,378 @@ func TestLoadConfig_ValidationErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfig_EnterpriseServer(t *testing.T) {
+	// Earlier tests may leave invalid values behind
+	t.Setenv("GITHUB_INSTALLATION_ID", "")
+	t.Setenv("GITHUB_BASE_URL", "")
+
+	configContent := `
+github:
+  appId: 12345
+  privateKeyPath: "/path/to/key"
+  organization: "testorg"
+  baseUrl: "https://github.example.com/api/v3/"
+  uploadUrl: "https://github.example.com/api/uploads/"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://github.example.com/api/v3/", cfg.GitHub.BaseURL)
+	assert.Equal(t, "https://github.example.com/api/uploads/", cfg.GitHub.UploadURL)
+	assert.Equal(t, "github.example.com", cfg.GitHub.Host())
+}
+
+func TestLoadConfig_InvalidBaseURL(t *testing.T) {
+	// Earlier tests may leave invalid values behind
+	t.Setenv("GITHUB_INSTALLATION_ID", "")
+	t.Setenv("GITHUB_BASE_URL", "")
+
+	configContent := `
+github:
+  appId: 12345
+  privateKeyPath: "/path/to/key"
+  organization: "testorg"
+  baseUrl: "github.example.com/api/v3"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	_, err = LoadConfig(tmpFile.Name())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid GitHub base URL")
+}
+
+func TestLoadConfig_HTTP(t *testing.T) {
+	// Earlier tests may leave invalid values behind
+	t.Setenv("GITHUB_INSTALLATION_ID", "")
+	t.Setenv("GITHUB_BASE_URL", "")
+
+	configContent := `
+github:
+  appId: 12345
+  privateKeyPath: "/path/to/key"
+  organization: "testorg"
+  http:
+    proxyUrl: "http://proxy.example.com:3128"
+    caFile: "/etc/github/ca.crt"
+    certFile: "/etc/github/tls.crt"
+    keyFile: "/etc/github/tls.key"
+    timeout: "45s"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, HTTPConfig{
+		ProxyURL: "http://proxy.example.com:3128",
+		CAFile:   "/etc/github/ca.crt",
+		CertFile: "/etc/github/tls.crt",
+		KeyFile:  "/etc/github/tls.key",
+		Timeout:  45 * time.Second,
+	}, cfg.GitHub.HTTP)
+
+	// Every App reaches GitHub the same way
+	assert.Equal(t, cfg.GitHub.HTTP, cfg.GitHub.AppConfigs()[0].HTTP)
+}
+
+func TestValidateHTTPConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         HTTPConfig
+		expectedErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "socks proxy",
+			cfg:  HTTPConfig{ProxyURL: "socks5://proxy.example.com:1080"},
+		},
+		{
+			name:        "proxy without scheme",
+			cfg:         HTTPConfig{ProxyURL: "proxy.example.com:3128"},
+			expectedErr: "proxy URL scheme must be http, https or socks5",
+		},
+		{
+			name:        "certificate without key",
+			cfg:         HTTPConfig{CertFile: "/etc/github/tls.crt"},
+			expectedErr: "client certificate and key files must be set together",
+		},
+		{
+			name:        "negative timeout",
+			cfg:         HTTPConfig{Timeout: -time.Second},
+			expectedErr: "timeout must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHTTPConfig(&tt.cfg)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestGitHubConfig_Host(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"", "github.com"},
+		{"https://api.github.com/", "github.com"},
+		{"https://github.example.com/api/v3/", "github.example.com"},
+		{"https://GitHub.Example.com:8443/api/v3/", "github.example.com"},
+		{"https://api.acme.ghe.com/", "acme.ghe.com"},
+		// GitHub Enterprise Server instances keep their host, even when it starts with api.
+		{"https://api.example.com/api/v3/", "api.example.com"},
+		{"https://api.github.example.com/api/v3/", "api.github.example.com"},
+		{"https://api.acme.eu.ghe.com/", "api.acme.eu.ghe.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			cfg := &GitHubConfig{BaseURL: tt.baseURL}
+			assert.Equal(t, tt.expected, cfg.Host())
+		})
+	}
+}
+
+func TestGitHubConfig_RegistryHost(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"", "ghcr.io"},
+		{"https://api.github.com/", "ghcr.io"},
+		{"https://github.example.com/api/v3/", "containers.github.example.com"},
+		{"https://api.acme.ghe.com/", "containers.acme.ghe.com"},
+		{"https://api.example.com/api/v3/", "containers.api.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			cfg := &GitHubConfig{BaseURL: tt.baseURL}
+			assert.Equal(t, tt.expected, cfg.RegistryHost())
+		})
+	}
+}
+
+func TestLoadConfig_MultipleApps(t *testing.T) {
+	t.Setenv("GITHUB_INSTALLATION_ID", "")
+	t.Setenv("GITHUB_APP_ID", "")
+	t.Setenv("GITHUB_PRIVATE_KEY_PATH", "")
+	t.Setenv("GITHUB_ORGANIZATION", "")
+
+	configContent := `
+github:
+  appId: 111
+  privateKeyPath: "/keys/org-a.pem"
+  organization: "org-a"
+  baseUrl: "https://github.example.com/api/v3/"
+  apps:
+    - appId: 222
+      installationId: 2000
+      privateKeyPath: "/keys/org-b.pem"
+      organization: "org-b"
+      permissions:
+        contents: write
+    - appId: 333
+      privateKeySecretRef:
+        namespace: "flux-extension-system"
+        name: "org-c-github-app"
+        key: "private-key"
+      organization: "org-c"
+  permissions:
+    contents: read
+    metadata: read
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	appConfigs := cfg.GitHub.AppConfigs()
+	require.Len(t, appConfigs, 3)
+
+	assert.Equal(t, int64(111), appConfigs[0].AppID)
+	assert.Equal(t, "org-a", appConfigs[0].Organization)
+	assert.Empty(t, appConfigs[0].Apps)
+	assert.Equal(t, map[string]string{"contents": "read", "metadata": "read"}, appConfigs[0].Permissions)
+
+	assert.Equal(t, int64(222), appConfigs[1].AppID)
+	assert.Equal(t, int64(2000), appConfigs[1].InstallationID)
+	assert.Equal(t, "/keys/org-b.pem", appConfigs[1].PrivateKeyPath)
+	assert.Equal(t, "org-b", appConfigs[1].Organization)
+	assert.Equal(t, "https://github.example.com/api/v3/", appConfigs[1].BaseURL)
+	assert.Empty(t, appConfigs[1].Apps)
+	assert.Equal(t, map[string]string{"contents": "write"}, appConfigs[1].Permissions)
+
+	assert.Nil(t, appConfigs[1].PrivateKeySecretRef)
+
+	assert.Empty(t, appConfigs[2].PrivateKeyPath)
+	assert.Equal(t, &SecretKeyReference{Namespace: "flux-extension-system", Name: "org-c-github-app", Key: "private-key"},
+		appConfigs[2].PrivateKeySecretRef)
+
+	assert.Equal(t, []string{"org-a", "org-b", "org-c"}, cfg.GitHub.Organizations())
+}
+
+func TestGitHubConfig_AppConfigsWithoutTopLevelApp(t *testing.T) {
+	cfg := &GitHubConfig{
+		Apps: []GitHubAppConfig{
+			{AppID: 1, PrivateKeyPath: "/keys/a.pem", Organization: "org-a"},
+			{AppID: 2, PrivateKeyPath: "/keys/b.pem", Organization: "org-b"},
+		},
+	}
+
+	appConfigs := cfg.AppConfigs()
+	require.Len(t, appConfigs, 2)
+	assert.Equal(t, int64(1), appConfigs[0].AppID)
+	assert.Equal(t, int64(2), appConfigs[1].AppID)
+}
+
+func TestValidateGitHubApps(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         GitHubConfig
+		expectedErr string
+	}{
+		{
+			name: "apps only",
+			cfg: GitHubConfig{
+				Apps: []GitHubAppConfig{
+					{AppID: 1, PrivateKeyPath: "/keys/a.pem", Organization: "org-a"},
+					{AppID: 2, PrivateKeyPath: "/keys/b.pem", Organization: "org-b"},
+				},
+			},
+		},
+		{
+			name: "incomplete app entry",
+			cfg: GitHubConfig{
+				Apps: []GitHubAppConfig{
+					{AppID: 1, PrivateKeyPath: "/keys/a.pem", Organization: "org-a"},
+					{AppID: 2, Organization: "org-b"},
+				},
+			},
+			expectedErr: "github app 1: GitHub private key path is required",
+		},
+		{
+			name: "private key secret",
+			cfg: GitHubConfig{
+				AppID:               1,
+				PrivateKeySecretRef: &SecretKeyReference{Namespace: "ns", Name: "github-app", Key: "private-key"},
+				Organization:        "org-a",
+			},
+		},
+		{
+			name: "private key path and secret",
+			cfg: GitHubConfig{
+				AppID:               1,
+				PrivateKeyPath:      "/keys/a.pem",
+				PrivateKeySecretRef: &SecretKeyReference{Namespace: "ns", Name: "github-app", Key: "private-key"},
+				Organization:        "org-a",
+			},
+			expectedErr: "GitHub private key path, private key secret and remote signer are mutually exclusive",
+		},
+		{
+			name: "remote signer",
+			cfg: GitHubConfig{
+				AppID:        1,
+				RemoteSigner: &RemoteSignerConfig{URL: "https://signer.example.com/keys/github-app"},
+				Organization: "org-a",
+			},
+		},
+		{
+			name: "remote signer without URL",
+			cfg: GitHubConfig{
+				AppID:        1,
+				RemoteSigner: &RemoteSignerConfig{},
+				Organization: "org-a",
+			},
+			expectedErr: "GitHub remote signer requires an absolute http or https URL",
+		},
+		{
+			name: "incomplete private key secret",
+			cfg: GitHubConfig{
+				AppID:               1,
+				PrivateKeySecretRef: &SecretKeyReference{Name: "github-app", Key: "private-key"},
+				Organization:        "org-a",
+			},
+			expectedErr: "GitHub private key secret requires namespace, name and key",
+		},
+		{
+			name: "duplicate organization",
+			cfg: GitHubConfig{
+				AppID:          1,
+				PrivateKeyPath: "/keys/a.pem",
+				Organization:   "org-a",
+				Apps: []GitHubAppConfig{
+					{AppID: 2, PrivateKeyPath: "/keys/b.pem", Organization: "Org-A"},
+				},
+			},
+			expectedErr: "github app 1: GitHub organization Org-A is configured more than once",
+		},
+		{
+			name: "invalid permission access level",
+			cfg: GitHubConfig{
+				AppID:          1,
+				PrivateKeyPath: "/keys/a.pem",
+				Organization:   "org-a",
+				Permissions:    map[string]string{"contents": "readonly"},
+			},
+			expectedErr: `invalid access level "readonly" for permission contents`,
+		},
+		{
+			name: "invalid annotation permission access level",
+			cfg: GitHubConfig{
+				AppID:                 1,
+				PrivateKeyPath:        "/keys/a.pem",
+				Organization:          "org-a",
+				AnnotationPermissions: map[string]string{"contents": "all"},
+			},
+			expectedErr: `invalid access level "all" for permission contents`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGitHubApps(&tt.cfg)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+			}
+		})
+	}
+}
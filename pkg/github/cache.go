@@ -0,0 +1,355 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v76/github"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultTokenCacheMinValidity is how long a cached token must remain valid to be handed out
+// again. It is larger than the refresh buffer of the token refresh manager, so a refresh never
+// receives the token it is about to replace.
+const DefaultTokenCacheMinValidity = 10 * time.Minute
+
+// TokenCacheKey identifies installation tokens that grant the same access
+type TokenCacheKey struct {
+	InstallationID int64
+	Repositories   string
+	Permissions    string
+}
+
+// NewTokenCacheKey creates a cache key that does not depend on the order of repositories or permissions
+func NewTokenCacheKey(installationID int64, repositories []string, permissions map[string]string) TokenCacheKey {
+	repos := make([]string, 0, len(repositories))
+	for _, repo := range repositories {
+		repos = append(repos, strings.ToLower(repo))
+	}
+	sort.Strings(repos)
+
+	perms := make([]string, 0, len(permissions))
+	for name, level := range permissions {
+		perms = append(perms, fmt.Sprintf("%s=%s", name, level))
+	}
+	sort.Strings(perms)
+
+	return TokenCacheKey{
+		InstallationID: installationID,
+		Repositories:   strings.Join(repos, ","),
+		Permissions:    strings.Join(perms, ","),
+	}
+}
+
+// TokenCache keeps installation tokens in memory and shares them between all callers asking
+// for the same access, until they approach expiry. A nil cache does not cache.
+type TokenCache struct {
+	mu          sync.Mutex
+	tokens      map[TokenCacheKey]*github.InstallationToken
+	group       singleflight.Group
+	minValidity time.Duration
+	now         func() time.Time
+}
+
+// NewTokenCache creates a token cache handing out tokens valid for at least minValidity
+func NewTokenCache(minValidity time.Duration) *TokenCache {
+	return &TokenCache{
+		tokens:      make(map[TokenCacheKey]*github.InstallationToken),
+		minValidity: minValidity,
+		now:         time.Now,
+	}
+}
+
+// Get returns a cached token that remains valid for at least the minimum validity
+func (c *TokenCache) Get(key TokenCacheKey) (*github.InstallationToken, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, exists := c.tokens[key]
+	if !exists {
+		return nil, false
+	}
+
+	if !c.isUsable(token) {
+		delete(c.tokens, key)
+		return nil, false
+	}
+
+	return token, true
+}
+
+// Put stores a token and drops tokens that are no longer usable
+func (c *TokenCache) Put(key TokenCacheKey, token *github.InstallationToken) {
+	if c == nil || token == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for existingKey, existing := range c.tokens {
+		if !c.isUsable(existing) {
+			delete(c.tokens, existingKey)
+		}
+	}
+
+	c.tokens[key] = token
+}
+
+// Remove drops every cache entry holding the given token, e.g. because it was revoked
+func (c *TokenCache) Remove(token string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, cached := range c.tokens {
+		if cached.GetToken() == token {
+			delete(c.tokens, key)
+		}
+	}
+}
+
+// GetOrCreate returns a cached token or creates one. Concurrent callers asking for the same
+// key share a single call to create, see doShared.
+func (c *TokenCache) GetOrCreate(ctx context.Context, key TokenCacheKey,
+	create func(ctx context.Context) (*github.InstallationToken, error)) (*github.InstallationToken, error) {
+
+	if c == nil {
+		return create(ctx)
+	}
+
+	if token, ok := c.Get(key); ok {
+		tokenCacheHitsTotal.Inc()
+		return token, nil
+	}
+
+	result, err := doShared(ctx, &c.group, fmt.Sprintf("%+v", key), func(ctx context.Context) (interface{}, error) {
+		// Another caller may have stored a token while we were waiting
+		if token, ok := c.Get(key); ok {
+			tokenCacheHitsTotal.Inc()
+			return token, nil
+		}
+
+		token, err := create(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Put(key, token)
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*github.InstallationToken), nil
+}
+
+// sharedCreateTimeout bounds the work shared by concurrent callers of a cache
+const sharedCreateTimeout = 2 * time.Minute
+
+// doShared runs fn once for all concurrent callers of the same key and waits for its result until
+// ctx is done. fn runs detached from the cancellation of the caller starting it, bounded by
+// sharedCreateTimeout, so a cancelled caller doesn't fail the others waiting on the same call.
+func doShared(ctx context.Context, group *singleflight.Group, key string,
+	fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+
+	results := group.DoChan(key, func() (interface{}, error) {
+		sharedCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedCreateTimeout)
+		defer cancel()
+		return fn(sharedCtx)
+	})
+
+	select {
+	case result := <-results:
+		return result.Val, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// isUsable checks if a token remains valid for at least the minimum validity
+func (c *TokenCache) isUsable(token *github.InstallationToken) bool {
+	return token.GetExpiresAt().Sub(c.now()) >= c.minValidity
+}
+
+// jwtMinValidity is how long a cached JWT must remain valid to be sent again
+const jwtMinValidity = time.Minute
+
+// DefaultInstallationCacheTTL is how long the installation serving an owner is remembered
+const DefaultInstallationCacheTTL = time.Hour
+
+// cachedJWT is a signed JWT and the time it expires
+type cachedJWT struct {
+	token     string
+	expiresAt time.Time
+}
+
+// jwtCache keeps the JWT signed by each key of the GitHub App until it approaches expiry, so
+// requests don't need a signature each. A nil cache does not cache.
+type jwtCache struct {
+	mu     sync.Mutex
+	tokens map[Signer]cachedJWT
+	group  singleflight.Group
+	now    func() time.Time
+}
+
+func newJWTCache() *jwtCache {
+	return &jwtCache{
+		tokens: make(map[Signer]cachedJWT),
+		now:    time.Now,
+	}
+}
+
+// GetOrCreate returns the cached JWT of the signer or creates one valid for jwtLifetime.
+// Concurrent callers of the same key share a single call to create, see doShared, which runs
+// without holding the cache lock, so a slow remote signer only holds up the callers waiting for
+// its signature.
+func (c *jwtCache) GetOrCreate(ctx context.Context, signer Signer, create func(ctx context.Context) (string, error)) (string, error) {
+	if c == nil {
+		return create(ctx)
+	}
+
+	if token, ok := c.get(signer); ok {
+		return token, nil
+	}
+
+	result, err := doShared(ctx, &c.group, KeyFingerprint(signer), func(ctx context.Context) (interface{}, error) {
+		// Another caller may have stored a JWT while we were waiting
+		if token, ok := c.get(signer); ok {
+			return token, nil
+		}
+
+		signedAt := c.now()
+		token, err := create(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.put(signer, token, signedAt)
+		return token, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result.(string), nil
+}
+
+// get returns the cached JWT of the signer, unless it approaches expiry
+func (c *jwtCache) get(signer Signer) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, exists := c.tokens[signer]
+	if !exists || cached.expiresAt.Sub(c.now()) < jwtMinValidity {
+		return "", false
+	}
+
+	return cached.token, true
+}
+
+// put stores the JWT of the signer signed at signedAt
+func (c *jwtCache) put(signer Signer, token string, signedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Keys replaced by a rotation leave their JWT behind until it expires
+	now := c.now()
+	for key, cached := range c.tokens {
+		if !now.Before(cached.expiresAt) {
+			delete(c.tokens, key)
+		}
+	}
+	c.tokens[signer] = cachedJWT{token: token, expiresAt: signedAt.Add(jwtLifetime)}
+}
+
+// Remove drops the JWT of the signer, e.g. because GitHub rejected it
+func (c *jwtCache) Remove(signer Signer) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.tokens, signer)
+}
+
+// cachedInstallation is an installation and the time it is looked up again
+type cachedInstallation struct {
+	installation *github.Installation
+	expiresAt    time.Time
+}
+
+// installationCache remembers the installation of the GitHub App on each owner, so tokens can be
+// created without looking it up first. A nil cache does not cache.
+type installationCache struct {
+	mu            sync.Mutex
+	installations map[string]cachedInstallation
+	ttl           time.Duration
+	now           func() time.Time
+}
+
+func newInstallationCache(ttl time.Duration) *installationCache {
+	return &installationCache{
+		installations: make(map[string]cachedInstallation),
+		ttl:           ttl,
+		now:           time.Now,
+	}
+}
+
+// Get returns the installation on the owner, unless it was looked up longer than the TTL ago
+func (c *installationCache) Get(owner string) (*github.Installation, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, exists := c.installations[strings.ToLower(owner)]
+	if !exists || !c.now().Before(cached.expiresAt) {
+		return nil, false
+	}
+
+	return cached.installation, true
+}
+
+// Put stores the installation on the owner
+func (c *installationCache) Put(owner string, installation *github.Installation) {
+	if c == nil || installation == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.installations[strings.ToLower(owner)] = cachedInstallation{
+		installation: installation,
+		expiresAt:    c.now().Add(c.ttl),
+	}
+}
+
+// Remove drops the installation on the owner, e.g. because the App was uninstalled
+func (c *installationCache) Remove(owner string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.installations, strings.ToLower(owner))
+}
@@ -0,0 +1,299 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestToken(value string, expiresAt time.Time) *github.InstallationToken {
+	return &github.InstallationToken{
+		Token:     github.String(value),
+		ExpiresAt: &github.Timestamp{Time: expiresAt},
+	}
+}
+
+func TestNewTokenCacheKey(t *testing.T) {
+	a := NewTokenCacheKey(1, []string{"repo-b", "Repo-A"}, map[string]string{"contents": "read", "metadata": "read"})
+	b := NewTokenCacheKey(1, []string{"repo-a", "repo-b"}, map[string]string{"metadata": "read", "contents": "read"})
+	assert.Equal(t, a, b)
+
+	assert.NotEqual(t, a, NewTokenCacheKey(2, []string{"repo-a", "repo-b"}, map[string]string{"contents": "read", "metadata": "read"}))
+	assert.NotEqual(t, a, NewTokenCacheKey(1, []string{"repo-a"}, map[string]string{"contents": "read", "metadata": "read"}))
+	assert.NotEqual(t, a, NewTokenCacheKey(1, []string{"repo-a", "repo-b"}, map[string]string{"contents": "write", "metadata": "read"}))
+}
+
+func TestTokenCache_GetAndPut(t *testing.T) {
+	now := time.Now()
+	cache := NewTokenCache(10 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	key := NewTokenCacheKey(1, []string{"repo"}, nil)
+
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	cache.Put(key, newTestToken("fresh", now.Add(time.Hour)))
+	token, ok := cache.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, "fresh", token.GetToken())
+
+	// Tokens approaching expiry are no longer handed out
+	now = now.Add(51 * time.Minute)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+	assert.Empty(t, cache.tokens)
+}
+
+func TestTokenCache_PutDropsUnusableTokens(t *testing.T) {
+	now := time.Now()
+	cache := NewTokenCache(10 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	stale := NewTokenCacheKey(1, []string{"stale"}, nil)
+	cache.Put(stale, newTestToken("stale", now.Add(5*time.Minute)))
+
+	cache.Put(NewTokenCacheKey(1, []string{"fresh"}, nil), newTestToken("fresh", now.Add(time.Hour)))
+
+	_, exists := cache.tokens[stale]
+	assert.False(t, exists)
+	assert.Len(t, cache.tokens, 1)
+}
+
+func TestTokenCache_Remove(t *testing.T) {
+	cache := NewTokenCache(10 * time.Minute)
+	expiresAt := time.Now().Add(time.Hour)
+
+	cache.Put(NewTokenCacheKey(1, []string{"repo-a"}, nil), newTestToken("revoked", expiresAt))
+	cache.Put(NewTokenCacheKey(1, []string{"repo-b"}, nil), newTestToken("kept", expiresAt))
+
+	cache.Remove("revoked")
+
+	_, ok := cache.Get(NewTokenCacheKey(1, []string{"repo-a"}, nil))
+	assert.False(t, ok)
+	_, ok = cache.Get(NewTokenCacheKey(1, []string{"repo-b"}, nil))
+	assert.True(t, ok)
+}
+
+func TestTokenCache_GetOrCreate(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTokenCache(10 * time.Minute)
+	key := NewTokenCacheKey(1, []string{"repo"}, nil)
+
+	var calls int32
+	create := func(context.Context) (*github.InstallationToken, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return newTestToken("shared", time.Now().Add(time.Hour)), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cache.GetOrCreate(ctx, key, create)
+			assert.NoError(t, err)
+			assert.Equal(t, "shared", token.GetToken())
+		}()
+	}
+	wg.Wait()
+
+	_, err := cache.GetOrCreate(ctx, key, create)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestTokenCache_GetOrCreateError(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTokenCache(10 * time.Minute)
+	key := NewTokenCacheKey(1, []string{"repo"}, nil)
+
+	_, err := cache.GetOrCreate(ctx, key, func(context.Context) (*github.InstallationToken, error) {
+		return nil, assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+}
+
+func TestTokenCache_GetOrCreateCancelledCaller(t *testing.T) {
+	cache := NewTokenCache(10 * time.Minute)
+	key := NewTokenCacheKey(1, []string{"repo"}, nil)
+
+	// The first caller gives up while the token is being created
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var createErr error
+	var createHasDeadline bool
+	create := func(ctx context.Context) (*github.InstallationToken, error) {
+		close(started)
+		<-release
+		createErr = ctx.Err()
+		_, createHasDeadline = ctx.Deadline()
+		return newTestToken("shared", time.Now().Add(time.Hour)), nil
+	}
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := cache.GetOrCreate(cancelledCtx, key, create)
+		cancelled <- err
+	}()
+	<-started
+
+	waiting := make(chan *github.InstallationToken)
+	go func() {
+		token, err := cache.GetOrCreate(context.Background(), key, create)
+		assert.NoError(t, err)
+		waiting <- token
+	}()
+
+	cancel()
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+
+	// The creation is not cancelled with its first caller and serves the callers still waiting
+	close(release)
+	assert.Equal(t, "shared", (<-waiting).GetToken())
+	assert.NoError(t, createErr)
+	assert.True(t, createHasDeadline)
+
+	_, ok := cache.Get(key)
+	assert.True(t, ok)
+}
+
+func TestTokenCache_Nil(t *testing.T) {
+	ctx := context.Background()
+	var cache *TokenCache
+	key := NewTokenCacheKey(1, []string{"repo"}, nil)
+
+	cache.Put(key, newTestToken("token", time.Now().Add(time.Hour)))
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	token, err := cache.GetOrCreate(ctx, key, func(context.Context) (*github.InstallationToken, error) {
+		return newTestToken("created", time.Now().Add(time.Hour)), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "created", token.GetToken())
+}
+
+func TestJWTCache_GetOrCreate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := newJWTCache()
+	cache.now = func() time.Time { return now }
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var created int
+	create := func(context.Context) (string, error) {
+		created++
+		return fmt.Sprintf("jwt-%d", created), nil
+	}
+
+	token, err := cache.GetOrCreate(ctx, privateKey, create)
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-1", token)
+
+	// The JWT is reused until it approaches expiry
+	now = now.Add(8 * time.Minute)
+	token, err = cache.GetOrCreate(ctx, privateKey, create)
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-1", token)
+
+	now = now.Add(90 * time.Second)
+	token, err = cache.GetOrCreate(ctx, privateKey, create)
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-2", token)
+
+	// Rejected JWTs are replaced
+	cache.Remove(privateKey)
+	token, err = cache.GetOrCreate(ctx, privateKey, create)
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-3", token)
+
+	_, err = cache.GetOrCreate(ctx, privateKey, func(context.Context) (string, error) { return "", assert.AnError })
+	assert.NoError(t, err)
+}
+
+func TestJWTCache_GetOrCreateDoesNotBlockOtherSigners(t *testing.T) {
+	ctx := context.Background()
+	cache := newJWTCache()
+
+	slowKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// A hung signature of one key neither blocks other keys nor signs twice
+	release := make(chan struct{})
+	var slowCreated int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cache.GetOrCreate(ctx, slowKey, func(context.Context) (string, error) {
+				atomic.AddInt32(&slowCreated, 1)
+				<-release
+				return "slow-jwt", nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "slow-jwt", token)
+		}()
+	}
+
+	token, err := cache.GetOrCreate(ctx, otherKey, func(context.Context) (string, error) { return "other-jwt", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "other-jwt", token)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowCreated))
+
+	token, err = cache.GetOrCreate(ctx, slowKey, func(context.Context) (string, error) { return "", assert.AnError })
+	require.NoError(t, err)
+	assert.Equal(t, "slow-jwt", token)
+}
+
+func TestInstallationCache(t *testing.T) {
+	now := time.Now()
+	cache := newInstallationCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.Get("testorg")
+	assert.False(t, ok)
+
+	cache.Put("TestOrg", &github.Installation{ID: github.Ptr(int64(42))})
+	installation, ok := cache.Get("testorg")
+	require.True(t, ok)
+	assert.Equal(t, int64(42), installation.GetID())
+
+	// Installations are looked up again after the TTL
+	now = now.Add(time.Hour)
+	_, ok = cache.Get("testorg")
+	assert.False(t, ok)
+
+	cache.Put("testorg", &github.Installation{ID: github.Ptr(int64(43))})
+	cache.Remove("TESTORG")
+	_, ok = cache.Get("testorg")
+	assert.False(t, ok)
+
+	// A nil cache does not cache
+	var nilCache *installationCache
+	nilCache.Put("testorg", &github.Installation{ID: github.Ptr(int64(42))})
+	_, ok = nilCache.Get("testorg")
+	assert.False(t, ok)
+}
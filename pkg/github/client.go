@@ -2,183 +2,360 @@ package github
 
 import (
 	"context"
-	"crypto/rsa"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-github/v76/github"
 	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // Client wraps the GitHub client with App authentication
 type Client struct {
-	client     *github.Client
-	config     *config.GitHubConfig
-	privateKey *rsa.PrivateKey
+	client        *github.Client
+	config        *config.GitHubConfig
+	keys          *keyRing
+	jwts          *jwtCache
+	tokenCache    *TokenCache
+	installations *installationCache
+	rateLimits    *rateLimits
+
+	// transport sends requests to the GitHub API, bounded by timeout
+	transport http.RoundTripper
+	timeout   time.Duration
+
+	// signerTransport sends requests to the remote signer with the proxy and TLS settings of transport
+	signerTransport http.RoundTripper
+
+	// secrets reads and informers watch the Secret holding the private key, if one is configured
+	secrets   ctrlclient.Reader
+	informers cache.Informers
 }
 
-// NewClient creates a new GitHub client with App authentication
-func NewClient(cfg *config.GitHubConfig) (*Client, error) {
-	privateKey, err := loadPrivateKey(cfg.PrivateKeyPath)
+// NewClient creates a new GitHub client with App authentication. secrets and informers are
+// only used when the private key is read from a Secret and may be nil otherwise.
+func NewClient(cfg *config.GitHubConfig, secrets ctrlclient.Reader, informers cache.Informers) (*Client, error) {
+	transport, err := newTransport(cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.HTTP.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultHTTPTimeout
+	}
+
+	reserve := cfg.RateLimitReserve
+	if reserve <= 0 {
+		reserve = config.DefaultRateLimitReserve
+	}
+
+	c := &Client{
+		config:        cfg,
+		jwts:          newJWTCache(),
+		tokenCache:    NewTokenCache(DefaultTokenCacheMinValidity),
+		installations: newInstallationCache(DefaultInstallationCacheTTL),
+		rateLimits:    newRateLimits(cfg.Organization, reserve),
+		transport:     transport,
+		timeout:       timeout,
+		secrets:       secrets,
+		informers:     informers,
+	}
+
+	c.client, err = newGitHubClient(cfg, c.httpClient(transport))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.RemoteSigner != nil {
+		if c.signerTransport, err = newHTTPTransport(cfg.HTTP); err != nil {
+			return nil, err
+		}
+	}
+
+	signers, err := c.readSigners(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
+	c.keys = newKeyRing(signers...)
 
-	client := github.NewClient(nil)
+	c.setActiveKeyMetric(c.keys.Active())
+	log.Log.WithName("github").Info("Loaded private key", "organization", cfg.Organization,
+		"activeFingerprint", KeyFingerprint(c.keys.Active()))
 
-	return &Client{
-		client:     client,
-		config:     cfg,
-		privateKey: privateKey,
-	}, nil
+	return c, nil
 }
 
-// ValidateRepositoryURL checks if the repository URL belongs to the configured organization
+// ValidateRepositoryURL checks if the repository URL belongs to the configured organization.
+// OCI repositories must be served by the container registry of the GitHub host.
 func (c *Client) ValidateRepositoryURL(repoURL string) error {
-	parsedURL, err := url.Parse(repoURL)
+	ref, err := ParseRepositoryRef(repoURL)
 	if err != nil {
-		return fmt.Errorf("invalid repository URL: %w", err)
+		return err
 	}
 
-	if parsedURL.Host != "github.com" {
-		return fmt.Errorf("repository must be hosted on github.com")
+	host := c.config.Host()
+	if IsOCIRepositoryURL(repoURL) {
+		host = c.config.RegistryHost()
 	}
-
-	pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return fmt.Errorf("invalid repository path")
+	if ref.Host != host {
+		return fmt.Errorf("repository must be hosted on %s", host)
 	}
 
-	org := pathParts[0]
-	if org != c.config.Organization {
-		return fmt.Errorf("repository must belong to organization %s, got %s", c.config.Organization, org)
+	if !ref.HasOwner(c.config.Organization) {
+		return fmt.Errorf("repository must belong to organization %s, got %s", c.config.Organization, ref.Owner)
 	}
 
 	return nil
 }
 
-// GenerateInstallationToken creates an installation token for the repository
-func (c *Client) GenerateInstallationToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+// GenerateInstallationToken creates an installation token for the repository and the additional
+// repositories in opts. The token is limited to the permissions in opts, or to the permissions
+// configured for the GitHub App. With a deferrable context, a RateLimitedError is returned
+// while the remaining rate limit is low.
+func (c *Client) GenerateInstallationToken(ctx context.Context, repoURL string, opts TokenOptions) (*github.InstallationToken, error) {
+	token, _, err := c.installationToken(ctx, c.tokenCache, repoURL, opts)
+	return token, err
+}
+
+// installationToken creates an installation token like GenerateInstallationToken, reusing tokens
+// held by cache, and also returns the ID of the installation that issued it. A nil cache always
+// creates a new token.
+func (c *Client) installationToken(ctx context.Context, cache *TokenCache, repoURL string, opts TokenOptions) (*github.InstallationToken, int64, error) {
 	// Parse repository from URL
-	owner, repo, err := parseRepositoryURL(repoURL)
+	ref, err := ParseRepositoryRef(repoURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+		return nil, 0, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+	if IsOCIRepositoryURL(repoURL) {
+		return nil, 0, fmt.Errorf("%s is an OCI repository, which is pulled with a package token", repoURL)
 	}
 
-	// Create JWT for App authentication
-	token, err := c.createJWT()
+	repositories, err := tokenRepositories(ref.Owner, ref.Name, opts.Repositories)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create JWT: %w", err)
+		return nil, 0, err
 	}
 
-	// Create a new client with JWT authentication
-	jwtClient := github.NewClient(&http.Client{
-		Transport: &jwtTransport{
-			token: token,
-		},
-	})
+	permissions := opts.Permissions
+	if len(permissions) == 0 {
+		permissions = c.config.Permissions
+	} else if opts.Requested {
+		// Owners of Flux objects may narrow the access of their tokens, but not widen it
+		if err := limitPermissions(permissions, c.config.RequestablePermissions()); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return c.createInstallationToken(ctx, cache, ref.Owner, repositories, permissions,
+		func(jwtClient *github.Client) (*github.Installation, error) {
+			return c.findInstallation(ctx, ref.Owner, ref.Name, jwtClient)
+		})
+}
+
+// createInstallationToken creates an installation token of the installation on owner for the
+// repositories, or for every repository of the installation when repositories is empty, or reuses
+// one held by cache. find looks up the installation when it is neither configured nor cached.
+func (c *Client) createInstallationToken(ctx context.Context, cache *TokenCache, owner string, repositories []string, permissions map[string]string,
+	find func(jwtClient *github.Client) (*github.Installation, error)) (*github.InstallationToken, int64, error) {
+	var err error
+	var requestedPermissions *github.InstallationPermissions
+	if len(permissions) > 0 {
+		requestedPermissions, err = newInstallationPermissions(permissions)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := c.rateLimits.checkDeferrable(ctx, appRateLimitKey); err != nil {
+		return nil, 0, err
+	}
+
+	// Create a new client authenticated as the GitHub App
+	jwtClient, err := newGitHubClient(c.config, c.httpClient(&appTransport{
+		client: c,
+	}))
+	if err != nil {
+		return nil, 0, err
+	}
 
 	var installationID int64
+	var installation *github.Installation
 
 	// Use configured installation ID if provided, otherwise find it dynamically
 	if c.config.InstallationID != 0 {
 		installationID = c.config.InstallationID
 	} else {
-		// Find installation for the repository
-		installation, err := c.findInstallation(ctx, owner, repo, jwtClient)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find installation: %w", err)
+		// Find installation for the repository, which is remembered for its owner
+		var cached bool
+		installation, cached = c.installations.Get(owner)
+		if !cached {
+			installation, err = find(jwtClient)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to find installation: %w", err)
+			}
+			c.installations.Put(owner, installation)
 		}
 		installationID = installation.GetID()
 	}
 
-	// Create installation token
-	installationToken, _, err := jwtClient.Apps.CreateInstallationToken(
-		ctx,
-		installationID,
-		&github.InstallationTokenOptions{
-			Repositories: []string{repo},
-		},
-	)
+	// Reuse a cached token granting the same access, or create a new installation token
+	key := NewTokenCacheKey(installationID, repositories, permissions)
+	token, err := cache.GetOrCreate(ctx, key, func(ctx context.Context) (*github.InstallationToken, error) {
+		// Requested permissions must have been granted to the installation
+		if requestedPermissions != nil {
+			installation := installation
+			if installation == nil {
+				var resp *github.Response
+				var err error
+				installation, resp, err = jwtClient.Apps.GetInstallation(ctx, installationID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get installation: %w", err)
+				}
+				c.forgetRemovedInstallation(owner, resp)
+			}
+			if err := validatePermissions(permissions, installation.GetPermissions()); err != nil {
+				// The remembered installation may predate newly granted permissions
+				c.installations.Remove(owner)
+				return nil, err
+			}
+		}
+
+		installationToken, resp, err := jwtClient.Apps.CreateInstallationToken(
+			ctx,
+			installationID,
+			&github.InstallationTokenOptions{
+				Repositories: repositories,
+				Permissions:  requestedPermissions,
+			},
+		)
+		if err != nil {
+			c.forgetRemovedInstallation(owner, resp)
+			return nil, fmt.Errorf("failed to create installation token: %w", err)
+		}
+
+		installationTokensCreatedTotal.WithLabelValues(c.config.Organization).Inc()
+		return installationToken, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create installation token: %w", err)
+		return nil, 0, err
 	}
 
-	return installationToken, nil
+	return token, installationID, nil
 }
 
-// createJWT creates a JWT token for GitHub App authentication
-func (c *Client) createJWT() (string, error) {
-	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"iat": now.Unix(),
-		"exp": now.Add(10 * time.Minute).Unix(),
-		"iss": c.config.AppID,
-	})
-
-	tokenString, err := token.SignedString(c.privateKey)
+// RevokeInstallationToken revokes an installation token, so it can no longer be used, and drops
+// it from the token cache. Tokens that have already expired or were revoked are ignored.
+func (c *Client) RevokeInstallationToken(ctx context.Context, repoURL, token string) error {
+	// The revocation is authenticated with the token itself, sent as a bearer token like the JWT
+	tokenClient, err := newGitHubClient(c.config, c.httpClient(&jwtTransport{
+		token:     token,
+		transport: c.baseTransport(),
+	}))
 	if err != nil {
-		return "", fmt.Errorf("failed to sign JWT: %w", err)
+		return err
 	}
 
-	return tokenString, nil
-}
+	c.tokenCache.Remove(token)
 
-// findInstallation finds the GitHub App installation for the given repository
-func (c *Client) findInstallation(ctx context.Context, owner, repo string, client *github.Client) (*github.Installation, error) {
-	installation, _, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	resp, err := tokenClient.Apps.RevokeInstallationToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find repository installation: %w", err)
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return nil
+		}
+		return fmt.Errorf("failed to revoke installation token for %s: %w", repoURL, err)
 	}
 
-	return installation, nil
+	return nil
 }
 
-// parseRepositoryURL extracts owner and repository name from GitHub URL
-func parseRepositoryURL(repoURL string) (string, string, error) {
-	parsedURL, err := url.Parse(repoURL)
-	if err != nil {
-		return "", "", fmt.Errorf("invalid URL: %w", err)
+// newGitHubClient creates a GitHub API client for github.com or, when a base
+// URL is configured, for a GitHub Enterprise Server instance
+func newGitHubClient(cfg *config.GitHubConfig, httpClient *http.Client) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if cfg.BaseURL == "" {
+		return client, nil
 	}
 
-	pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return "", "", fmt.Errorf("invalid repository path")
+	uploadURL := cfg.UploadURL
+	if uploadURL == "" {
+		parsedURL, err := url.Parse(cfg.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub base URL: %w", err)
+		}
+		uploadURL = (&url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}).String()
 	}
 
-	owner := pathParts[0]
-	repo := strings.TrimSuffix(pathParts[1], ".git")
+	enterpriseClient, err := client.WithEnterpriseURLs(cfg.BaseURL, uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URLs: %w", err)
+	}
 
-	return owner, repo, nil
+	return enterpriseClient, nil
 }
 
-// loadPrivateKey loads the RSA private key from file
-func loadPrivateKey(keyPath string) (*rsa.PrivateKey, error) {
-	keyData, err := ioutil.ReadFile(keyPath)
+// jwtLifetime is how long the JWTs of the GitHub App are valid. GitHub accepts at most 10 minutes.
+const jwtLifetime = 10 * time.Minute
+
+// appJWT returns a JWT signed by signer, reusing the last one until it approaches expiry
+func (c *Client) appJWT(ctx context.Context, signer Signer) (string, error) {
+	return c.jwts.GetOrCreate(ctx, signer, func(ctx context.Context) (string, error) {
+		return c.createJWT(ctx, signer)
+	})
+}
+
+// createJWT creates a JWT token for GitHub App authentication signed by signer
+func (c *Client) createJWT(ctx context.Context, signer Signer) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(signingMethodRS256, jwt.MapClaims{
+		"iat": now.Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": c.config.AppID,
+	})
+
+	tokenString, err := token.SignedString(signingKey{ctx: ctx, signer: signer})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// forgetRemovedInstallation drops the remembered installation on the owner when GitHub no longer
+// knows it, e.g. because the App was uninstalled and installed again
+func (c *Client) forgetRemovedInstallation(owner string, resp *github.Response) {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		c.installations.Remove(owner)
 	}
+}
 
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+// findInstallation finds the GitHub App installation for the given repository
+func (c *Client) findInstallation(ctx context.Context, owner, repo string, client *github.Client) (*github.Installation, error) {
+	installation, _, err := client.Apps.FindRepositoryInstallation(ctx, owner, repo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to find repository installation: %w", err)
 	}
 
-	return key, nil
+	return installation, nil
 }
 
 // jwtTransport implements http.RoundTripper for JWT authentication
 type jwtTransport struct {
 	token string
+
+	// transport sends the requests, apiTransport if unset
+	transport http.RoundTripper
 }
 
 func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Authorization", "Bearer "+t.token)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	return http.DefaultTransport.RoundTrip(req)
+	if t.transport != nil {
+		return t.transport.RoundTrip(req)
+	}
+	return apiTransport.RoundTrip(req)
 }
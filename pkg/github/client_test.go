@@ -1,17 +1,22 @@
 package github
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,8 +32,8 @@ func TestValidateRepositoryURL(t *testing.T) {
 	}
 
 	client := &Client{
-		config:     cfg,
-		privateKey: privateKey,
+		config: cfg,
+		keys:   newKeyRing(privateKey),
 	}
 
 	tests := []struct {
@@ -51,7 +56,7 @@ func TestValidateRepositoryURL(t *testing.T) {
 			name:        "invalid URL",
 			repoURL:     "invalid-url",
 			expectError: true,
-			errorMsg:    "repository must be hosted on github.com",
+			errorMsg:    "expected a host",
 		},
 		{
 			name:        "non-github host",
@@ -59,6 +64,27 @@ func TestValidateRepositoryURL(t *testing.T) {
 			expectError: true,
 			errorMsg:    "repository must be hosted on github.com",
 		},
+		{
+			name:        "scp-style URL",
+			repoURL:     "git@github.com:testorg/test-repo.git",
+			expectError: false,
+		},
+		{
+			name:        "organization in other case",
+			repoURL:     "https://GitHub.com/TestOrg/test-repo",
+			expectError: false,
+		},
+		{
+			name:        "OCI repository",
+			repoURL:     "oci://ghcr.io/testorg/charts",
+			expectError: false,
+		},
+		{
+			name:        "OCI repository on another registry",
+			repoURL:     "oci://docker.io/testorg/charts",
+			expectError: true,
+			errorMsg:    "repository must be hosted on ghcr.io",
+		},
 		{
 			name:        "wrong organization",
 			repoURL:     "https://github.com/other-org/test-repo",
@@ -86,54 +112,6 @@ func TestValidateRepositoryURL(t *testing.T) {
 	}
 }
 
-func TestParseRepositoryURL(t *testing.T) {
-	tests := []struct {
-		name          string
-		repoURL       string
-		expectedOwner string
-		expectedRepo  string
-		expectError   bool
-	}{
-		{
-			name:          "standard GitHub URL",
-			repoURL:       "https://github.com/testorg/test-repo",
-			expectedOwner: "testorg",
-			expectedRepo:  "test-repo",
-			expectError:   false,
-		},
-		{
-			name:          "GitHub URL with .git suffix",
-			repoURL:       "https://github.com/testorg/test-repo.git",
-			expectedOwner: "testorg",
-			expectedRepo:  "test-repo",
-			expectError:   false,
-		},
-		{
-			name:        "invalid URL",
-			repoURL:     "invalid-url",
-			expectError: true,
-		},
-		{
-			name:        "incomplete path",
-			repoURL:     "https://github.com/testorg",
-			expectError: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			owner, repo, err := parseRepositoryURL(tt.repoURL)
-			if tt.expectError {
-				assert.Error(t, err)
-			} else {
-				require.NoError(t, err)
-				assert.Equal(t, tt.expectedOwner, owner)
-				assert.Equal(t, tt.expectedRepo, repo)
-			}
-		})
-	}
-}
-
 func TestCreateJWT(t *testing.T) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	require.NoError(t, err)
@@ -143,11 +121,11 @@ func TestCreateJWT(t *testing.T) {
 	}
 
 	client := &Client{
-		config:     cfg,
-		privateKey: privateKey,
+		config: cfg,
+		keys:   newKeyRing(privateKey),
 	}
 
-	token, err := client.createJWT()
+	token, err := client.createJWT(context.Background(), privateKey)
 	require.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -176,8 +154,8 @@ func TestGenerateInstallationToken_Validation(t *testing.T) {
 	}
 
 	client := &Client{
-		config:     cfg,
-		privateKey: privateKey,
+		config: cfg,
+		keys:   newKeyRing(privateKey),
 	}
 
 	// Test validation of repository URL before token generation
@@ -211,15 +189,17 @@ func TestLoadPrivateKey(t *testing.T) {
 	tmpFile.Close()
 
 	// Test loading the key
-	loadedKey, err := loadPrivateKey(tmpFile.Name())
+	loadedKeys, err := loadPrivateKeys(tmpFile.Name())
 	require.NoError(t, err)
+	require.Len(t, loadedKeys, 1)
+	loadedKey := loadedKeys[0]
 	assert.Equal(t, privateKey.N, loadedKey.N)
 	assert.Equal(t, privateKey.E, loadedKey.E)
 }
 
 func TestLoadPrivateKey_Errors(t *testing.T) {
 	// Test non-existent file
-	_, err := loadPrivateKey("/nonexistent/key.pem")
+	_, err := loadPrivateKeys("/nonexistent/key.pem")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to read private key file")
 
@@ -232,7 +212,7 @@ func TestLoadPrivateKey_Errors(t *testing.T) {
 	require.NoError(t, err)
 	tmpFile.Close()
 
-	_, err = loadPrivateKey(tmpFile.Name())
+	_, err = loadPrivateKeys(tmpFile.Name())
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to parse private key")
 }
@@ -269,8 +249,8 @@ func TestInstallationIDConfiguration(t *testing.T) {
 	require.NoError(t, err)
 
 	client := &Client{
-		config:     cfg,
-		privateKey: privateKey,
+		config: cfg,
+		keys:   newKeyRing(privateKey),
 	}
 
 	// Verify the client has the correct configuration
@@ -291,11 +271,416 @@ func TestInstallationIDDefaultsToZero(t *testing.T) {
 	require.NoError(t, err)
 
 	client := &Client{
-		config:     cfg,
-		privateKey: privateKey,
+		config: cfg,
+		keys:   newKeyRing(privateKey),
 	}
 
 	// Verify the installation ID is 0 (not configured)
 	assert.Equal(t, int64(0), client.config.InstallationID)
 	assert.Equal(t, int64(123456), client.config.AppID)
 }
+
+func TestValidateRepositoryURL_Enterprise(t *testing.T) {
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "testorg",
+		BaseURL:      "https://github.example.com/api/v3/",
+	}
+
+	client := &Client{
+		config: cfg,
+	}
+
+	assert.NoError(t, client.ValidateRepositoryURL("https://github.example.com/testorg/test-repo"))
+	assert.NoError(t, client.ValidateRepositoryURL("https://GitHub.Example.com/testorg/test-repo.git"))
+
+	err := client.ValidateRepositoryURL("https://github.com/testorg/test-repo")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "repository must be hosted on github.example.com")
+
+	assert.NoError(t, client.ValidateRepositoryURL("oci://containers.github.example.com/testorg/charts"))
+	assert.ErrorContains(t, client.ValidateRepositoryURL("oci://ghcr.io/testorg/charts"),
+		"repository must be hosted on containers.github.example.com")
+}
+
+func TestNewGitHubClient_EnterpriseURLs(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               *config.GitHubConfig
+		expectedBaseURL   string
+		expectedUploadURL string
+	}{
+		{
+			name:              "github.com",
+			cfg:               &config.GitHubConfig{},
+			expectedBaseURL:   "https://api.github.com/",
+			expectedUploadURL: "https://uploads.github.com/",
+		},
+		{
+			name:              "enterprise server with derived upload URL",
+			cfg:               &config.GitHubConfig{BaseURL: "https://github.example.com"},
+			expectedBaseURL:   "https://github.example.com/api/v3/",
+			expectedUploadURL: "https://github.example.com/api/uploads/",
+		},
+		{
+			name: "enterprise server with explicit upload URL",
+			cfg: &config.GitHubConfig{
+				BaseURL:   "https://github.example.com/api/v3/",
+				UploadURL: "https://uploads.example.com/api/uploads/",
+			},
+			expectedBaseURL:   "https://github.example.com/api/v3/",
+			expectedUploadURL: "https://uploads.example.com/api/uploads/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newGitHubClient(tt.cfg, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBaseURL, client.BaseURL.String())
+			assert.Equal(t, tt.expectedUploadURL, client.UploadURL.String())
+		})
+	}
+}
+
+func TestGenerateInstallationToken_Enterprise(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	// Local stand-in for the GitHub Enterprise Server REST API
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/testorg/test-repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 42})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []interface{}{"test-repo"}, body["repositories"])
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_enterprise",
+			"expires_at": expiresAt.Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "testorg",
+		BaseURL:      server.URL + "/api/v3/",
+	}
+
+	client := &Client{
+		config: cfg,
+		keys:   newKeyRing(privateKey),
+	}
+
+	repoURL := "http://" + cfg.Host() + "/testorg/test-repo"
+	require.NoError(t, client.ValidateRepositoryURL(repoURL))
+
+	token, err := client.GenerateInstallationToken(context.Background(), repoURL, TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_enterprise", token.GetToken())
+	assert.True(t, expiresAt.Equal(token.GetExpiresAt().Time))
+}
+
+func TestGenerateInstallationToken_ReusesCachedToken(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var tokenRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_cached",
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:          123456,
+			InstallationID: 42,
+			Organization:   "testorg",
+			BaseURL:        server.URL + "/api/v3/",
+		},
+		keys:       newKeyRing(privateKey),
+		tokenCache: NewTokenCache(DefaultTokenCacheMinValidity),
+	}
+
+	createdBefore := testutil.ToFloat64(installationTokensCreatedTotal.WithLabelValues("testorg"))
+	cacheHitsBefore := testutil.ToFloat64(tokenCacheHitsTotal)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		token, err := client.GenerateInstallationToken(ctx, "https://github.com/testorg/test-repo", TokenOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "ghs_cached", token.GetToken())
+	}
+
+	// A different repository set needs its own token
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/other-repo", TokenOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, tokenRequests)
+	assert.Equal(t, createdBefore+2, testutil.ToFloat64(installationTokensCreatedTotal.WithLabelValues("testorg")))
+	assert.Equal(t, cacheHitsBefore+2, testutil.ToFloat64(tokenCacheHitsTotal))
+
+	// Every request to the API was timed
+	assert.Positive(t, testutil.CollectAndCount(apiRequestDuration))
+}
+
+func TestGenerateInstallationToken_CachesInstallationAndJWT(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var lookups, tokenRequests int
+	var uninstalled bool
+	authorizations := map[string]bool{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/testorg/{repo}/installation", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		authorizations[r.Header.Get("Authorization")] = true
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 42})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		authorizations[r.Header.Get("Authorization")] = true
+		if uninstalled {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_token",
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:        123456,
+			Organization: "testorg",
+			BaseURL:      server.URL + "/api/v3/",
+		},
+		keys:          newKeyRing(privateKey),
+		jwts:          newJWTCache(),
+		installations: newInstallationCache(DefaultInstallationCacheTTL),
+	}
+
+	// Every token after the first takes a single request, authenticated with the same JWT
+	ctx := context.Background()
+	for _, repo := range []string{"repo-a", "repo-b", "repo-c"} {
+		_, err := client.GenerateInstallationToken(ctx, "https://github.com/testorg/"+repo, TokenOptions{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, lookups)
+	assert.Equal(t, 3, tokenRequests)
+	assert.Len(t, authorizations, 1)
+
+	// An installation GitHub no longer knows is looked up again
+	uninstalled = true
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/repo-a", TokenOptions{})
+	require.Error(t, err)
+
+	uninstalled = false
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/repo-a", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestRevokeInstallationToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectError bool
+	}{
+		{name: "revoked", status: http.StatusNoContent},
+		{name: "already expired", status: http.StatusUnauthorized},
+		{name: "server error", status: http.StatusInternalServerError, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var revoked []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("DELETE /api/v3/installation/token", func(w http.ResponseWriter, r *http.Request) {
+				revoked = append(revoked, r.Header.Get("Authorization"))
+				w.WriteHeader(tt.status)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			expiresAt := time.Now().Add(time.Hour)
+			client := &Client{
+				config: &config.GitHubConfig{
+					AppID:        123456,
+					Organization: "testorg",
+					BaseURL:      server.URL + "/api/v3/",
+				},
+				tokenCache: NewTokenCache(DefaultTokenCacheMinValidity),
+			}
+			key := NewTokenCacheKey(42, []string{"test-repo"}, nil)
+			client.tokenCache.Put(key, newTestToken("ghs_revoke", expiresAt))
+
+			err := client.RevokeInstallationToken(context.Background(), "https://github.com/testorg/test-repo", "ghs_revoke")
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// The revocation is authenticated with the token itself
+			require.NotEmpty(t, revoked)
+			assert.Equal(t, "Bearer ghs_revoke", revoked[0])
+
+			// A revoked token is never handed out again
+			_, ok := client.tokenCache.Get(key)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestGenerateInstallationToken_Permissions(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var requestedPermissions []interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/app/installations/42", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          42,
+			"permissions": map[string]string{"contents": "write", "metadata": "read"},
+		})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requestedPermissions = append(requestedPermissions, body["permissions"])
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":       "ghs_scoped",
+			"expires_at":  time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"permissions": body["permissions"],
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:          123456,
+			InstallationID: 42,
+			Organization:   "testorg",
+			BaseURL:        server.URL + "/api/v3/",
+			Permissions:    map[string]string{"contents": "read"},
+		},
+		keys: newKeyRing(privateKey),
+	}
+
+	ctx := context.Background()
+	repoURL := "https://github.com/testorg/test-repo"
+
+	// The permissions configured for the App apply by default
+	token, err := client.GenerateInstallationToken(ctx, repoURL, TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"contents": "read"}, PermissionsMap(token.GetPermissions()))
+
+	// Requested permissions replace the default
+	_, err = client.GenerateInstallationToken(ctx, repoURL, TokenOptions{
+		Permissions: map[string]string{"contents": "write", "metadata": "read"},
+	})
+	require.NoError(t, err)
+
+	// Permissions beyond those granted to the installation are refused without requesting a token
+	_, err = client.GenerateInstallationToken(ctx, repoURL, TokenOptions{
+		Permissions: map[string]string{"administration": "write"},
+	})
+	assert.ErrorContains(t, err, "administration:write is not granted to the installation")
+
+	// Permissions requested by the owner of a Flux object can't exceed the configured permissions,
+	// even when the installation grants them
+	_, err = client.GenerateInstallationToken(ctx, repoURL, TokenOptions{
+		Permissions: map[string]string{"contents": "write"},
+		Requested:   true,
+	})
+	assert.ErrorContains(t, err, "contents:write exceeds the requestable contents:read")
+
+	client.config.AnnotationPermissions = map[string]string{"contents": "write"}
+	_, err = client.GenerateInstallationToken(ctx, repoURL, TokenOptions{
+		Permissions: map[string]string{"contents": "write", "metadata": "read"},
+		Requested:   true,
+	})
+	assert.ErrorContains(t, err, "metadata:read may not be requested")
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"contents": "read"},
+		map[string]interface{}{"contents": "write", "metadata": "read"},
+	}, requestedPermissions)
+}
+
+func TestGenerateInstallationToken_MultipleRepositories(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var requestedRepositories []interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requestedRepositories = append(requestedRepositories, body["repositories"])
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_bundle",
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:          123456,
+			InstallationID: 42,
+			Organization:   "testorg",
+			BaseURL:        server.URL + "/api/v3/",
+		},
+		keys:       newKeyRing(privateKey),
+		tokenCache: NewTokenCache(DefaultTokenCacheMinValidity),
+	}
+
+	ctx := context.Background()
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/test-repo", TokenOptions{
+		Repositories: []string{"infra", "testorg/charts"},
+	})
+	require.NoError(t, err)
+
+	// Any repository of the set asking for the same set shares the token
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/charts", TokenOptions{
+		Repositories: []string{"test-repo", "infra"},
+	})
+	require.NoError(t, err)
+
+	// Repositories of another owner are served by another installation
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/test-repo", TokenOptions{
+		Repositories: []string{"otherorg/charts"},
+	})
+	assert.ErrorContains(t, err, "a token covers repositories of a single owner")
+
+	assert.Equal(t, []interface{}{
+		[]interface{}{"charts", "infra", "test-repo"},
+	}, requestedRepositories)
+}
@@ -0,0 +1,169 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NoMatchingAppError is returned when no configured GitHub App serves the repository owner on its host
+type NoMatchingAppError struct {
+	Host          string
+	Owner         string
+	Organizations []string
+}
+
+func (e *NoMatchingAppError) Error() string {
+	return fmt.Sprintf("no GitHub App configured for owner %s on %s (configured organizations: %s)",
+		e.Owner, e.Host, strings.Join(e.Organizations, ", "))
+}
+
+// ClientSet routes requests to the Client of the GitHub App configured for the repository host and
+// owner. The credentials of an App are never sent to another host.
+type ClientSet struct {
+	clients       map[string]GitHubClient
+	organizations []string
+}
+
+// NewClientSet creates one GitHub client per configured GitHub App. Private keys stored in Secrets
+// are read with secrets and watched through informers.
+func NewClientSet(cfg *config.GitHubConfig, secrets ctrlclient.Reader, informers cache.Informers) (*ClientSet, error) {
+	clientSet := &ClientSet{
+		clients: make(map[string]GitHubClient),
+	}
+
+	for _, appConfig := range cfg.AppConfigs() {
+		appConfig := appConfig
+		client, err := NewClient(&appConfig, secrets, informers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for organization %s: %w", appConfig.Organization, err)
+		}
+		clientSet.add(appConfig.Organization, []string{appConfig.Host(), appConfig.RegistryHost()}, client)
+	}
+
+	return clientSet, nil
+}
+
+// add registers the client serving the given organization on hosts, e.g. the GitHub host and its
+// container registry
+func (s *ClientSet) add(organization string, hosts []string, client GitHubClient) {
+	for _, host := range hosts {
+		s.clients[clientKey(host, organization)] = client
+	}
+	s.organizations = append(s.organizations, organization)
+}
+
+// clientKey identifies the client serving owner on host. Hosts and owners are case-insensitive.
+func clientKey(host, owner string) string {
+	return strings.ToLower(host) + "/" + strings.ToLower(owner)
+}
+
+// ClientFor returns the client of the GitHub App configured for the repository host and owner
+func (s *ClientSet) ClientFor(repoURL string) (GitHubClient, error) {
+	ref, err := ParseRepositoryRef(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	client, exists := s.clients[clientKey(ref.Host, ref.Owner)]
+	if !exists {
+		return nil, &NoMatchingAppError{Host: ref.Host, Owner: ref.Owner, Organizations: s.organizations}
+	}
+
+	return client, nil
+}
+
+// ValidateRepositoryURL validates the repository URL with the client serving its owner
+func (s *ClientSet) ValidateRepositoryURL(repoURL string) error {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return err
+	}
+
+	return client.ValidateRepositoryURL(repoURL)
+}
+
+// GenerateInstallationToken creates an installation token with the client serving the repository owner
+func (s *ClientSet) GenerateInstallationToken(ctx context.Context, repoURL string, opts TokenOptions) (*github.InstallationToken, error) {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GenerateInstallationToken(ctx, repoURL, opts)
+}
+
+// GeneratePackageToken creates a package token with the client serving the repository owner
+func (s *ClientSet) GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GeneratePackageToken(ctx, repoURL)
+}
+
+// RevokeInstallationToken revokes the token with the client serving the repository owner
+func (s *ClientSet) RevokeInstallationToken(ctx context.Context, repoURL, token string) error {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return err
+	}
+
+	return client.RevokeInstallationToken(ctx, repoURL, token)
+}
+
+// RegisterDeployKey registers the deploy key with the client serving the repository owner
+func (s *ClientSet) RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error) {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return 0, err
+	}
+
+	return client.RegisterDeployKey(ctx, repoURL, title, publicKey)
+}
+
+// DeleteDeployKey deletes the deploy key with the client serving the repository owner
+func (s *ClientSet) DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return err
+	}
+
+	return client.DeleteDeployKey(ctx, repoURL, keyID)
+}
+
+// KnownHosts returns the SSH host keys of the GitHub host with the client serving the repository owner
+func (s *ClientSet) KnownHosts(ctx context.Context, repoURL string) ([]string, error) {
+	client, err := s.ClientFor(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.KnownHosts(ctx, repoURL)
+}
+
+// Start watches the private key files of the GitHub Apps until ctx is done
+func (s *ClientSet) Start(ctx context.Context) error {
+	group, ctx := errgroup.WithContext(ctx)
+	for _, client := range s.clients {
+		if client, ok := client.(*Client); ok {
+			group.Go(func() error {
+				return client.WatchPrivateKey(ctx)
+			})
+		}
+	}
+
+	return group.Wait()
+}
+
+// NeedLeaderElection reports that every replica reloads private keys, not only the leader
+func (s *ClientSet) NeedLeaderElection() bool {
+	return false
+}
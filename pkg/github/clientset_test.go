@@ -0,0 +1,142 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+)
+
+// stubClient returns a fixed token and records the repositories it was asked about
+type stubClient struct {
+	token     string
+	requested []string
+}
+
+func (s *stubClient) ValidateRepositoryURL(repoURL string) error {
+	s.requested = append(s.requested, repoURL)
+	return nil
+}
+
+func (s *stubClient) GenerateInstallationToken(ctx context.Context, repoURL string, opts TokenOptions) (*github.InstallationToken, error) {
+	s.requested = append(s.requested, repoURL)
+	return &github.InstallationToken{Token: github.String(s.token)}, nil
+}
+
+func (s *stubClient) GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+	s.requested = append(s.requested, repoURL)
+	return &github.InstallationToken{Token: github.String(s.token)}, nil
+}
+
+func (s *stubClient) RevokeInstallationToken(ctx context.Context, repoURL, token string) error {
+	s.requested = append(s.requested, repoURL)
+	return nil
+}
+
+func (s *stubClient) RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error) {
+	s.requested = append(s.requested, repoURL)
+	return 1, nil
+}
+
+func (s *stubClient) DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error {
+	s.requested = append(s.requested, repoURL)
+	return nil
+}
+
+func (s *stubClient) KnownHosts(ctx context.Context, repoURL string) ([]string, error) {
+	return []string{"github.com ssh-ed25519 AAAA"}, nil
+}
+
+func TestClientSet_RoutesByOwner(t *testing.T) {
+	orgA := &stubClient{token: "token-a"}
+	orgB := &stubClient{token: "token-b"}
+
+	clientSet := &ClientSet{clients: make(map[string]GitHubClient)}
+	clientSet.add("org-a", []string{"github.com", "ghcr.io"}, orgA)
+	clientSet.add("Org-B", []string{"github.com", "ghcr.io"}, orgB)
+
+	ctx := context.Background()
+
+	token, err := clientSet.GenerateInstallationToken(ctx, "https://github.com/org-a/repo", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-a", token.GetToken())
+
+	token, err = clientSet.GenerateInstallationToken(ctx, "https://github.com/org-b/repo", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-b", token.GetToken())
+
+	require.NoError(t, clientSet.ValidateRepositoryURL("https://github.com/org-a/other"))
+
+	// Packages are pulled with the App serving the owner on the GitHub host of the registry
+	token, err = clientSet.GeneratePackageToken(ctx, "oci://ghcr.io/org-b/charts")
+	require.NoError(t, err)
+	assert.Equal(t, "token-b", token.GetToken())
+
+	assert.Equal(t, []string{"https://github.com/org-a/repo", "https://github.com/org-a/other"}, orgA.requested)
+	assert.Equal(t, []string{"https://github.com/org-b/repo", "oci://ghcr.io/org-b/charts"}, orgB.requested)
+}
+
+func TestClientSet_RoutesByHost(t *testing.T) {
+	cloud := &stubClient{token: "token-cloud"}
+	enterprise := &stubClient{token: "token-enterprise"}
+
+	clientSet := &ClientSet{clients: make(map[string]GitHubClient)}
+	clientSet.add("acme", []string{"github.com"}, cloud)
+	clientSet.add("acme", []string{"github.example.com"}, enterprise)
+
+	ctx := context.Background()
+
+	// The same organization on two hosts is served by the App of each host
+	token, err := clientSet.GenerateInstallationToken(ctx, "https://github.com/acme/repo", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-cloud", token.GetToken())
+
+	token, err = clientSet.GenerateInstallationToken(ctx, "https://GitHub.Example.com/acme/repo", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-enterprise", token.GetToken())
+
+	// Repositories on other hosts never reach an App
+	var noMatch *NoMatchingAppError
+	_, err = clientSet.GenerateInstallationToken(ctx, "https://git.example.org/acme/repo", TokenOptions{})
+	require.ErrorAs(t, err, &noMatch)
+	assert.Equal(t, "git.example.org", noMatch.Host)
+
+	assert.Len(t, cloud.requested, 1)
+	assert.Len(t, enterprise.requested, 1)
+}
+
+func TestClientSet_NoMatchingApp(t *testing.T) {
+	clientSet := &ClientSet{clients: make(map[string]GitHubClient)}
+	clientSet.add("org-a", []string{"github.com"}, &stubClient{})
+	clientSet.add("org-b", []string{"github.com"}, &stubClient{})
+
+	err := clientSet.ValidateRepositoryURL("https://github.com/org-c/repo")
+	require.Error(t, err)
+
+	var noMatch *NoMatchingAppError
+	require.ErrorAs(t, err, &noMatch)
+	assert.Equal(t, "org-c", noMatch.Owner)
+	assert.Equal(t, "no GitHub App configured for owner org-c on github.com (configured organizations: org-a, org-b)", err.Error())
+
+	_, err = clientSet.GenerateInstallationToken(context.Background(), "https://github.com/org-c/repo", TokenOptions{})
+	assert.ErrorAs(t, err, &noMatch)
+
+	_, err = clientSet.ClientFor("https://github.com/org-a")
+	assert.Error(t, err)
+}
+
+func TestNewClientSet_MissingPrivateKey(t *testing.T) {
+	cfg := &config.GitHubConfig{
+		Apps: []config.GitHubAppConfig{
+			{AppID: 1, PrivateKeyPath: "/nonexistent/key.pem", Organization: "org-a"},
+		},
+	}
+
+	_, err := NewClientSet(cfg, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create client for organization org-a")
+}
@@ -0,0 +1,138 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v76/github"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// deployKeyPermissions are the permissions of the installation tokens managing deploy keys
+var deployKeyPermissions = map[string]string{"administration": "write"}
+
+// RegisterDeployKey registers a public key in authorized_keys format as a read-only deploy key
+// of the repository and returns its ID
+func (c *Client) RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error) {
+	ref, err := ParseRepositoryRef(repoURL)
+	if err != nil {
+		return 0, err
+	}
+
+	tokenClient, revoke, err := c.deployKeyClient(ctx, repoURL)
+	if err != nil {
+		return 0, err
+	}
+	defer revoke()
+
+	key, _, err := tokenClient.Repositories.CreateKey(ctx, ref.Owner, ref.Name, &github.Key{
+		Title:    github.Ptr(title),
+		Key:      github.Ptr(publicKey),
+		ReadOnly: github.Ptr(true),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to register deploy key for %s: %w", repoURL, err)
+	}
+
+	return key.GetID(), nil
+}
+
+// DeleteDeployKey removes a deploy key from the repository. Keys that are already gone are ignored.
+func (c *Client) DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error {
+	ref, err := ParseRepositoryRef(repoURL)
+	if err != nil {
+		return err
+	}
+
+	tokenClient, revoke, err := c.deployKeyClient(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+	defer revoke()
+
+	resp, err := tokenClient.Repositories.DeleteKey(ctx, ref.Owner, ref.Name, keyID)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete deploy key %d of %s: %w", keyID, repoURL, err)
+	}
+
+	return nil
+}
+
+// KnownHosts returns the SSH host keys of the GitHub host in known_hosts format, for the port the
+// repository is cloned from
+func (c *Client) KnownHosts(ctx context.Context, repoURL string) ([]string, error) {
+	ref, err := ParseRepositoryRef(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	metaClient, err := newGitHubClient(c.config, c.httpClient(c.baseTransport()))
+	if err != nil {
+		return nil, err
+	}
+
+	meta, _, err := metaClient.Meta.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSH host keys: %w", err)
+	}
+
+	host := c.config.Host()
+	pattern := knownHostsPattern(host, ref.Port)
+	knownHosts := make([]string, 0, len(meta.SSHKeys))
+	for _, key := range meta.SSHKeys {
+		knownHosts = append(knownHosts, pattern+" "+key)
+	}
+
+	if len(knownHosts) == 0 {
+		return nil, fmt.Errorf("no SSH host keys published for %s", host)
+	}
+
+	return knownHosts, nil
+}
+
+// knownHostsPattern returns the host pattern of known_hosts entries. SSH looks up hosts served on
+// a port other than 22 as [host]:port.
+func knownHostsPattern(host, port string) string {
+	if port == "" || port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+// deployKeyClient creates a client authenticated with an installation token allowed to manage
+// the deploy keys of the repository. The token can administer the repository, so it is not
+// cached: call revoke once the client is done.
+func (c *Client) deployKeyClient(ctx context.Context, repoURL string) (*github.Client, func(), error) {
+	token, installationID, err := c.installationToken(ctx, nil, repoURL, TokenOptions{Permissions: deployKeyPermissions})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revoke := func() {
+		// Revoke even when the request was cancelled, the token would otherwise stay valid for an hour
+		if err := c.RevokeInstallationToken(context.WithoutCancel(ctx), repoURL, token.GetToken()); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to revoke deploy key management token", "repository", repoURL)
+		}
+	}
+
+	rateLimitKey := installationRateLimitKey(installationID)
+	if err := c.rateLimits.checkDeferrable(ctx, rateLimitKey); err != nil {
+		revoke()
+		return nil, nil, err
+	}
+
+	tokenClient, err := newGitHubClient(c.config, c.httpClient(&jwtTransport{
+		token:     token.GetToken(),
+		transport: c.rateLimits.transport(rateLimitKey, c.baseTransport()),
+	}))
+	if err != nil {
+		revoke()
+		return nil, nil, err
+	}
+
+	return tokenClient, revoke, nil
+}
@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployKeys(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var registered map[string]interface{}
+	var deleted []string
+	var created, revoked int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/app/installations/42", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          42,
+			"permissions": map[string]string{"administration": "write", "contents": "read"},
+		})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"administration": "write"}, body["permissions"])
+		created++
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_admin",
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("POST /api/v3/repos/testorg/test-repo/keys", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ghs_admin", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&registered))
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 7})
+	})
+	mux.HandleFunc("DELETE /api/v3/repos/testorg/test-repo/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.PathValue("id"))
+		if r.PathValue("id") != "7" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /api/v3/installation/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ghs_admin", r.Header.Get("Authorization"))
+		revoked++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/v3/meta", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ssh_keys": []string{"ssh-ed25519 AAAA", "ecdsa-sha2-nistp256 AAAA"},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:          123456,
+			InstallationID: 42,
+			Organization:   "testorg",
+			BaseURL:        server.URL + "/api/v3/",
+		},
+		keys:       newKeyRing(privateKey),
+		tokenCache: NewTokenCache(DefaultTokenCacheMinValidity),
+	}
+
+	ctx := context.Background()
+	repoURL := "ssh://git@github.com/testorg/test-repo.git"
+
+	id, err := client.RegisterDeployKey(ctx, repoURL, "flux-extension-controller test-namespace/test-secret", "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.Equal(t, "ssh-ed25519 AAAA", registered["key"])
+	assert.Equal(t, true, registered["read_only"])
+
+	// Keys already removed from the repository are not an error
+	require.NoError(t, client.DeleteDeployKey(ctx, repoURL, 7))
+	require.NoError(t, client.DeleteDeployKey(ctx, repoURL, 8))
+	assert.Equal(t, []string{"7", "8"}, deleted)
+
+	// Tokens administering the repository are neither cached nor left valid
+	assert.Equal(t, 3, created)
+	assert.Equal(t, 3, revoked)
+
+	knownHosts, err := client.KnownHosts(ctx, repoURL)
+	require.NoError(t, err)
+	// Host keys are listed for the host of the GitHub Enterprise server
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host := serverURL.Hostname()
+	assert.Equal(t, []string{host + " ssh-ed25519 AAAA", host + " ecdsa-sha2-nistp256 AAAA"}, knownHosts)
+
+	// Hosts served on another port than 22 are looked up as [host]:port
+	knownHosts, err = client.KnownHosts(ctx, "ssh://git@"+host+":2222/testorg/test-repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, "["+host+"]:2222 ssh-ed25519 AAAA", knownHosts[0])
+}
@@ -9,8 +9,16 @@ import (
 // GitHubClient interface defines the methods needed for GitHub operations
 type GitHubClient interface {
 	ValidateRepositoryURL(repoURL string) error
-	GenerateInstallationToken(ctx context.Context, repoURL string) (*github.InstallationToken, error)
+	GenerateInstallationToken(ctx context.Context, repoURL string, opts TokenOptions) (*github.InstallationToken, error)
+	GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error)
+	RevokeInstallationToken(ctx context.Context, repoURL, token string) error
+	RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error)
+	DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error
+	KnownHosts(ctx context.Context, repoURL string) ([]string, error)
 }
 
 // Ensure Client implements GitHubClient interface
 var _ GitHubClient = (*Client)(nil)
+
+// Ensure ClientSet implements GitHubClient interface
+var _ GitHubClient = (*ClientSet)(nil)
@@ -0,0 +1,395 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// privateKeyPollInterval is how often the private key file is re-read in case a change was not
+// reported by the file watcher
+const privateKeyPollInterval = time.Minute
+
+// keyRing holds the signers of a GitHub App. JWTs are signed with the keys read from the key
+// file in order, followed by the key that was active before the file last changed, so a rotation
+// keeps working while GitHub and the mounted secret disagree on the key.
+type keyRing struct {
+	mu       sync.RWMutex
+	keys     []Signer
+	previous Signer
+	active   Signer
+}
+
+// newKeyRing creates a key ring of keys, the first of which is active
+func newKeyRing(keys ...Signer) *keyRing {
+	return &keyRing{keys: keys, active: keys[0]}
+}
+
+// Keys returns the keys in the order they are tried
+func (k *keyRing) Keys() []Signer {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := append([]Signer(nil), k.keys...)
+	if k.previous != nil {
+		keys = append(keys, k.previous)
+	}
+	return keys
+}
+
+// Active returns the key that last authenticated with GitHub
+func (k *keyRing) Active() Signer {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// Replace replaces the keys read from the key file. The active key stays available as a fallback
+// until one of the new keys is accepted. It reports whether the keys changed.
+func (k *keyRing) Replace(keys []Signer) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if sameKeys(k.keys, keys) {
+		return false
+	}
+
+	k.previous = nil
+	if !containsKey(keys, k.active) {
+		k.previous = k.active
+	}
+	k.keys = keys
+	return true
+}
+
+// Accept marks the key as active after GitHub accepted a JWT signed with it. Once a key of the
+// key file is accepted, the fallback key is dropped. It reports whether the active key changed.
+func (k *keyRing) Accept(key Signer) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if containsKey(k.keys, key) {
+		k.previous = nil
+	}
+	if sameKey(k.active, key) {
+		return false
+	}
+	k.active = key
+	return true
+}
+
+// sameKeys checks if both lists hold the same keys in the same order
+func sameKeys(a, b []Signer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameKey(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameKey checks if both signers hold the same key
+func sameKey(a, b Signer) bool {
+	public, ok := a.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(b.Public())
+}
+
+// containsKey checks if keys holds key
+func containsKey(keys []Signer, key Signer) bool {
+	for _, candidate := range keys {
+		if sameKey(candidate, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyFingerprint returns the SHA256 fingerprint of the public key, in the format GitHub lists
+// the private keys of an App
+func KeyFingerprint(key Signer) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readSigners returns the signers of the GitHub App: the configured remote signer, or the private
+// keys read from the configured Secret or file
+func (c *Client) readSigners(ctx context.Context) ([]Signer, error) {
+	if signerConfig := c.config.RemoteSigner; signerConfig != nil {
+		signer, err := NewRemoteSigner(ctx, signerConfig, c.httpClient(c.signerTransport))
+		if err != nil {
+			return nil, err
+		}
+		return []Signer{signer}, nil
+	}
+
+	var keys []*rsa.PrivateKey
+	var err error
+	if c.config.PrivateKeySecretRef != nil {
+		keys, err = c.readPrivateKeySecret(ctx)
+	} else {
+		keys, err = loadPrivateKeys(c.config.PrivateKeyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]Signer, 0, len(keys))
+	for _, key := range keys {
+		signers = append(signers, key)
+	}
+	return signers, nil
+}
+
+// readPrivateKeySecret reads the private keys of the GitHub App from the configured Secret
+func (c *Client) readPrivateKeySecret(ctx context.Context) ([]*rsa.PrivateKey, error) {
+	ref := c.config.PrivateKeySecretRef
+
+	if c.secrets == nil {
+		return nil, fmt.Errorf("private key secret %s requires a Kubernetes client", ref)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.secrets.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get private key secret %s: %w", ref, err)
+	}
+
+	keyData, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("private key secret %s has no key %s", ref, ref.Key)
+	}
+
+	return parsePrivateKeys(keyData)
+}
+
+// loadPrivateKeys loads the RSA private keys from file
+func loadPrivateKeys(keyPath string) ([]*rsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	return parsePrivateKeys(keyData)
+}
+
+// parsePrivateKeys parses PEM encoded RSA private keys. During a key rotation the key file or
+// Secret may hold several keys, newest first.
+func parsePrivateKeys(keyData []byte) ([]*rsa.PrivateKey, error) {
+	var keys []*rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, keyData = pem.Decode(keyData)
+		if block == nil {
+			break
+		}
+
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to parse private key: no PEM encoded key found")
+	}
+
+	return keys, nil
+}
+
+// WatchPrivateKey reloads the private key whenever its Secret or file changes, until ctx is done.
+// A key that cannot be read leaves the loaded keys in place. The public key of a remote signer is
+// re-read periodically to pick up keys rotated by the signer.
+func (c *Client) WatchPrivateKey(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("organization", c.config.Organization)
+
+	if c.config.PrivateKeySecretRef != nil {
+		return c.watchPrivateKeySecret(ctx, logger)
+	}
+
+	if c.config.RemoteSigner != nil {
+		ticker := time.NewTicker(privateKeyPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				c.reloadPrivateKey(ctx, logger)
+			}
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create private key watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Secrets are mounted through symlinks that the kubelet swaps, so the directory is watched
+	// rather than the file
+	if err := watcher.Add(filepath.Dir(c.config.PrivateKeyPath)); err != nil {
+		return fmt.Errorf("failed to watch private key file: %w", err)
+	}
+
+	ticker := time.NewTicker(privateKeyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			c.reloadPrivateKey(ctx, logger)
+		case <-ticker.C:
+			c.reloadPrivateKey(ctx, logger)
+		case err := <-watcher.Errors:
+			logger.Error(err, "Private key watcher failed")
+		}
+	}
+}
+
+// watchPrivateKeySecret reloads the private key whenever its Secret changes, until ctx is done
+func (c *Client) watchPrivateKeySecret(ctx context.Context, logger logr.Logger) error {
+	if c.informers == nil {
+		return fmt.Errorf("private key secret %s requires a Kubernetes cache to be watched", c.config.PrivateKeySecretRef)
+	}
+
+	informer, err := c.informers.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		return fmt.Errorf("failed to get Secret informer: %w", err)
+	}
+
+	ref := c.config.PrivateKeySecretRef
+	changes := make(chan struct{}, 1)
+	notify := func(obj interface{}) {
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Namespace == ref.Namespace && secret.Name == ref.Name {
+			// Changes arriving while a reload is pending are covered by that reload
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, obj interface{}) { notify(obj) },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch private key secret %s: %w", ref, err)
+	}
+	defer func() { _ = informer.RemoveEventHandler(registration) }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			c.reloadPrivateKey(ctx, logger)
+		}
+	}
+}
+
+// reloadPrivateKey replaces the keys of the client with the keys in the Secret or key file
+func (c *Client) reloadPrivateKey(ctx context.Context, logger logr.Logger) {
+	keys, err := c.readSigners(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to reload private key, keeping the loaded keys")
+		return
+	}
+
+	if c.keys.Replace(keys) {
+		fingerprints := make([]string, 0, len(keys))
+		for _, key := range keys {
+			fingerprints = append(fingerprints, KeyFingerprint(key))
+		}
+		logger.Info("Reloaded private key", "fingerprints", fingerprints,
+			"activeFingerprint", KeyFingerprint(c.keys.Active()))
+	}
+}
+
+// setActiveKeyMetric marks key as the active private key of the organization
+func (c *Client) setActiveKeyMetric(key Signer) {
+	activePrivateKey.DeletePartialMatch(map[string]string{"organization": c.config.Organization})
+	activePrivateKey.WithLabelValues(c.config.Organization, KeyFingerprint(key)).Set(1)
+}
+
+// appTransport authenticates requests as the GitHub App with a JWT. Requests rejected as
+// unauthorized are retried with the JWTs of the other keys in the key ring.
+type appTransport struct {
+	client *Client
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	keys := t.client.keys.Keys()
+	for i, key := range keys {
+		token, err := t.client.appJWT(req.Context(), key)
+		if err != nil {
+			return nil, err
+		}
+
+		attempt := req.Clone(req.Context())
+		if i > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		attempt.Header.Set("Authorization", "Bearer "+token)
+		attempt.Header.Set("Accept", "application/vnd.github.v3+json")
+
+		resp, err := t.client.rateLimits.transport(appRateLimitKey, t.client.baseTransport()).RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			if t.client.keys.Accept(key) {
+				log.FromContext(req.Context()).Info("Switched active private key",
+					"organization", t.client.config.Organization, "fingerprint", KeyFingerprint(key))
+				t.client.setActiveKeyMetric(key)
+			}
+			return resp, nil
+		}
+
+		// A JWT that was rejected is not sent again
+		t.client.jwts.Remove(key)
+
+		// Bodies that cannot be replayed, and the last key, leave the response to the caller
+		if i == len(keys)-1 || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	return nil, fmt.Errorf("no private key loaded")
+}
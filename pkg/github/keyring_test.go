@@ -0,0 +1,288 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// encodePrivateKeys encodes keys as concatenated PEM blocks
+func encodePrivateKeys(keys ...*rsa.PrivateKey) []byte {
+	var data []byte
+	for _, key := range keys {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})...)
+	}
+	return data
+}
+
+func generateTestKeys(t *testing.T, n int) []*rsa.PrivateKey {
+	keys := make([]*rsa.PrivateKey, n)
+	for i := range keys {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestLoadPrivateKeys_MultipleKeys(t *testing.T) {
+	keys := generateTestKeys(t, 2)
+	keyPath := filepath.Join(t.TempDir(), "private-key.pem")
+	require.NoError(t, os.WriteFile(keyPath, encodePrivateKeys(keys...), 0600))
+
+	loaded, err := loadPrivateKeys(keyPath)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.True(t, keys[0].Equal(loaded[0]))
+	assert.True(t, keys[1].Equal(loaded[1]))
+}
+
+func TestKeyRing(t *testing.T) {
+	keys := generateTestKeys(t, 3)
+	oldKey, newKey, otherKey := keys[0], keys[1], keys[2]
+
+	ring := newKeyRing(oldKey)
+	assert.Equal(t, []Signer{oldKey}, ring.Keys())
+	assert.False(t, ring.Replace([]Signer{oldKey}))
+
+	// The old key stays available until a new key is accepted
+	assert.True(t, ring.Replace([]Signer{newKey}))
+	assert.Equal(t, []Signer{newKey, oldKey}, ring.Keys())
+	assert.Same(t, oldKey, ring.Active())
+
+	assert.False(t, ring.Accept(oldKey))
+	assert.Equal(t, []Signer{newKey, oldKey}, ring.Keys())
+
+	assert.True(t, ring.Accept(newKey))
+	assert.Equal(t, []Signer{newKey}, ring.Keys())
+	assert.Same(t, newKey, ring.Active())
+
+	// Keys listed in the key file are not duplicated as fallback
+	assert.True(t, ring.Replace([]Signer{otherKey, newKey}))
+	assert.Equal(t, []Signer{otherKey, newKey}, ring.Keys())
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	keys := generateTestKeys(t, 2)
+	assert.True(t, strings.HasPrefix(KeyFingerprint(keys[0]), "SHA256:"))
+	assert.Equal(t, KeyFingerprint(keys[0]), KeyFingerprint(keys[0]))
+	assert.NotEqual(t, KeyFingerprint(keys[0]), KeyFingerprint(keys[1]))
+}
+
+func TestAppTransport_FallsBackToPreviousKey(t *testing.T) {
+	keys := generateTestKeys(t, 2)
+	oldKey, newKey := keys[0], keys[1]
+
+	// GitHub accepts the key registered for the App and sees the request body on every attempt
+	var mu sync.Mutex
+	registered := oldKey
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		_, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+			return &registered.PublicKey, nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{AppID: 123456, Organization: "keyring-org"},
+		keys:   newKeyRing(oldKey),
+	}
+	client.keys.Replace([]Signer{newKey})
+	httpClient := &http.Client{Transport: &appTransport{client: client}}
+
+	// The new key is not registered with GitHub yet, so the old key authenticates
+	resp, err := httpClient.Post(server.URL, "application/json", strings.NewReader(`{"a":1}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{`{"a":1}`, `{"a":1}`}, bodies)
+	assert.Same(t, oldKey, client.keys.Active())
+
+	// Once GitHub knows the new key, it becomes active and the old key is dropped
+	mu.Lock()
+	registered = newKey
+	mu.Unlock()
+
+	resp, err = httpClient.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Same(t, newKey, client.keys.Active())
+	assert.Equal(t, []Signer{newKey}, client.keys.Keys())
+	assert.Equal(t, float64(1), testutil.ToFloat64(activePrivateKey.WithLabelValues("keyring-org", KeyFingerprint(newKey))))
+	assert.Equal(t, 1, testutil.CollectAndCount(activePrivateKey.MustCurryWith(map[string]string{"organization": "keyring-org"})))
+}
+
+func TestReloadPrivateKey_KeepsKeysOnInvalidFile(t *testing.T) {
+	keys := generateTestKeys(t, 1)
+	keyPath := filepath.Join(t.TempDir(), "private-key.pem")
+	require.NoError(t, os.WriteFile(keyPath, []byte("partially written"), 0600))
+
+	client := &Client{
+		config: &config.GitHubConfig{PrivateKeyPath: keyPath},
+		keys:   newKeyRing(keys[0]),
+	}
+	client.reloadPrivateKey(context.Background(), logr.Discard())
+	assert.Equal(t, []Signer{keys[0]}, client.keys.Keys())
+}
+
+func TestWatchPrivateKey(t *testing.T) {
+	keys := generateTestKeys(t, 2)
+	keyPath := filepath.Join(t.TempDir(), "private-key.pem")
+	require.NoError(t, os.WriteFile(keyPath, encodePrivateKeys(keys[0]), 0600))
+
+	client := &Client{
+		config: &config.GitHubConfig{PrivateKeyPath: keyPath},
+		keys:   newKeyRing(keys[0]),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- client.WatchPrivateKey(ctx) }()
+
+	// Wait for the watcher to be set up before rotating the key
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, os.WriteFile(keyPath, encodePrivateKeys(keys[1]), 0600))
+
+	assert.Eventually(t, func() bool {
+		return keys[1].Equal(client.keys.Keys()[0])
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+// registeringInformers reports when an event handler was added to one of its informers. The fake
+// informers are not safe for concurrent use, so tests wait for the handler before sending events.
+type registeringInformers struct {
+	*informertest.FakeInformers
+	registered chan struct{}
+}
+
+func (i *registeringInformers) GetInformer(ctx context.Context, obj ctrlclient.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	informer, err := i.FakeInformers.GetInformer(ctx, obj, opts...)
+	return &registeringInformer{Informer: informer, registered: i.registered}, err
+}
+
+type registeringInformer struct {
+	cache.Informer
+	registered chan struct{}
+}
+
+func (i *registeringInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	defer close(i.registered)
+	return i.Informer.AddEventHandler(handler)
+}
+
+func TestNewClient_PrivateKeySecret(t *testing.T) {
+	keys := generateTestKeys(t, 2)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-app", Namespace: "flux-extension-system"},
+		Data:       map[string][]byte{"private-key": encodePrivateKeys(keys[0])},
+	}
+	fakeClient := fake.NewClientBuilder().WithObjects(secret).Build()
+	informers := &registeringInformers{FakeInformers: &informertest.FakeInformers{}, registered: make(chan struct{})}
+
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "secret-org",
+		PrivateKeySecretRef: &config.SecretKeyReference{
+			Namespace: "flux-extension-system",
+			Name:      "github-app",
+			Key:       "private-key",
+		},
+	}
+	client, err := NewClient(cfg, fakeClient, informers)
+	require.NoError(t, err)
+	assert.Equal(t, []Signer{keys[0]}, client.keys.Keys())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	informer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- client.WatchPrivateKey(ctx) }()
+	<-informers.registered
+
+	// Rotate the key in the Secret
+	updated := secret.DeepCopy()
+	updated.Data["private-key"] = encodePrivateKeys(keys[1])
+	require.NoError(t, fakeClient.Update(ctx, updated))
+
+	// Changes to other Secrets are ignored
+	other := updated.DeepCopy()
+	other.Name = "other"
+	informer.Update(secret, other)
+
+	informer.Update(secret, updated)
+	assert.Eventually(t, func() bool {
+		return keys[1].Equal(client.keys.Keys()[0])
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestNewClient_PrivateKeySecretErrors(t *testing.T) {
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "secret-org",
+		PrivateKeySecretRef: &config.SecretKeyReference{
+			Namespace: "flux-extension-system",
+			Name:      "github-app",
+			Key:       "private-key",
+		},
+	}
+
+	_, err := NewClient(cfg, fake.NewClientBuilder().Build(), nil)
+	assert.ErrorContains(t, err, "failed to get private key secret flux-extension-system/github-app:private-key")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-app", Namespace: "flux-extension-system"},
+		Data:       map[string][]byte{"other-key": []byte("data")},
+	}
+	_, err = NewClient(cfg, fake.NewClientBuilder().WithObjects(secret).Build(), nil)
+	assert.ErrorContains(t, err, "has no key private-key")
+}
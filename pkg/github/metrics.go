@@ -0,0 +1,79 @@
+package github
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// installationTokensCreatedTotal counts installation tokens minted through the GitHub API
+	installationTokensCreatedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_github_installation_tokens_created_total",
+			Help: "Number of installation tokens created through the GitHub API, by organization.",
+		},
+		[]string{"organization"},
+	)
+
+	// tokenCacheHitsTotal counts installation tokens served from the token cache
+	tokenCacheHitsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_github_token_cache_hits_total",
+			Help: "Number of installation token requests served from the token cache.",
+		},
+	)
+
+	// activePrivateKey marks the fingerprint of the private key JWTs are signed with
+	activePrivateKey = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "flux_extension_controller_github_app_private_key_info",
+			Help: "Fingerprint of the active GitHub App private key, by organization. The value is always 1.",
+		},
+		[]string{"organization", "fingerprint"},
+	)
+
+	// rateLimitRemaining tracks the remaining GitHub API rate limit
+	rateLimitRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "flux_extension_controller_github_rate_limit_remaining",
+			Help: "Remaining GitHub API requests in the current rate limit window, by organization and installation. The installation is \"app\" for requests authenticated as the GitHub App.",
+		},
+		[]string{"organization", "installation"},
+	)
+
+	// rateLimitedResponsesTotal counts responses rejecting requests because of a rate limit
+	rateLimitedResponsesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_github_rate_limited_responses_total",
+			Help: "Number of GitHub API responses rejecting a request because of a rate limit, by organization and installation.",
+		},
+		[]string{"organization", "installation"},
+	)
+
+	// apiRequestDuration tracks the latency of requests to the GitHub API
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "flux_extension_controller_github_api_request_duration_seconds",
+			Help:    "Latency of requests to the GitHub API, by HTTP method and status code.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "code"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		installationTokensCreatedTotal,
+		tokenCacheHitsTotal,
+		activePrivateKey,
+		rateLimitRemaining,
+		rateLimitedResponsesTotal,
+		apiRequestDuration,
+	)
+}
+
+// apiTransport sends requests to the GitHub API and records their latency
+var apiTransport http.RoundTripper = promhttp.InstrumentRoundTripperDuration(apiRequestDuration, http.DefaultTransport)
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// TokenOptions narrows the access of an installation token
+type TokenOptions struct {
+	// Repositories lists repositories the token grants access to besides the repository it is
+	// issued for, as names or owner/name. They must belong to the same owner.
+	Repositories []string
+
+	// Permissions maps permission names to access levels, e.g. contents: read. When empty,
+	// the permissions configured for the GitHub App apply, and otherwise every permission
+	// granted to the installation.
+	Permissions map[string]string
+
+	// Requested marks Permissions requested by the owner of a Flux object, e.g. with an
+	// annotation, rather than chosen by the controller. They may not exceed the requestable
+	// permissions configured for the GitHub App.
+	Requested bool
+}
+
+// ParseRepositories parses a comma-separated list of repositories, e.g. "charts,acme-corp/infra"
+func ParseRepositories(value string) ([]string, error) {
+	var repositories []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, "/")
+		if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return nil, fmt.Errorf("invalid repository %q, expected name or owner/name", entry)
+		}
+		repositories = append(repositories, entry)
+	}
+
+	return repositories, nil
+}
+
+// tokenRepositories returns the sorted names of the repositories a token for owner/repo
+// covers, including the additional repositories. Tokens are issued by one installation,
+// so every repository must belong to owner.
+func tokenRepositories(owner, repo string, additional []string) ([]string, error) {
+	seen := map[string]bool{strings.ToLower(repo): true}
+	repositories := []string{repo}
+
+	for _, entry := range additional {
+		name := entry
+		if repoOwner, repoName, found := strings.Cut(entry, "/"); found {
+			if !strings.EqualFold(repoOwner, owner) {
+				return nil, fmt.Errorf("repository %s does not belong to %s, a token covers repositories of a single owner", entry, owner)
+			}
+			name = repoName
+		}
+		name = strings.TrimSuffix(name, ".git")
+
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			repositories = append(repositories, name)
+		}
+	}
+
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// RepositoryNames returns the sorted names of the repositories an installation token was issued for
+func RepositoryNames(token *github.InstallationToken) []string {
+	var names []string
+	for _, repository := range token.Repositories {
+		names = append(names, repository.GetName())
+	}
+	sort.Strings(names)
+
+	return names
+}
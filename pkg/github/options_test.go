@@ -0,0 +1,74 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepositories(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    []string
+		expectError bool
+	}{
+		{name: "names", value: "charts, infra", expected: []string{"charts", "infra"}},
+		{name: "owner and name", value: "testorg/charts", expected: []string{"testorg/charts"}},
+		{name: "empty", value: ""},
+		{name: "missing name", value: "testorg/", expectError: true},
+		{name: "too many segments", value: "github.com/testorg/charts", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repositories, err := ParseRepositories(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, repositories)
+		})
+	}
+}
+
+func TestTokenRepositories(t *testing.T) {
+	tests := []struct {
+		name        string
+		additional  []string
+		expected    []string
+		expectError bool
+	}{
+		{name: "single repository", expected: []string{"test-repo"}},
+		{name: "additional repositories", additional: []string{"infra", "charts.git"}, expected: []string{"charts", "infra", "test-repo"}},
+		{name: "same owner", additional: []string{"TestOrg/charts"}, expected: []string{"charts", "test-repo"}},
+		{name: "duplicates", additional: []string{"Test-Repo", "charts", "testorg/charts"}, expected: []string{"charts", "test-repo"}},
+		{name: "other owner", additional: []string{"otherorg/charts"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repositories, err := tokenRepositories("testorg", "test-repo", tt.additional)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, repositories)
+		})
+	}
+}
+
+func TestRepositoryNames(t *testing.T) {
+	token := &github.InstallationToken{
+		Repositories: []*github.Repository{
+			{Name: github.String("test-repo")},
+			{Name: github.String("charts")},
+		},
+	}
+	assert.Equal(t, []string{"charts", "test-repo"}, RepositoryNames(token))
+	assert.Empty(t, RepositoryNames(&github.InstallationToken{}))
+}
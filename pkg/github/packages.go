@@ -0,0 +1,38 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// packagePermissions are the permissions of the installation tokens pulling from the container registry
+var packagePermissions = map[string]string{"packages": "read"}
+
+// GeneratePackageToken creates an installation token allowed to pull the packages of the owner of
+// an OCI repository, e.g. oci://ghcr.io/acme-corp/charts. Packages are not scoped to repositories,
+// so the token is issued for the whole installation and carries no other permission.
+func (c *Client) GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+	if !IsOCIRepositoryURL(repoURL) {
+		return nil, fmt.Errorf("%s is not an OCI repository", repoURL)
+	}
+	if err := c.ValidateRepositoryURL(repoURL); err != nil {
+		return nil, err
+	}
+
+	ref, err := ParseRepositoryRef(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := c.createInstallationToken(ctx, c.tokenCache, ref.Owner, nil, packagePermissions,
+		func(jwtClient *github.Client) (*github.Installation, error) {
+			installation, _, err := jwtClient.Apps.FindOrganizationInstallation(ctx, ref.Owner)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find organization installation: %w", err)
+			}
+			return installation, nil
+		})
+	return token, err
+}
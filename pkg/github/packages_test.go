@@ -0,0 +1,82 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePackageToken(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var lookups, created int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/orgs/testorg/installation", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          42,
+			"permissions": map[string]string{"contents": "read", "packages": "read"},
+		})
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		created++
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"packages": "read"}, body["permissions"])
+		assert.NotContains(t, body, "repositories")
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_packages",
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:        123456,
+			Organization: "testorg",
+			BaseURL:      server.URL + "/api/v3/",
+		},
+		keys:          newKeyRing(privateKey),
+		tokenCache:    NewTokenCache(DefaultTokenCacheMinValidity),
+		installations: newInstallationCache(DefaultInstallationCacheTTL),
+	}
+
+	ctx := context.Background()
+
+	token, err := client.GeneratePackageToken(ctx, "oci://containers.127.0.0.1/testorg/charts")
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_packages", token.GetToken())
+
+	// Every repository of the owner shares the token
+	token, err = client.GeneratePackageToken(ctx, "oci://containers.127.0.0.1/testorg/manifests/app")
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_packages", token.GetToken())
+	assert.Equal(t, 1, lookups)
+	assert.Equal(t, 1, created)
+
+	_, err = client.GeneratePackageToken(ctx, "oci://ghcr.io/testorg/charts")
+	assert.ErrorContains(t, err, "repository must be hosted on containers.127.0.0.1")
+
+	_, err = client.GeneratePackageToken(ctx, "oci://containers.127.0.0.1/otherorg/charts")
+	assert.ErrorContains(t, err, "repository must belong to organization testorg")
+
+	_, err = client.GeneratePackageToken(ctx, "https://github.com/testorg/test-repo")
+	assert.ErrorContains(t, err, "is not an OCI repository")
+
+	_, err = client.GenerateInstallationToken(ctx, "oci://containers.127.0.0.1/testorg/charts", TokenOptions{})
+	assert.ErrorContains(t, err, "pulled with a package token")
+}
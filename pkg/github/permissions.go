@@ -0,0 +1,150 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// permissionLevels ranks the access levels of GitHub App permissions
+var permissionLevels = map[string]int{
+	"read":  1,
+	"write": 2,
+	"admin": 3,
+}
+
+// ParsePermissions parses a comma-separated list of permissions, e.g. "contents:read,metadata:read"
+func ParsePermissions(value string) (map[string]string, error) {
+	permissions := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, level, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid permission %q, expected name:level", entry)
+		}
+		permissions[strings.TrimSpace(name)] = strings.ToLower(strings.TrimSpace(level))
+	}
+
+	if _, err := newInstallationPermissions(permissions); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// FormatPermissions formats permissions as a sorted, comma-separated list in the format read by ParsePermissions
+func FormatPermissions(permissions map[string]string) string {
+	entries := make([]string, 0, len(permissions))
+	for name, level := range permissions {
+		entries = append(entries, name+":"+level)
+	}
+	sort.Strings(entries)
+
+	return strings.Join(entries, ",")
+}
+
+// PermissionsMap converts the permissions of an installation or token to a map of names to access levels
+func PermissionsMap(permissions *github.InstallationPermissions) map[string]string {
+	result := make(map[string]string)
+	if permissions == nil {
+		return result
+	}
+
+	// The JSON names of the fields are the permission names of the GitHub API
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return result
+	}
+	_ = json.Unmarshal(data, &result)
+
+	return result
+}
+
+// newInstallationPermissions converts permissions to the request format of the GitHub API,
+// rejecting unknown permission names and access levels
+func newInstallationPermissions(permissions map[string]string) (*github.InstallationPermissions, error) {
+	for name, level := range permissions {
+		if _, ok := permissionLevels[level]; !ok {
+			return nil, fmt.Errorf("invalid access level %q for permission %s, expected read, write or admin", level, name)
+		}
+	}
+
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	installationPermissions := &github.InstallationPermissions{}
+	if err := json.Unmarshal(data, installationPermissions); err != nil {
+		return nil, fmt.Errorf("invalid permissions: %w", err)
+	}
+
+	// Names that are not fields of InstallationPermissions are dropped by the round trip
+	known := PermissionsMap(installationPermissions)
+	for name := range permissions {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown permission %q", name)
+		}
+	}
+
+	return installationPermissions, nil
+}
+
+// limitPermissions checks that every requested permission is in limit at the requested access
+// level or above. An empty limit allows any permission.
+func limitPermissions(requested, limit map[string]string) error {
+	if len(limit) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(requested))
+	for name := range requested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		level := requested[name]
+		limitLevel, ok := limit[name]
+		if !ok {
+			return fmt.Errorf("permission %s:%s may not be requested, requestable permissions are %s", name, level, FormatPermissions(limit))
+		}
+		if permissionLevels[level] > permissionLevels[limitLevel] {
+			return fmt.Errorf("permission %s:%s exceeds the requestable %s:%s", name, level, name, limitLevel)
+		}
+	}
+
+	return nil
+}
+
+// validatePermissions checks that the installation was granted every requested permission
+// at the requested access level or above
+func validatePermissions(requested map[string]string, granted *github.InstallationPermissions) error {
+	grantedLevels := PermissionsMap(granted)
+
+	names := make([]string, 0, len(requested))
+	for name := range requested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		level := requested[name]
+		grantedLevel, ok := grantedLevels[name]
+		if !ok {
+			return fmt.Errorf("permission %s:%s is not granted to the installation", name, level)
+		}
+		if permissionLevels[level] > permissionLevels[grantedLevel] {
+			return fmt.Errorf("permission %s:%s exceeds %s:%s granted to the installation", name, level, name, grantedLevel)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v76/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    map[string]string
+		expectError bool
+	}{
+		{
+			name:     "single permission",
+			value:    "contents:read",
+			expected: map[string]string{"contents": "read"},
+		},
+		{
+			name:     "several permissions with spaces",
+			value:    " contents: read , metadata:READ ",
+			expected: map[string]string{"contents": "read", "metadata": "read"},
+		},
+		{
+			name:     "empty",
+			value:    "",
+			expected: map[string]string{},
+		},
+		{
+			name:        "missing access level",
+			value:       "contents",
+			expectError: true,
+		},
+		{
+			name:        "invalid access level",
+			value:       "contents:none",
+			expectError: true,
+		},
+		{
+			name:        "unknown permission",
+			value:       "teleport:write",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissions, err := ParsePermissions(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, permissions)
+		})
+	}
+}
+
+func TestFormatPermissions(t *testing.T) {
+	value := FormatPermissions(map[string]string{"metadata": "read", "contents": "write"})
+	assert.Equal(t, "contents:write,metadata:read", value)
+
+	permissions, err := ParsePermissions(value)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"metadata": "read", "contents": "write"}, permissions)
+}
+
+func TestLimitPermissions(t *testing.T) {
+	limit := map[string]string{"contents": "read", "metadata": "read"}
+
+	tests := []struct {
+		name        string
+		requested   map[string]string
+		limit       map[string]string
+		expectError string
+	}{
+		{name: "within limit", requested: map[string]string{"contents": "read"}, limit: limit},
+		{name: "higher level", requested: map[string]string{"contents": "write"}, limit: limit, expectError: "contents:write exceeds the requestable contents:read"},
+		{name: "not requestable", requested: map[string]string{"administration": "write"}, limit: limit, expectError: "administration:write may not be requested"},
+		{name: "no limit", requested: map[string]string{"administration": "write"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limitPermissions(tt.requested, tt.limit)
+			if tt.expectError != "" {
+				assert.ErrorContains(t, err, tt.expectError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	granted := &github.InstallationPermissions{
+		Contents: github.String("write"),
+		Metadata: github.String("read"),
+	}
+
+	tests := []struct {
+		name        string
+		requested   map[string]string
+		expectError bool
+	}{
+		{name: "lower level", requested: map[string]string{"contents": "read"}},
+		{name: "same level", requested: map[string]string{"contents": "write", "metadata": "read"}},
+		{name: "higher level", requested: map[string]string{"metadata": "write"}, expectError: true},
+		{name: "not granted", requested: map[string]string{"issues": "read"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePermissions(tt.requested, granted)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
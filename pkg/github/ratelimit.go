@@ -0,0 +1,243 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// appRateLimitKey identifies the rate limit of requests authenticated as the GitHub App itself
+const appRateLimitKey = "app"
+
+// maxRateLimitWait is the longest a request waits for a rate limit to lift before it fails
+const maxRateLimitWait = time.Minute
+
+// RateLimitedError is returned when a request is not sent because the rate limit of the GitHub App
+// or installation is exhausted, or too low to spend it on a request that can wait
+type RateLimitedError struct {
+	Organization string
+	// Until is when the rate limit resets or GitHub allows requests again
+	Until time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit of %s is exhausted or low, retry after %s", e.Organization, e.Until.Format(time.RFC3339))
+}
+
+type deferrableKey struct{}
+
+// WithDeferrable marks requests made with the context as deferrable until deadline. When the
+// remaining rate limit is low, they fail with a RateLimitedError instead of spending it, as long
+// as the rate limit resets before deadline.
+func WithDeferrable(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, deferrableKey{}, deadline)
+}
+
+// DeferrableUntil returns the deadline set with WithDeferrable
+func DeferrableUntil(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(deferrableKey{}).(time.Time)
+	return deadline, ok
+}
+
+// installationRateLimitKey identifies the rate limit of requests authenticated as an installation
+func installationRateLimitKey(installationID int64) string {
+	return strconv.FormatInt(installationID, 10)
+}
+
+// rateLimitBudget is the rate limit GitHub reported in its last response
+type rateLimitBudget struct {
+	remaining int
+	reset     time.Time
+
+	// blockedUntil is set by Retry-After and exhausted rate limits. No requests are sent before.
+	blockedUntil time.Time
+}
+
+// rateLimits tracks the rate limits of the GitHub App and its installations
+type rateLimits struct {
+	organization string
+	// reserve is the number of remaining requests kept for requests that cannot be deferred
+	reserve int
+
+	mu      sync.Mutex
+	budgets map[string]*rateLimitBudget
+}
+
+func newRateLimits(organization string, reserve int) *rateLimits {
+	return &rateLimits{
+		organization: organization,
+		reserve:      reserve,
+		budgets:      make(map[string]*rateLimitBudget),
+	}
+}
+
+// blockedUntil returns when requests under the key may be sent again, or the zero time
+func (r *rateLimits) blockedUntil(key string) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if budget, exists := r.budgets[key]; exists && time.Now().Before(budget.blockedUntil) {
+		return budget.blockedUntil
+	}
+	return time.Time{}
+}
+
+// low reports whether the remaining rate limit under the key has dropped to the reserve, and
+// when it resets
+func (r *rateLimits) low(key string) (bool, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	budget, exists := r.budgets[key]
+	if !exists || !time.Now().Before(budget.reset) {
+		return false, time.Time{}
+	}
+	return budget.remaining <= r.reserve, budget.reset
+}
+
+// update records the rate limit reported by a response. Requests are blocked until the time
+// in Retry-After, or until the reset of an exhausted rate limit.
+func (r *rateLimits) update(key string, resp *http.Response) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	budget, exists := r.budgets[key]
+	if !exists {
+		budget = &rateLimitBudget{}
+		r.budgets[key] = budget
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	hasRemaining := err == nil
+	if hasRemaining {
+		budget.remaining = remaining
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			budget.reset = time.Unix(reset, 0)
+		}
+		rateLimitRemaining.WithLabelValues(r.organization, key).Set(float64(remaining))
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	// Secondary rate limits send Retry-After, exhausted primary rate limits a reset time
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		budget.blockedUntil = now.Add(time.Duration(seconds) * time.Second)
+	} else if hasRemaining && remaining == 0 {
+		budget.blockedUntil = budget.reset
+	} else {
+		return
+	}
+	rateLimitedResponsesTotal.WithLabelValues(r.organization, key).Inc()
+}
+
+// checkDeferrable returns a RateLimitedError when the request context is deferrable and the
+// rate limit under the key is low, but resets before the deadline of the context
+func (r *rateLimits) checkDeferrable(ctx context.Context, key string) error {
+	deadline, ok := DeferrableUntil(ctx)
+	if r == nil || !ok {
+		return nil
+	}
+
+	if low, reset := r.low(key); low && reset.Before(deadline) {
+		return &RateLimitedError{Organization: r.organization, Until: reset}
+	}
+	return nil
+}
+
+// transport returns a RoundTripper sending requests with next under the rate limit of the key.
+// Without rate limit tracking, requests are sent with next directly.
+func (r *rateLimits) transport(key string, next http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		return next
+	}
+	return &rateLimitTransport{limits: r, key: key, next: next}
+}
+
+// rateLimitTransport records the rate limits reported by GitHub and holds requests back while
+// GitHub asks to. Requests rejected with a short Retry-After are sent again once.
+type rateLimitTransport struct {
+	limits *rateLimits
+	key    string
+	next   http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		outgoing := req
+		if attempt > 0 {
+			outgoing = req.Clone(req.Context())
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				outgoing.Body = body
+			}
+		}
+
+		resp, err := t.next.RoundTrip(outgoing)
+		if err != nil {
+			return nil, err
+		}
+		t.limits.update(t.key, resp)
+
+		// Retry once if GitHub asked to wait briefly and the body can be replayed
+		until := t.limits.blockedUntil(t.key)
+		if attempt > 0 || until.IsZero() || !canWait(req.Context(), until) || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		log.FromContext(req.Context()).V(1).Info("GitHub API rate limited, waiting to retry",
+			"organization", t.limits.organization, "rateLimit", t.key, "until", until)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// wait holds the request back while requests under the key are blocked. Requests that would
+// wait longer than maxRateLimitWait or their timeout fail with a RateLimitedError.
+func (t *rateLimitTransport) wait(ctx context.Context) error {
+	until := t.limits.blockedUntil(t.key)
+	if until.IsZero() {
+		return nil
+	}
+
+	if !canWait(ctx, until) {
+		return &RateLimitedError{Organization: t.limits.organization, Until: until}
+	}
+
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// canWait checks if a request can wait until the given time, within maxRateLimitWait and the
+// deadline of its context
+func canWait(ctx context.Context, until time.Time) bool {
+	if time.Until(until) > maxRateLimitWait {
+		return false
+	}
+
+	deadline, ok := ctx.Deadline()
+	return !ok || until.Before(deadline)
+}
@@ -0,0 +1,191 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for name, value := range headers {
+		resp.Header.Set(name, value)
+	}
+	return resp
+}
+
+func TestRateLimits_Update(t *testing.T) {
+	limits := newRateLimits("testorg", 100)
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+	limits.update("42", rateLimitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "4000",
+		"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+	}))
+	low, _ := limits.low("42")
+	assert.False(t, low)
+	assert.Equal(t, float64(4000), testutil.ToFloat64(rateLimitRemaining.WithLabelValues("testorg", "42")))
+
+	limits.update("42", rateLimitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "100",
+		"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+	}))
+	low, resetAt := limits.low("42")
+	assert.True(t, low)
+	assert.Equal(t, reset, resetAt)
+	assert.True(t, limits.blockedUntil("42").IsZero())
+
+	// Other installations have their own rate limit
+	low, _ = limits.low(appRateLimitKey)
+	assert.False(t, low)
+
+	// An exhausted rate limit blocks requests until it resets
+	limits.update("42", rateLimitResponse(http.StatusForbidden, map[string]string{
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+	}))
+	assert.Equal(t, reset, limits.blockedUntil("42"))
+
+	// Secondary rate limits block requests for the time in Retry-After
+	limits.update(appRateLimitKey, rateLimitResponse(http.StatusTooManyRequests, map[string]string{
+		"Retry-After": "120",
+	}))
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), limits.blockedUntil(appRateLimitKey), time.Second)
+}
+
+func TestRateLimits_CheckDeferrable(t *testing.T) {
+	limits := newRateLimits("testorg", 100)
+	reset := time.Now().Add(10 * time.Minute)
+	limits.update(appRateLimitKey, rateLimitResponse(http.StatusOK, map[string]string{
+		"X-RateLimit-Remaining": "50",
+		"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+	}))
+
+	// Requests that cannot wait use the reserve
+	assert.NoError(t, limits.checkDeferrable(context.Background(), appRateLimitKey))
+
+	// Requests that can wait until the reset are deferred
+	err := limits.checkDeferrable(WithDeferrable(context.Background(), time.Now().Add(time.Hour)), appRateLimitKey)
+	var rateLimited *RateLimitedError
+	require.ErrorAs(t, err, &rateLimited)
+	assert.Equal(t, reset.Unix(), rateLimited.Until.Unix())
+
+	// Requests that cannot wait that long are sent
+	assert.NoError(t, limits.checkDeferrable(WithDeferrable(context.Background(), time.Now().Add(5*time.Minute)), appRateLimitKey))
+
+	// Without rate limit tracking nothing is deferred
+	assert.NoError(t, (*rateLimits)(nil).checkDeferrable(WithDeferrable(context.Background(), time.Now().Add(time.Hour)), appRateLimitKey))
+}
+
+func TestRateLimitTransport_RetriesAfterRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limits := newRateLimits("testorg", 100)
+	limitedBefore := testutil.ToFloat64(rateLimitedResponsesTotal.WithLabelValues("testorg", appRateLimitKey))
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: limits.transport(appRateLimitKey, apiTransport)}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+	assert.Equal(t, limitedBefore+1, testutil.ToFloat64(rateLimitedResponsesTotal.WithLabelValues("testorg", appRateLimitKey)))
+}
+
+func TestRateLimitTransport_FailsWhileBlocked(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	limits := newRateLimits("testorg", 100)
+	client := &http.Client{Transport: limits.transport(appRateLimitKey, apiTransport)}
+
+	// A long Retry-After is left to the caller
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Further requests are not sent until GitHub allows them again
+	_, err = client.Get(server.URL)
+	var rateLimited *RateLimitedError
+	require.True(t, errors.As(err, &rateLimited))
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), rateLimited.Until, time.Second)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestGenerateInstallationToken_DefersOnLowRateLimit(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	reset := time.Now().Add(20 * time.Minute)
+	var tokenRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.Header().Set("X-RateLimit-Remaining", "10")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_" + strconv.Itoa(tokenRequests),
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		config: &config.GitHubConfig{
+			AppID:          123456,
+			InstallationID: 42,
+			Organization:   "testorg",
+			BaseURL:        server.URL + "/api/v3/",
+		},
+		keys:       newKeyRing(privateKey),
+		rateLimits: newRateLimits("testorg", 100),
+	}
+
+	ctx := context.Background()
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/test-repo", TokenOptions{})
+	require.NoError(t, err)
+
+	// The rate limit is now low: a refresh that can wait is deferred until the reset
+	_, err = client.GenerateInstallationToken(WithDeferrable(ctx, time.Now().Add(time.Hour)), "https://github.com/testorg/test-repo", TokenOptions{})
+	var rateLimited *RateLimitedError
+	require.ErrorAs(t, err, &rateLimited)
+	assert.Equal(t, reset.Unix(), rateLimited.Until.Unix())
+
+	// Other requests still use the reserve
+	_, err = client.GenerateInstallationToken(ctx, "https://github.com/testorg/test-repo", TokenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, tokenRequests)
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RepositoryRef identifies a repository on a GitHub host
+type RepositoryRef struct {
+	// Host is the lowercased hostname, without port
+	Host string
+
+	// Port is the port of URLs naming one, e.g. ssh://git@host:2222/owner/repo. It is empty for
+	// scp-style URLs, which always use the default port.
+	Port string
+
+	// Owner is the user or organization owning the repository
+	Owner string
+
+	// Name is the repository name, without .git suffix. For OCI repositories it is the path below
+	// the owner, which is empty for repositories covering every package of the owner.
+	Name string
+}
+
+// ParseRepositoryRef parses the repository URL forms supported by Flux: https://host/owner/repo,
+// ssh://[user@]host[:port]/owner/repo and scp-style [user@]host:owner/repo. A .git suffix and path
+// segments after the repository name, e.g. /tree/main, are dropped. OCI repository URLs of the form
+// oci://host/owner[/path] are parsed as well.
+func ParseRepositoryRef(repoURL string) (RepositoryRef, error) {
+	if IsOCIRepositoryURL(repoURL) {
+		return parseOCIRepositoryRef(repoURL)
+	}
+
+	var host, port, path string
+	if isSCPLikeURL(repoURL) {
+		host, path, _ = strings.Cut(repoURL, ":")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+	} else {
+		parsedURL, err := url.Parse(repoURL)
+		if err != nil {
+			return RepositoryRef{}, fmt.Errorf("invalid repository URL: %w", err)
+		}
+		if parsedURL.Host == "" {
+			return RepositoryRef{}, fmt.Errorf("invalid repository URL %q, expected a host", repoURL)
+		}
+		host, port, path = parsedURL.Hostname(), parsedURL.Port(), parsedURL.Path
+	}
+
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pathParts) < 2 {
+		return RepositoryRef{}, fmt.Errorf("invalid repository path")
+	}
+
+	ref := RepositoryRef{
+		Host:  strings.ToLower(host),
+		Port:  port,
+		Owner: pathParts[0],
+		Name:  strings.TrimSuffix(pathParts[1], ".git"),
+	}
+	if ref.Host == "" || ref.Owner == "" || ref.Name == "" {
+		return RepositoryRef{}, fmt.Errorf("invalid repository path")
+	}
+
+	return ref, nil
+}
+
+// HasOwner checks if the repository belongs to owner. Owners are matched case-insensitively like GitHub does.
+func (r RepositoryRef) HasOwner(owner string) bool {
+	return strings.EqualFold(r.Owner, owner)
+}
+
+// String returns the repository as owner/name
+func (r RepositoryRef) String() string {
+	return r.Owner + "/" + r.Name
+}
+
+// parseOCIRepositoryRef parses an OCI repository URL of the form oci://host/owner[/path]
+func parseOCIRepositoryRef(repoURL string) (RepositoryRef, error) {
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil {
+		return RepositoryRef{}, fmt.Errorf("invalid OCI repository URL: %w", err)
+	}
+
+	owner, name, _ := strings.Cut(strings.Trim(parsedURL.Path, "/"), "/")
+	ref := RepositoryRef{
+		Host:  strings.ToLower(parsedURL.Hostname()),
+		Owner: owner,
+		Name:  name,
+	}
+	if ref.Host == "" || ref.Owner == "" {
+		return RepositoryRef{}, fmt.Errorf("invalid OCI repository URL %q, expected oci://host/owner", repoURL)
+	}
+
+	return ref, nil
+}
+
+// IsOCIRepositoryURL checks if the URL points at an OCI repository, whose packages are pulled with
+// a package token
+func IsOCIRepositoryURL(repoURL string) bool {
+	return strings.HasPrefix(strings.ToLower(repoURL), "oci://")
+}
+
+// IsSSHRepositoryURL checks if the repository is cloned over SSH and authenticated with a deploy key
+func IsSSHRepositoryURL(repoURL string) bool {
+	return strings.HasPrefix(strings.ToLower(repoURL), "ssh://") || isSCPLikeURL(repoURL)
+}
+
+// isSCPLikeURL checks if the URL is in the scp-like form [user@]host:path used by Git over SSH
+func isSCPLikeURL(repoURL string) bool {
+	if strings.Contains(repoURL, "://") {
+		return false
+	}
+
+	colon := strings.Index(repoURL, ":")
+	slash := strings.Index(repoURL, "/")
+	return colon > 0 && (slash < 0 || colon < slash)
+}
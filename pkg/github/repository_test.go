@@ -0,0 +1,149 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepositoryRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		repoURL     string
+		expected    RepositoryRef
+		expectError bool
+	}{
+		{
+			name:     "standard GitHub URL",
+			repoURL:  "https://github.com/testorg/test-repo",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "GitHub URL with .git suffix",
+			repoURL:  "https://github.com/testorg/test-repo.git",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "trailing slash",
+			repoURL:  "https://github.com/testorg/test-repo/",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "branch path",
+			repoURL:  "https://github.com/testorg/test-repo/tree/main",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "mixed case host and owner",
+			repoURL:  "https://GitHub.com/TestOrg/Test-Repo",
+			expected: RepositoryRef{Host: "github.com", Owner: "TestOrg", Name: "Test-Repo"},
+		},
+		{
+			name:     "http URL",
+			repoURL:  "http://github.example.com/testorg/test-repo",
+			expected: RepositoryRef{Host: "github.example.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "ssh URL",
+			repoURL:  "ssh://git@github.com/testorg/test-repo.git",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "ssh URL with port",
+			repoURL:  "ssh://git@github.example.com:2222/testorg/test-repo",
+			expected: RepositoryRef{Host: "github.example.com", Port: "2222", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "scp-style URL",
+			repoURL:  "git@github.com:testorg/test-repo.git",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "scp-style URL without user",
+			repoURL:  "github.com:testorg/test-repo",
+			expected: RepositoryRef{Host: "github.com", Owner: "testorg", Name: "test-repo"},
+		},
+		{
+			name:     "OCI repository",
+			repoURL:  "oci://ghcr.io/testorg/charts/podinfo",
+			expected: RepositoryRef{Host: "ghcr.io", Owner: "testorg", Name: "charts/podinfo"},
+		},
+		{
+			name:     "OCI repository of every package of the owner",
+			repoURL:  "oci://GHCR.io/testorg",
+			expected: RepositoryRef{Host: "ghcr.io", Owner: "testorg"},
+		},
+		{
+			name:        "OCI repository without owner",
+			repoURL:     "oci://ghcr.io",
+			expectError: true,
+		},
+		{
+			name:        "invalid URL",
+			repoURL:     "invalid-url",
+			expectError: true,
+		},
+		{
+			name:        "incomplete path",
+			repoURL:     "https://github.com/testorg",
+			expectError: true,
+		},
+		{
+			name:        "incomplete scp-style path",
+			repoURL:     "git@github.com:testorg",
+			expectError: true,
+		},
+		{
+			name:        "empty repository name",
+			repoURL:     "https://github.com/testorg/.git",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseRepositoryRef(tt.repoURL)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ref)
+		})
+	}
+}
+
+func TestRepositoryRef_HasOwner(t *testing.T) {
+	ref := RepositoryRef{Host: "github.com", Owner: "TestOrg", Name: "test-repo"}
+	assert.True(t, ref.HasOwner("testorg"))
+	assert.True(t, ref.HasOwner("TESTORG"))
+	assert.False(t, ref.HasOwner("other-org"))
+	assert.Equal(t, "TestOrg/test-repo", ref.String())
+}
+
+func TestIsOCIRepositoryURL(t *testing.T) {
+	assert.True(t, IsOCIRepositoryURL("oci://ghcr.io/testorg/charts"))
+	assert.True(t, IsOCIRepositoryURL("OCI://ghcr.io/testorg/charts"))
+	assert.False(t, IsOCIRepositoryURL("https://github.com/testorg/test-repo"))
+	assert.False(t, IsOCIRepositoryURL("ssh://git@github.com/testorg/test-repo"))
+}
+
+func TestIsSSHRepositoryURL(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		expected bool
+	}{
+		{"ssh://git@github.com/testorg/test-repo", true},
+		{"SSH://git@github.com/testorg/test-repo", true},
+		{"git@github.com:testorg/test-repo.git", true},
+		{"https://github.com/testorg/test-repo", false},
+		{"https://github.com:443/testorg/test-repo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsSSHRepositoryURL(tt.repoURL))
+		})
+	}
+}
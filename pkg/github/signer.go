@@ -0,0 +1,223 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+)
+
+// Signer signs the JWTs a GitHub App authenticates with. It signs SHA-256 digests with PKCS #1
+// v1.5 using the RSA key of the App. *rsa.PrivateKey is the Signer of keys held in memory; other
+// implementations keep the key in a KMS or HSM.
+type Signer interface {
+	crypto.Signer
+}
+
+// ContextSigner is a Signer whose signatures take a context, e.g. because they are requested
+// from a remote service. Its signatures are cancelled with the request they authenticate.
+type ContextSigner interface {
+	Signer
+	SignContext(ctx context.Context, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// signingMethodRS256 signs JWTs with RS256 through a Signer, so the private key does not need
+// to be in memory. The key is a Signer or a signingKey.
+var signingMethodRS256 jwt.SigningMethod = signerSigningMethod{}
+
+// signingKey is a Signer together with the context of the request its signature is for
+type signingKey struct {
+	ctx    context.Context
+	signer Signer
+}
+
+type signerSigningMethod struct{}
+
+func (signerSigningMethod) Alg() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func (signerSigningMethod) Sign(signingString string, key interface{}) ([]byte, error) {
+	ctx := context.Background()
+	signer, ok := key.(Signer)
+	if k, isSigningKey := key.(signingKey); isSigningKey {
+		ctx, signer, ok = k.ctx, k.signer, true
+	}
+	if !ok {
+		return nil, jwt.ErrInvalidKeyType
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+	if contextSigner, ok := signer.(ContextSigner); ok {
+		return contextSigner.SignContext(ctx, rand.Reader, digest[:], crypto.SHA256)
+	}
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func (signerSigningMethod) Verify(signingString string, sig []byte, key interface{}) error {
+	return jwt.SigningMethodRS256.Verify(signingString, sig, key)
+}
+
+// remoteSignerTimeout bounds the requests to a remote signer
+const remoteSignerTimeout = 10 * time.Second
+
+// RemoteSigner signs with a key held by a remote signing service, e.g. a proxy in front of a KMS
+// or HSM. The service serves the PEM encoded public key at GET <url>/public-key and signs at
+// POST <url>/sign, which takes {"algorithm": "RS256", "digest": "<base64>"} and returns
+// {"signature": "<base64>"}.
+type RemoteSigner struct {
+	config     *config.RemoteSignerConfig
+	httpClient *http.Client
+	publicKey  *rsa.PublicKey
+}
+
+// NewRemoteSigner creates a signer for the remote signing service and reads its public key. The
+// service is reached with httpClient, which carries the proxy and TLS settings of the controller;
+// nil uses a client with default settings.
+func NewRemoteSigner(ctx context.Context, cfg *config.RemoteSignerConfig, httpClient *http.Client) (*RemoteSigner, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: remoteSignerTimeout}
+	}
+
+	s := &RemoteSigner{
+		config:     cfg,
+		httpClient: httpClient,
+	}
+
+	publicKey, err := s.readPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.publicKey = publicKey
+
+	return s, nil
+}
+
+// Public returns the public key of the remote key
+func (s *RemoteSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs a SHA-256 digest with the remote key, see SignContext
+func (s *RemoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignContext(context.Background(), rand, digest, opts)
+}
+
+// SignContext signs a SHA-256 digest with the remote key. The request is bounded by
+// remoteSignerTimeout and cancelled with ctx. The signature is verified against the public key, so
+// a signer that switched keys is noticed before GitHub rejects the JWT.
+func (s *RemoteSigner) SignContext(ctx context.Context, _ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("remote signer only signs SHA-256 digests")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"algorithm": "RS256",
+		"digest":    base64.StdEncoding.EncodeToString(digest),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Signature string `json:"signature"`
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteSignerTimeout)
+	defer cancel()
+
+	if err := s.do(ctx, http.MethodPost, "sign", bytes.NewReader(body), func(data []byte) error {
+		return json.Unmarshal(data, &result)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to sign with remote signer: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(result.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature from remote signer: %w", err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(s.publicKey, crypto.SHA256, digest, signature); err != nil {
+		return nil, fmt.Errorf("remote signer returned a signature not matching its public key: %w", err)
+	}
+
+	return signature, nil
+}
+
+// readPublicKey reads the public key of the remote key
+func (s *RemoteSigner) readPublicKey(ctx context.Context) (*rsa.PublicKey, error) {
+	var publicKey *rsa.PublicKey
+	err := s.do(ctx, http.MethodGet, "public-key", nil, func(data []byte) error {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return errors.New("no PEM encoded public key found")
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if publicKey, ok = key.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("public key is a %T, expected an RSA key", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key of remote signer: %w", err)
+	}
+
+	return publicKey, nil
+}
+
+// do sends a request to the remote signer and passes the body of a successful response to decode
+func (s *RemoteSigner) do(ctx context.Context, method, path string, body io.Reader, decode func([]byte) error) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.config.URL, "/")+"/"+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// The token is read on every request, so it can be rotated like a mounted secret
+	if s.config.TokenPath != "" {
+		token, err := os.ReadFile(s.config.TokenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read remote signer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+
+	return decode(data)
+}
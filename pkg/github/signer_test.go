@@ -0,0 +1,173 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSigningServer serves the remote signer protocol for privateKey. signingKey signs, so a
+// mismatching key can be simulated.
+func newSigningServer(t *testing.T, privateKey, signingKey *rsa.PrivateKey, token string) *httptest.Server {
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /public-key", func(w http.ResponseWriter, r *http.Request) {
+		_ = pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	})
+	mux.HandleFunc("POST /sign", func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var body struct {
+			Algorithm string `json:"algorithm"`
+			Digest    string `json:"digest"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "RS256", body.Algorithm)
+
+		digest, err := base64.StdEncoding.DecodeString(body.Digest)
+		require.NoError(t, err)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, signingKey, crypto.SHA256, digest)
+		require.NoError(t, err)
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"signature": base64.StdEncoding.EncodeToString(signature)})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeToken(t *testing.T, token string) string {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte(token+"\n"), 0600))
+	return path
+}
+
+func TestRemoteSigner(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	server := newSigningServer(t, privateKey, privateKey, "secret")
+
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "test-org",
+		RemoteSigner: &config.RemoteSignerConfig{URL: server.URL + "/", TokenPath: writeToken(t, "secret")},
+	}
+	client, err := NewClient(cfg, nil, nil)
+	require.NoError(t, err)
+
+	signer := client.keys.Active()
+	require.IsType(t, &RemoteSigner{}, signer)
+	assert.True(t, privateKey.PublicKey.Equal(signer.Public()))
+	assert.Equal(t, KeyFingerprint(privateKey), KeyFingerprint(signer))
+
+	token, err := client.createJWT(context.Background(), signer)
+	require.NoError(t, err)
+
+	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return &privateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+	assert.True(t, parsedToken.Valid)
+}
+
+func TestRemoteSigner_HTTPConfig(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// The signing server only answers as the proxy, the host of the signer URL does not resolve
+	proxy := newSigningServer(t, privateKey, privateKey, "")
+
+	cfg := &config.GitHubConfig{
+		AppID:        123456,
+		Organization: "test-org",
+		RemoteSigner: &config.RemoteSignerConfig{URL: "http://signer.invalid/"},
+		HTTP:         config.HTTPConfig{ProxyURL: proxy.URL},
+	}
+	client, err := NewClient(cfg, nil, nil)
+	require.NoError(t, err)
+
+	_, err = client.createJWT(context.Background(), client.keys.Active())
+	require.NoError(t, err)
+}
+
+func TestRemoteSigner_Errors(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("payload"))
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server := newSigningServer(t, privateKey, privateKey, "secret")
+		signer, err := NewRemoteSigner(context.Background(), &config.RemoteSignerConfig{URL: server.URL, TokenPath: writeToken(t, "wrong")}, nil)
+		require.NoError(t, err)
+
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		assert.ErrorContains(t, err, "401 Unauthorized")
+	})
+
+	t.Run("signature from another key", func(t *testing.T) {
+		server := newSigningServer(t, privateKey, otherKey, "")
+		signer, err := NewRemoteSigner(context.Background(), &config.RemoteSignerConfig{URL: server.URL}, nil)
+		require.NoError(t, err)
+
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		assert.ErrorContains(t, err, "not matching its public key")
+	})
+
+	t.Run("unsupported hash", func(t *testing.T) {
+		server := newSigningServer(t, privateKey, privateKey, "")
+		signer, err := NewRemoteSigner(context.Background(), &config.RemoteSignerConfig{URL: server.URL}, nil)
+		require.NoError(t, err)
+
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA512)
+		assert.ErrorContains(t, err, "only signs SHA-256 digests")
+	})
+
+	t.Run("cancelled request", func(t *testing.T) {
+		server := newSigningServer(t, privateKey, privateKey, "")
+		signer, err := NewRemoteSigner(context.Background(), &config.RemoteSignerConfig{URL: server.URL}, nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = signer.SignContext(ctx, rand.Reader, digest[:], crypto.SHA256)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		// JWTs are signed with the context of the request they authenticate
+		client, err := NewClient(&config.GitHubConfig{AppID: 123456, Organization: "test-org", RemoteSigner: &config.RemoteSignerConfig{URL: server.URL}}, nil, nil)
+		require.NoError(t, err)
+		_, err = client.createJWT(ctx, client.keys.Active())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("no public key", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		_, err := NewRemoteSigner(context.Background(), &config.RemoteSignerConfig{URL: server.URL}, nil)
+		assert.ErrorContains(t, err, "failed to read public key of remote signer")
+	})
+}
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newTransport creates the transport of requests to the GitHub API, sending them through the
+// configured proxy and TLS settings. Requests are timed like the ones sent with apiTransport.
+func newTransport(cfg config.HTTPConfig) (http.RoundTripper, error) {
+	transport, err := newHTTPTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return promhttp.InstrumentRoundTripperDuration(apiRequestDuration, transport), nil
+}
+
+// newHTTPTransport creates a transport sending requests through the configured proxy and TLS
+// settings, for services reached like the GitHub API, e.g. a remote signer
+func newHTTPTransport(cfg config.HTTPConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		bundle, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		// The certificate is read for every new connection, so a renewed certificate is
+		// presented without a restart
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// baseTransport returns the transport of requests to the GitHub API
+func (c *Client) baseTransport() http.RoundTripper {
+	if c.transport != nil {
+		return c.transport
+	}
+	return apiTransport
+}
+
+// httpClient creates an HTTP client sending requests to the GitHub API with transport, bounded
+// by the configured timeout
+func (c *Client) httpClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.timeout,
+	}
+}
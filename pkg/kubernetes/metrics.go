@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	managedSecretsDesc = prometheus.NewDesc(
+		"flux_extension_controller_managed_secrets",
+		"Number of secrets managed by the controller.",
+		nil, nil,
+	)
+
+	tokenExpiryDesc = prometheus.NewDesc(
+		"flux_extension_controller_token_expiry_seconds",
+		"Seconds until the token stored in a managed secret expires. Negative once it has expired.",
+		[]string{"namespace", "name"}, nil,
+	)
+)
+
+// managedSecretMetrics tracks the token expiry of every managed secret
+var managedSecretMetrics = newSecretCollector()
+
+func init() {
+	metrics.Registry.MustRegister(managedSecretMetrics)
+}
+
+// secretCollector exports the managed secrets and the time left until their tokens expire.
+// The time left is computed when the metrics are scraped.
+type secretCollector struct {
+	mu       sync.Mutex
+	expiries map[types.NamespacedName]time.Time
+	now      func() time.Time
+}
+
+// newSecretCollector creates an empty secret collector
+func newSecretCollector() *secretCollector {
+	return &secretCollector{
+		expiries: make(map[types.NamespacedName]time.Time),
+		now:      time.Now,
+	}
+}
+
+// observe records the token expiry of a managed secret
+func (c *secretCollector) observe(namespace, name string, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expiries[types.NamespacedName{Namespace: namespace, Name: name}] = expiry
+}
+
+// forget stops tracking the token expiry of a managed secret that is going away
+func (c *secretCollector) forget(namespace, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.expiries, types.NamespacedName{Namespace: namespace, Name: name})
+}
+
+// reset replaces the tracked secrets with the given token expiries
+func (c *secretCollector) reset(expiries map[types.NamespacedName]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expiries = expiries
+}
+
+// Describe implements prometheus.Collector
+func (c *secretCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedSecretsDesc
+	ch <- tokenExpiryDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *secretCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	ch <- prometheus.MustNewConstMetric(managedSecretsDesc, prometheus.GaugeValue, float64(len(c.expiries)))
+	for key, expiry := range c.expiries {
+		ch <- prometheus.MustNewConstMetric(tokenExpiryDesc, prometheus.GaugeValue,
+			expiry.Sub(now).Seconds(), key.Namespace, key.Name)
+	}
+}
+
+// RecordManagedSecrets replaces the secrets exported as metrics with the managed secrets
+// among the given ones. Secrets without a readable token expiry are left out.
+func (sm *SecretManager) RecordManagedSecrets(secrets []corev1.Secret) {
+	expiries := make(map[types.NamespacedName]time.Time)
+	for i := range secrets {
+		secret := &secrets[i]
+		if !sm.IsSecretManagedByController(secret) {
+			continue
+		}
+
+		expiry, err := sm.GetTokenExpiry(secret)
+		if err != nil {
+			continue
+		}
+		expiries[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = expiry
+	}
+
+	managedSecretMetrics.reset(expiries)
+}
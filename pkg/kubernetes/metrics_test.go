@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSecretCollector_Collect(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	collector := newSecretCollector()
+	collector.now = func() time.Time { return now }
+
+	collector.observe("team-a", "repo-auth", now.Add(30*time.Minute))
+	collector.observe("team-b", "repo-auth", now.Add(-time.Minute))
+
+	expected := `
+# HELP flux_extension_controller_managed_secrets Number of secrets managed by the controller.
+# TYPE flux_extension_controller_managed_secrets gauge
+flux_extension_controller_managed_secrets 2
+# HELP flux_extension_controller_token_expiry_seconds Seconds until the token stored in a managed secret expires. Negative once it has expired.
+# TYPE flux_extension_controller_token_expiry_seconds gauge
+flux_extension_controller_token_expiry_seconds{name="repo-auth",namespace="team-a"} 1800
+flux_extension_controller_token_expiry_seconds{name="repo-auth",namespace="team-b"} -60
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func TestSecretManager_RecordManagedSecrets(t *testing.T) {
+	sm := &SecretManager{}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	secrets := []corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "managed",
+				Namespace: "default",
+				Annotations: map[string]string{
+					AnnotationManagedBy:   "flux-extension-controller",
+					AnnotationTokenExpiry: expiresAt.Format(time.RFC3339),
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unmanaged",
+				Namespace: "default",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "no-expiry",
+				Namespace: "default",
+				Annotations: map[string]string{
+					AnnotationManagedBy: "flux-extension-controller",
+				},
+			},
+		},
+	}
+
+	managedSecretMetrics.observe("default", "deleted", expiresAt)
+	sm.RecordManagedSecrets(secrets)
+
+	managedSecretMetrics.mu.Lock()
+	defer managedSecretMetrics.mu.Unlock()
+	require.Len(t, managedSecretMetrics.expiries, 1)
+	expiry := managedSecretMetrics.expiries[types.NamespacedName{Namespace: "default", Name: "managed"}]
+	assert.True(t, expiresAt.Equal(expiry))
+}
+
+func TestSecretManager_DeleteSecret_ForgetsExpiry(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "repo-auth",
+			Namespace:  "forget-test",
+			Finalizers: []string{FinalizerRevokeToken},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+	sm := NewSecretManager(fakeClient)
+	key := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+
+	managedSecretMetrics.observe(secret.Namespace, secret.Name, time.Now().Add(time.Hour))
+	require.NoError(t, sm.DeleteSecret(context.Background(), secret))
+
+	managedSecretMetrics.mu.Lock()
+	defer managedSecretMetrics.mu.Unlock()
+	assert.NotContains(t, managedSecretMetrics.expiries, key)
+}
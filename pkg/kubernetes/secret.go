@@ -1,8 +1,15 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -11,8 +18,10 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/google/go-github/v76/github"
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
 )
 
 const (
@@ -27,8 +36,69 @@ const (
 
 	// AnnotationRepositoryURL stores the repository URL
 	AnnotationRepositoryURL = "flux-extension-controller.nrfcloud.com/repository-url"
+
+	// AnnotationPermissions requests token permissions on a GitRepository, e.g. "contents:read,metadata:read",
+	// and records the permissions granted to the token on its secret
+	AnnotationPermissions = "flux-extension-controller.nrfcloud.com/permissions"
+
+	// AnnotationRepositories requests access to additional repositories on a GitRepository, e.g. "charts,infra",
+	// and records the repositories the token was issued for on its secret
+	AnnotationRepositories = "flux-extension-controller.nrfcloud.com/repositories"
+
+	// AnnotationDeployKeyID stores the ID of the deploy key whose private key is in the secret
+	AnnotationDeployKeyID = "flux-extension-controller.nrfcloud.com/deploy-key-id"
+
+	// AnnotationAutoSecretRef opts a GitRepository without secretRef in or out of a generated
+	// secretRef, overriding the autoSecretRef setting of the controller
+	AnnotationAutoSecretRef = "flux-extension-controller.nrfcloud.com/auto-secret-ref"
+
+	// AnnotationSecretRefReverted marks a GitRepository whose generated secretRef was removed, with
+	// the name of the generated secret, so the secretRef is not generated again
+	AnnotationSecretRefReverted = "flux-extension-controller.nrfcloud.com/secret-ref-reverted"
+
+	// AnnotationPushSecret names the secret receiving the push token of an ImageUpdateAutomation
+	AnnotationPushSecret = "flux-extension-controller.nrfcloud.com/push-secret"
+
+	// FinalizerRevokeToken keeps GitRepositories and their secrets around until the token is revoked
+	// or the deploy key removed
+	FinalizerRevokeToken = "flux-extension-controller.nrfcloud.com/revoke-token"
+
+	// IndexTokenFingerprint is the field index of managed secrets by the fingerprint of the token
+	// they hold, see IndexSecretTokenFingerprint
+	IndexTokenFingerprint = "tokenFingerprint"
 )
 
+const (
+	// ImageAutomationGroup is the API group of the Flux image automation resources
+	ImageAutomationGroup = "image.toolkit.fluxcd.io"
+
+	// ImageUpdateAutomationKind is the kind of the Flux automations pushing image updates to Git
+	ImageUpdateAutomationKind = "ImageUpdateAutomation"
+
+	// NotificationGroup is the API group of the Flux notification resources
+	NotificationGroup = "notification.toolkit.fluxcd.io"
+
+	// ProviderKind is the kind of the Flux notification providers
+	ProviderKind = "Provider"
+)
+
+// DeployKey is an SSH key pair registered as a read-only deploy key of a repository
+type DeployKey struct {
+	ID int64
+
+	// PrivateKey is the PEM encoded private key
+	PrivateKey []byte
+
+	// PublicKey is the public key in authorized_keys format
+	PublicKey []byte
+
+	// KnownHosts lists the SSH host keys of the GitHub host
+	KnownHosts []byte
+
+	// RotateAt is when the key is replaced by a new one
+	RotateAt time.Time
+}
+
 // SecretManager handles Kubernetes secret operations for Git repositories
 type SecretManager struct {
 	client client.Client
@@ -48,6 +118,163 @@ func (sm *SecretManager) CreateOrUpdateSecret(
 	token *github.InstallationToken,
 	repositoryURL string,
 	owner metav1.Object,
+) error {
+	return sm.createOrUpdate(ctx, namespace, name, SecretTypeGitRepository, token.GetExpiresAt().Time, repositoryURL, owner, func(secret *corev1.Secret) {
+		secret.Data["username"] = []byte("git")
+		secret.Data["password"] = []byte(token.GetToken())
+		for _, key := range []string{"identity", "identity.pub", "known_hosts"} {
+			delete(secret.Data, key)
+		}
+		delete(secret.Annotations, AnnotationDeployKeyID)
+
+		if permissions := ghclient.PermissionsMap(token.GetPermissions()); len(permissions) > 0 {
+			secret.Annotations[AnnotationPermissions] = ghclient.FormatPermissions(permissions)
+		} else {
+			delete(secret.Annotations, AnnotationPermissions)
+		}
+		if repositories := ghclient.RepositoryNames(token); len(repositories) > 0 {
+			secret.Annotations[AnnotationRepositories] = strings.Join(repositories, ",")
+		} else {
+			delete(secret.Annotations, AnnotationRepositories)
+		}
+	})
+}
+
+// CreateOrUpdateDeployKeySecret creates or updates a Git repository secret with the private key of a
+// deploy key, in the format source-controller expects for SSH authentication
+func (sm *SecretManager) CreateOrUpdateDeployKeySecret(
+	ctx context.Context,
+	namespace, name string,
+	key *DeployKey,
+	repositoryURL string,
+	owner metav1.Object,
+) error {
+	// The rotation time takes the place of the token expiry, so keys are rotated like tokens are refreshed
+	return sm.createOrUpdate(ctx, namespace, name, SecretTypeGitRepository, key.RotateAt, repositoryURL, owner, func(secret *corev1.Secret) {
+		secret.Data["identity"] = key.PrivateKey
+		secret.Data["identity.pub"] = key.PublicKey
+		secret.Data["known_hosts"] = key.KnownHosts
+		delete(secret.Data, "username")
+		delete(secret.Data, "password")
+		secret.Annotations[AnnotationDeployKeyID] = strconv.FormatInt(key.ID, 10)
+		delete(secret.Annotations, AnnotationPermissions)
+		delete(secret.Annotations, AnnotationRepositories)
+	})
+}
+
+// registryUsername is the user name the container registry expects along with an installation token
+const registryUsername = "x-access-token"
+
+// dockerConfig is the content of a kubernetes.io/dockerconfigjson secret
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+// dockerConfigAuth holds the credentials of a single registry
+type dockerConfigAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// CreateOrUpdateRegistrySecret creates or updates a docker config secret holding the package token
+// as the credentials of the registry of an OCI repository, e.g. oci://ghcr.io/acme-corp/charts
+func (sm *SecretManager) CreateOrUpdateRegistrySecret(
+	ctx context.Context,
+	namespace, name string,
+	token *github.InstallationToken,
+	repositoryURL string,
+	owner metav1.Object,
+) error {
+	ref, err := ghclient.ParseRepositoryRef(repositoryURL)
+	if err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(dockerConfig{Auths: map[string]dockerConfigAuth{
+		ref.Host: {
+			Username: registryUsername,
+			Password: token.GetToken(),
+			Auth:     base64.StdEncoding.EncodeToString([]byte(registryUsername + ":" + token.GetToken())),
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to encode docker config: %w", err)
+	}
+
+	return sm.createOrUpdate(ctx, namespace, name, corev1.SecretTypeDockerConfigJson, token.GetExpiresAt().Time, repositoryURL, owner, func(secret *corev1.Secret) {
+		secret.Data = map[string][]byte{corev1.DockerConfigJsonKey: config}
+		if permissions := ghclient.PermissionsMap(token.GetPermissions()); len(permissions) > 0 {
+			secret.Annotations[AnnotationPermissions] = ghclient.FormatPermissions(permissions)
+		} else {
+			delete(secret.Annotations, AnnotationPermissions)
+		}
+		delete(secret.Annotations, AnnotationRepositories)
+		delete(secret.Annotations, AnnotationDeployKeyID)
+	})
+}
+
+// ProviderTokenKey is the key of the token in the secret of a notification Provider
+const ProviderTokenKey = "token"
+
+// CreateOrUpdateProviderSecret creates or updates the secret of a notification Provider with the
+// GitHub token under the token key, in the format notification-controller expects
+func (sm *SecretManager) CreateOrUpdateProviderSecret(
+	ctx context.Context,
+	namespace, name string,
+	token *github.InstallationToken,
+	repositoryURL string,
+	owner metav1.Object,
+) error {
+	return sm.createOrUpdate(ctx, namespace, name, corev1.SecretTypeOpaque, token.GetExpiresAt().Time, repositoryURL, owner, func(secret *corev1.Secret) {
+		secret.Data = map[string][]byte{ProviderTokenKey: []byte(token.GetToken())}
+		if permissions := ghclient.PermissionsMap(token.GetPermissions()); len(permissions) > 0 {
+			secret.Annotations[AnnotationPermissions] = ghclient.FormatPermissions(permissions)
+		} else {
+			delete(secret.Annotations, AnnotationPermissions)
+		}
+		delete(secret.Annotations, AnnotationRepositories)
+		delete(secret.Annotations, AnnotationDeployKeyID)
+	})
+}
+
+// IsProviderSecret checks if the secret holds the token of a notification Provider
+func (sm *SecretManager) IsProviderSecret(secret *corev1.Secret) bool {
+	_, ok := secret.Data[ProviderTokenKey]
+	return ok
+}
+
+// IsRegistrySecret checks if the secret holds registry credentials rather than Git credentials
+func (sm *SecretManager) IsRegistrySecret(secret *corev1.Secret) bool {
+	return secret.Type == corev1.SecretTypeDockerConfigJson
+}
+
+// IsPushSecret checks if the secret holds the push token of an ImageUpdateAutomation
+func (sm *SecretManager) IsPushSecret(secret *corev1.Secret) bool {
+	ownerRef := metav1.GetControllerOf(secret)
+	return ownerRef != nil && ownerRef.Kind == ImageUpdateAutomationKind &&
+		strings.HasPrefix(ownerRef.APIVersion, ImageAutomationGroup+"/")
+}
+
+// GetDeployKeyID returns the ID of the deploy key stored in the secret, or 0 for token secrets
+func (sm *SecretManager) GetDeployKeyID(secret *corev1.Secret) int64 {
+	id, err := strconv.ParseInt(secret.Annotations[AnnotationDeployKeyID], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// createOrUpdate creates or updates a managed secret of the given type expiring at expiresAt.
+// mutate sets the credentials on the secret.
+func (sm *SecretManager) createOrUpdate(
+	ctx context.Context,
+	namespace, name string,
+	secretType corev1.SecretType,
+	expiresAt time.Time,
+	repositoryURL string,
+	owner metav1.Object,
+	mutate func(secret *corev1.Secret),
 ) error {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -58,23 +285,30 @@ func (sm *SecretManager) CreateOrUpdateSecret(
 
 	op, err := controllerutil.CreateOrUpdate(ctx, sm.client, secret, func() error {
 		// Set secret type
-		secret.Type = SecretTypeGitRepository
+		secret.Type = secretType
 
 		// Set data
 		if secret.Data == nil {
 			secret.Data = make(map[string][]byte)
 		}
-		secret.Data["username"] = []byte("git")
-		secret.Data["password"] = []byte(token.GetToken())
 
 		// Set annotations
 		if secret.Annotations == nil {
 			secret.Annotations = make(map[string]string)
 		}
 		secret.Annotations[AnnotationManagedBy] = "flux-extension-controller"
-		secret.Annotations[AnnotationTokenExpiry] = token.GetExpiresAt().Format(time.RFC3339)
+		secret.Annotations[AnnotationTokenExpiry] = expiresAt.Format(time.RFC3339)
 		secret.Annotations[AnnotationRepositoryURL] = repositoryURL
 
+		mutate(secret)
+
+		// Revoke the token or deploy key before the secret is deleted
+		controllerutil.AddFinalizer(secret, FinalizerRevokeToken)
+
+		// Drop owner references pointing at the secret itself. Earlier token refreshes
+		// set them, and they would keep the real owner from becoming the controller.
+		removeSelfOwnerReferences(secret)
+
 		// Set owner reference
 		return controllerutil.SetControllerReference(owner, secret, sm.client.Scheme())
 	})
@@ -83,10 +317,13 @@ func (sm *SecretManager) CreateOrUpdateSecret(
 		return fmt.Errorf("failed to create or update secret: %w", err)
 	}
 
+	managedSecretMetrics.observe(namespace, name, expiresAt)
+
+	logger := log.FromContext(ctx).WithValues("secret", fmt.Sprintf("%s/%s", namespace, name))
 	if op == controllerutil.OperationResultCreated {
-		fmt.Printf("Created secret %s/%s\n", namespace, name)
+		logger.Info("Created secret")
 	} else if op == controllerutil.OperationResultUpdated {
-		fmt.Printf("Updated secret %s/%s\n", namespace, name)
+		logger.Info("Updated secret")
 	}
 
 	return nil
@@ -177,3 +414,142 @@ func (sm *SecretManager) ValidateSecretOwnership(ctx context.Context, namespace,
 
 	return nil
 }
+
+// GetToken returns the token stored in the secret
+func (sm *SecretManager) GetToken(secret *corev1.Secret) string {
+	return string(secretToken(secret))
+}
+
+// secretToken returns the token stored in a Git repository or registry secret
+func secretToken(secret *corev1.Secret) []byte {
+	if token, ok := secret.Data[ProviderTokenKey]; ok {
+		return token
+	}
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return secret.Data["password"]
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil
+	}
+	for _, auth := range config.Auths {
+		return []byte(auth.Password)
+	}
+	return nil
+}
+
+// IndexSecretTokenFingerprint extracts the fingerprint of the token held by a managed secret, for
+// the IndexTokenFingerprint field index of the cache
+func IndexSecretTokenFingerprint(obj client.Object) []string {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Annotations[AnnotationManagedBy] != "flux-extension-controller" {
+		return nil
+	}
+
+	token := secretToken(secret)
+	if len(token) == 0 {
+		return nil
+	}
+	return []string{tokenFingerprint(token)}
+}
+
+// tokenFingerprint identifies a token without revealing it in the index of the cache
+func tokenFingerprint(token []byte) string {
+	sum := sha256.Sum256(token)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsTokenShared checks if another managed secret holds the same token as the given secret.
+// Installation tokens are cached and handed to every secret of the same repository. The secrets
+// are looked up through the IndexTokenFingerprint field index.
+func (sm *SecretManager) IsTokenShared(ctx context.Context, secret *corev1.Secret) (bool, error) {
+	token := secretToken(secret)
+	if len(token) == 0 {
+		return false, nil
+	}
+
+	secretList := &corev1.SecretList{}
+	if err := sm.client.List(ctx, secretList, client.MatchingFields{IndexTokenFingerprint: tokenFingerprint(token)}); err != nil {
+		return false, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	for i := range secretList.Items {
+		other := &secretList.Items[i]
+		if other.Namespace == secret.Namespace && other.Name == secret.Name {
+			continue
+		}
+		if !other.DeletionTimestamp.IsZero() || !sm.IsSecretManagedByController(other) {
+			continue
+		}
+		if bytes.Equal(secretToken(other), token) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ListControlledSecrets returns the managed secrets in the namespace of the owner that it controls,
+// whichever name the owner currently references
+func (sm *SecretManager) ListControlledSecrets(ctx context.Context, owner metav1.Object) ([]corev1.Secret, error) {
+	secretList := &corev1.SecretList{}
+	if err := sm.client.List(ctx, secretList, client.InNamespace(owner.GetNamespace())); err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	var secrets []corev1.Secret
+	for _, secret := range secretList.Items {
+		if sm.IsSecretManagedByController(&secret) && metav1.IsControlledBy(&secret, owner) {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets, nil
+}
+
+// RemoveFinalizer removes the token revocation finalizer, so the secret can be deleted, and stops
+// exporting its token expiry
+func (sm *SecretManager) RemoveFinalizer(ctx context.Context, secret *corev1.Secret) error {
+	if !controllerutil.ContainsFinalizer(secret, FinalizerRevokeToken) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(secret.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(secret, FinalizerRevokeToken)
+	if err := client.IgnoreNotFound(sm.client.Patch(ctx, secret, patch)); err != nil {
+		return fmt.Errorf("failed to remove finalizer from secret: %w", err)
+	}
+	managedSecretMetrics.forget(secret.Namespace, secret.Name)
+
+	return nil
+}
+
+// DeleteSecret removes the token revocation finalizer from the secret and deletes it
+func (sm *SecretManager) DeleteSecret(ctx context.Context, secret *corev1.Secret) error {
+	if err := sm.RemoveFinalizer(ctx, secret); err != nil {
+		return err
+	}
+
+	if err := sm.client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	managedSecretMetrics.forget(secret.Namespace, secret.Name)
+
+	return nil
+}
+
+// removeSelfOwnerReferences removes owner references that point at the secret itself
+func removeSelfOwnerReferences(secret *corev1.Secret) {
+	if secret.UID == "" {
+		return
+	}
+
+	ownerRefs := make([]metav1.OwnerReference, 0, len(secret.OwnerReferences))
+	for _, ownerRef := range secret.OwnerReferences {
+		if ownerRef.UID != secret.UID {
+			ownerRefs = append(ownerRefs, ownerRef)
+		}
+	}
+	secret.OwnerReferences = ownerRefs
+}
@@ -83,6 +83,215 @@ func TestSecretManager_CreateOrUpdateSecret(t *testing.T) {
 	assert.Equal(t, newExpiresAt.Format(time.RFC3339), secret.Annotations[AnnotationTokenExpiry])
 }
 
+func TestSecretManager_CreateOrUpdateSecret_RecordsTokenScope(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	ctx := context.Background()
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-owner", Namespace: "test-namespace", UID: "test-uid"},
+	}
+
+	token := &github.InstallationToken{
+		Token:     github.String("scoped-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		Permissions: &github.InstallationPermissions{
+			Contents: github.String("read"),
+			Metadata: github.String("read"),
+		},
+		Repositories: []*github.Repository{
+			{Name: github.String("test-repo")},
+			{Name: github.String("charts")},
+		},
+	}
+	err := secretManager.CreateOrUpdateSecret(ctx, "test-namespace", "test-secret", token, "https://github.com/nrfcloud/test-repo", owner)
+	require.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.Equal(t, "contents:read,metadata:read", secret.Annotations[AnnotationPermissions])
+	assert.Equal(t, "charts,test-repo", secret.Annotations[AnnotationRepositories])
+
+	// A token without reported permissions or repositories drops the annotations
+	token.Permissions = nil
+	token.Repositories = nil
+	err = secretManager.CreateOrUpdateSecret(ctx, "test-namespace", "test-secret", token, "https://github.com/nrfcloud/test-repo", owner)
+	require.NoError(t, err)
+
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.NotContains(t, secret.Annotations, AnnotationPermissions)
+	assert.NotContains(t, secret.Annotations, AnnotationRepositories)
+}
+
+func TestSecretManager_CreateOrUpdateDeployKeySecret(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	ctx := context.Background()
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-owner", Namespace: "test-namespace", UID: "test-uid"},
+	}
+	repositoryURL := "ssh://git@github.com/nrfcloud/test-repo"
+
+	// Start from a token secret to check that switching modes drops the token
+	token := &github.InstallationToken{
+		Token:     github.String("test-token-123"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}
+	require.NoError(t, secretManager.CreateOrUpdateSecret(ctx, "test-namespace", "test-secret", token, repositoryURL, owner))
+
+	rotateAt := time.Now().Add(30 * 24 * time.Hour)
+	key := &DeployKey{
+		ID:         1234,
+		PrivateKey: []byte("private"),
+		PublicKey:  []byte("ssh-ed25519 AAAA"),
+		KnownHosts: []byte("github.com ssh-ed25519 AAAA\n"),
+		RotateAt:   rotateAt,
+	}
+	require.NoError(t, secretManager.CreateOrUpdateDeployKeySecret(ctx, "test-namespace", "test-secret", key, repositoryURL, owner))
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.Equal(t, map[string][]byte{
+		"identity":     []byte("private"),
+		"identity.pub": []byte("ssh-ed25519 AAAA"),
+		"known_hosts":  []byte("github.com ssh-ed25519 AAAA\n"),
+	}, secret.Data)
+	assert.Equal(t, rotateAt.Format(time.RFC3339), secret.Annotations[AnnotationTokenExpiry])
+	assert.Equal(t, int64(1234), secretManager.GetDeployKeyID(secret))
+	assert.Contains(t, secret.Finalizers, FinalizerRevokeToken)
+
+	// Token secrets carry no deploy key
+	require.NoError(t, secretManager.CreateOrUpdateSecret(ctx, "test-namespace", "test-secret", token, repositoryURL, owner))
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.Equal(t, int64(0), secretManager.GetDeployKeyID(secret))
+	assert.NotContains(t, secret.Data, "identity")
+}
+
+func TestSecretManager_CreateOrUpdateRegistrySecret(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithIndex(&corev1.Secret{}, IndexTokenFingerprint, IndexSecretTokenFingerprint).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	ctx := context.Background()
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-owner", Namespace: "test-namespace", UID: "test-uid"},
+	}
+	repositoryURL := "oci://ghcr.io/nrfcloud/charts"
+
+	expiresAt := time.Now().Add(time.Hour)
+	token := &github.InstallationToken{
+		Token:       github.String("package-token"),
+		ExpiresAt:   &github.Timestamp{Time: expiresAt},
+		Permissions: &github.InstallationPermissions{Packages: github.String("read")},
+	}
+	err := secretManager.CreateOrUpdateRegistrySecret(ctx, "test-namespace", "test-secret", token, repositoryURL, owner)
+	require.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.JSONEq(t, `{"auths":{"ghcr.io":{
+		"username":"x-access-token",
+		"password":"package-token",
+		"auth":"eC1hY2Nlc3MtdG9rZW46cGFja2FnZS10b2tlbg=="
+	}}}`, string(secret.Data[corev1.DockerConfigJsonKey]))
+	assert.Equal(t, expiresAt.Format(time.RFC3339), secret.Annotations[AnnotationTokenExpiry])
+	assert.Equal(t, repositoryURL, secret.Annotations[AnnotationRepositoryURL])
+	assert.Equal(t, "packages:read", secret.Annotations[AnnotationPermissions])
+	assert.Contains(t, secret.Finalizers, FinalizerRevokeToken)
+
+	assert.True(t, secretManager.IsRegistrySecret(secret))
+	assert.Equal(t, "package-token", secretManager.GetToken(secret))
+
+	// Another registry secret of the same owner holds the same token
+	err = secretManager.CreateOrUpdateRegistrySecret(ctx, "test-namespace", "other-secret", token, repositoryURL, owner)
+	require.NoError(t, err)
+
+	shared, err := secretManager.IsTokenShared(ctx, secret)
+	require.NoError(t, err)
+	assert.True(t, shared)
+}
+
+func TestSecretManager_CreateOrUpdateProviderSecret(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	ctx := context.Background()
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-owner", Namespace: "test-namespace", UID: "test-uid"},
+	}
+	repositoryURL := "https://github.com/nrfcloud/app"
+
+	token := &github.InstallationToken{
+		Token:       github.String("status-token"),
+		ExpiresAt:   &github.Timestamp{Time: time.Now().Add(time.Hour)},
+		Permissions: &github.InstallationPermissions{Statuses: github.String("write")},
+	}
+	err := secretManager.CreateOrUpdateProviderSecret(ctx, "test-namespace", "test-secret", token, repositoryURL, owner)
+	require.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret))
+	assert.Equal(t, corev1.SecretTypeOpaque, secret.Type)
+	assert.Equal(t, map[string][]byte{"token": []byte("status-token")}, secret.Data)
+	assert.Equal(t, "statuses:write", secret.Annotations[AnnotationPermissions])
+	assert.Contains(t, secret.Finalizers, FinalizerRevokeToken)
+
+	assert.True(t, secretManager.IsProviderSecret(secret))
+	assert.False(t, secretManager.IsRegistrySecret(secret))
+	assert.Equal(t, "status-token", secretManager.GetToken(secret))
+}
+
+func TestSecretManager_CreateOrUpdateSecret_RemovesSelfOwnerReference(t *testing.T) {
+	s := scheme.Scheme
+
+	// A secret whose controller reference points at itself, as earlier token refreshes left it
+	isController := true
+	existingSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "test-namespace",
+			UID:       "secret-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "v1",
+					Kind:       "Secret",
+					Name:       "test-secret",
+					UID:        "secret-uid",
+					Controller: &isController,
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(existingSecret).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-owner",
+			Namespace: "test-namespace",
+			UID:       "owner-uid",
+		},
+	}
+
+	token := &github.InstallationToken{
+		Token:     github.String("test-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}
+
+	ctx := context.Background()
+	err := secretManager.CreateOrUpdateSecret(ctx, "test-namespace", "test-secret", token, "https://github.com/nrfcloud/test-repo", owner)
+	require.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	err = fakeClient.Get(ctx, types.NamespacedName{Namespace: "test-namespace", Name: "test-secret"}, secret)
+	require.NoError(t, err)
+
+	require.Len(t, secret.OwnerReferences, 1)
+	assert.Equal(t, owner.UID, secret.OwnerReferences[0].UID)
+}
+
 func TestSecretManager_GetSecret(t *testing.T) {
 	// Set up fake client with existing secret
 	s := scheme.Scheme
@@ -172,6 +381,32 @@ func TestSecretManager_IsSecretManagedByController(t *testing.T) {
 	}
 }
 
+func TestIndexSecretTokenFingerprint(t *testing.T) {
+	managed := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{AnnotationManagedBy: "flux-extension-controller"},
+		},
+		Data: map[string][]byte{"password": []byte("ghs_token")},
+	}
+	provider := managed.DeepCopy()
+	provider.Data = map[string][]byte{ProviderTokenKey: []byte("ghs_token")}
+
+	// Secrets holding the same token share a fingerprint that does not reveal the token
+	fingerprints := IndexSecretTokenFingerprint(managed)
+	require.Len(t, fingerprints, 1)
+	assert.NotContains(t, fingerprints[0], "ghs_token")
+	assert.Equal(t, fingerprints, IndexSecretTokenFingerprint(provider))
+
+	// Secrets maintained by hand and secrets without a token are not indexed
+	unmanaged := managed.DeepCopy()
+	unmanaged.Annotations = nil
+	assert.Empty(t, IndexSecretTokenFingerprint(unmanaged))
+
+	empty := managed.DeepCopy()
+	empty.Data = nil
+	assert.Empty(t, IndexSecretTokenFingerprint(empty))
+}
+
 func TestSecretManager_GetTokenExpiry(t *testing.T) {
 	secretManager := NewSecretManager(nil)
 
@@ -405,3 +640,19 @@ func TestSecretManager_ValidateSecretOwnership(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretManager_RemoveFinalizer_SecretGone(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	secretManager := NewSecretManager(fakeClient)
+
+	// The secret was deleted after it was read
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-secret",
+			Namespace:  "test-namespace",
+			Finalizers: []string{FinalizerRevokeToken},
+		},
+	}
+
+	assert.NoError(t, secretManager.RemoveFinalizer(context.Background(), secret))
+}
@@ -0,0 +1,125 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+)
+
+// DeployKeyIssuer generates SSH key pairs, registers them as read-only deploy keys and writes
+// them to secrets
+type DeployKeyIssuer struct {
+	githubClient     github.GitHubClient
+	secretManager    *kubernetes.SecretManager
+	rotationInterval time.Duration
+}
+
+// NewDeployKeyIssuer creates a deploy key issuer rotating keys after rotationInterval
+func NewDeployKeyIssuer(githubClient github.GitHubClient, secretManager *kubernetes.SecretManager, rotationInterval time.Duration) *DeployKeyIssuer {
+	if rotationInterval <= 0 {
+		rotationInterval = config.DefaultDeployKeyRotation
+	}
+
+	return &DeployKeyIssuer{
+		githubClient:     githubClient,
+		secretManager:    secretManager,
+		rotationInterval: rotationInterval,
+	}
+}
+
+// Issue registers a new deploy key for the repository and writes it to the secret. The deploy
+// key previously stored in the secret is removed from the repository.
+func (i *DeployKeyIssuer) Issue(ctx context.Context, namespace, name, repoURL string, owner metav1.Object) (*kubernetes.DeployKey, error) {
+	logger := log.FromContext(ctx).WithValues("secret", fmt.Sprintf("%s/%s", namespace, name))
+
+	var previousID int64
+	secret, err := i.secretManager.GetSecret(ctx, namespace, name)
+	if err == nil {
+		previousID = i.secretManager.GetDeployKeyID(secret)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	knownHosts, err := i.githubClient.KnownHosts(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	title := fmt.Sprintf("flux-extension-controller %s/%s", namespace, name)
+	privateKey, publicKey, err := generateKeyPair(title)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := i.githubClient.RegisterDeployKey(ctx, repoURL, title, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &kubernetes.DeployKey{
+		ID:         id,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		KnownHosts: []byte(strings.Join(knownHosts, "\n") + "\n"),
+		RotateAt:   time.Now().Add(i.rotationInterval),
+	}
+
+	if err := i.secretManager.CreateOrUpdateDeployKeySecret(ctx, namespace, name, key, repoURL, owner); err != nil {
+		// Don't leave a key behind that nobody holds
+		if deleteErr := i.githubClient.DeleteDeployKey(ctx, repoURL, id); deleteErr != nil {
+			logger.Error(deleteErr, "Failed to delete unused deploy key", "deployKeyID", id)
+		}
+		return nil, err
+	}
+
+	if previousID != 0 && previousID != id {
+		if err := i.githubClient.DeleteDeployKey(ctx, repoURL, previousID); err != nil {
+			// The key no longer grants anything once it's gone from the secret, so this is not fatal
+			logger.Error(err, "Failed to delete replaced deploy key", "deployKeyID", previousID)
+		}
+	}
+
+	return key, nil
+}
+
+// generateKeyPair generates an ed25519 key pair. The private key is PEM encoded and the public
+// key is in authorized_keys format.
+func generateKeyPair(comment string) ([]byte, []byte, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	// The SSH wire format of an ed25519 public key is the key type followed by the key,
+	// each prefixed with its length
+	var wire bytes.Buffer
+	for _, field := range [][]byte{[]byte("ssh-ed25519"), publicKey} {
+		_ = binary.Write(&wire, binary.BigEndian, uint32(len(field)))
+		wire.Write(field)
+	}
+	authorizedKey := fmt.Sprintf("ssh-ed25519 %s %s\n", base64.StdEncoding.EncodeToString(wire.Bytes()), strings.ReplaceAll(comment, " ", "-"))
+
+	return privatePEM, []byte(authorizedKey), nil
+}
@@ -0,0 +1,91 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	privatePEM, publicKey, err := generateKeyPair("flux-extension-controller test-namespace/test-secret")
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(privatePEM)
+	require.NotNil(t, block)
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	require.True(t, ok)
+
+	fields := strings.Fields(string(publicKey))
+	require.Len(t, fields, 3)
+	assert.Equal(t, "ssh-ed25519", fields[0])
+	assert.Equal(t, "flux-extension-controller-test-namespace/test-secret", fields[2])
+
+	// The wire format ends with the public key of the pair
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(wire), "\x00\x00\x00\x0bssh-ed25519\x00\x00\x00\x20"))
+	assert.Equal(t, []byte(privateKey.Public().(ed25519.PublicKey)), wire[len(wire)-ed25519.PublicKeySize:])
+}
+
+func TestDeployKeyIssuer_Issue(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	repoURL := "ssh://git@github.com/testorg/test-repo"
+
+	// The secret holds the deploy key being replaced
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:   "flux-extension-controller",
+				kubernetes.AnnotationDeployKeyID: "1",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("KnownHosts", mock.Anything, mock.Anything).Return([]string{"github.com ssh-ed25519 AAAA"}, nil)
+	mockGitHubClient.On("RegisterDeployKey", mock.Anything, repoURL, "flux-extension-controller test-namespace/test-secret",
+		mock.MatchedBy(func(publicKey string) bool { return strings.HasPrefix(publicKey, "ssh-ed25519 ") })).Return(int64(2), nil)
+	mockGitHubClient.On("DeleteDeployKey", mock.Anything, repoURL, int64(1)).Return(nil)
+
+	issuer := NewDeployKeyIssuer(mockGitHubClient, kubernetes.NewSecretManager(fakeClient), time.Hour)
+	ctx := context.Background()
+	key, err := issuer.Issue(ctx, "test-namespace", "test-secret", repoURL, gitRepo)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), key.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), key.RotateAt, time.Minute)
+
+	updatedSecret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "test-namespace", Name: "test-secret"}, updatedSecret))
+	assert.Equal(t, "2", updatedSecret.Annotations[kubernetes.AnnotationDeployKeyID])
+	assert.Equal(t, key.PrivateKey, updatedSecret.Data["identity"])
+	assert.Equal(t, []byte("github.com ssh-ed25519 AAAA\n"), updatedSecret.Data["known_hosts"])
+
+	mockGitHubClient.AssertExpectations(t)
+}
@@ -0,0 +1,89 @@
+package token
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// refreshesTotal counts token refreshes that updated the secret with a new token
+	refreshesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_token_refreshes_total",
+			Help: "Number of token refreshes that updated the secret with a new token.",
+		},
+	)
+
+	// refreshFailuresTotal counts failed token refresh attempts
+	refreshFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_token_refresh_failures_total",
+			Help: "Number of failed token refresh attempts, by failure reason.",
+		},
+		[]string{"reason"},
+	)
+
+	// refreshDuration tracks how long token refresh attempts take
+	refreshDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "flux_extension_controller_token_refresh_duration_seconds",
+			Help:    "Duration of token refresh attempts, by result.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+
+	// refreshJobsScheduled tracks refresh jobs known to the refresh manager
+	refreshJobsScheduled = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "flux_extension_controller_token_refresh_jobs_scheduled",
+			Help: "Number of scheduled token refresh jobs, including paused and retrying ones.",
+		},
+	)
+
+	// refreshRetriesTotal counts token refresh attempts that failed and were scheduled for retry
+	refreshRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_token_refresh_retries_total",
+			Help: "Number of failed token refreshes that were scheduled for retry, by failure reason.",
+		},
+		[]string{"reason"},
+	)
+
+	// refreshAbandonedTotal counts refresh jobs given up after the token expired
+	refreshAbandonedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_token_refresh_abandoned_total",
+			Help: "Number of token refresh jobs given up because the token expired while retrying.",
+		},
+	)
+
+	// refreshDeferredTotal counts token refreshes deferred because of a low GitHub API rate limit
+	refreshDeferredTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flux_extension_controller_token_refresh_deferred_total",
+			Help: "Number of token refreshes deferred until the GitHub API rate limit resets.",
+		},
+	)
+
+	// refreshJobsRetrying tracks refresh jobs currently backing off after a failure
+	refreshJobsRetrying = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "flux_extension_controller_token_refresh_jobs_retrying",
+			Help: "Number of token refresh jobs currently backing off after a failure.",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		refreshesTotal,
+		refreshFailuresTotal,
+		refreshDuration,
+		refreshJobsScheduled,
+		refreshRetriesTotal,
+		refreshAbandonedTotal,
+		refreshJobsRetrying,
+		refreshDeferredTotal,
+	)
+}
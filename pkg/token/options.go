@@ -0,0 +1,80 @@
+package token
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/nrfcloud/flux-extension-controller/pkg/github"
+	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
+)
+
+// TokenOptionsFor returns the options of the installation tokens issued for a GitRepository, read
+// from its annotations. Permissions from the annotation are marked as requested, so they are capped
+// by the requestable permissions of the GitHub App.
+func TokenOptionsFor(gitRepo metav1.Object) (github.TokenOptions, error) {
+	var opts github.TokenOptions
+
+	if value := gitRepo.GetAnnotations()[kubernetes.AnnotationPermissions]; value != "" {
+		permissions, err := github.ParsePermissions(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s annotation: %w", kubernetes.AnnotationPermissions, err)
+		}
+		opts.Permissions = permissions
+		opts.Requested = len(permissions) > 0
+	}
+
+	if value := gitRepo.GetAnnotations()[kubernetes.AnnotationRepositories]; value != "" {
+		repositories, err := github.ParseRepositories(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s annotation: %w", kubernetes.AnnotationRepositories, err)
+		}
+		opts.Repositories = repositories
+	}
+
+	return opts, nil
+}
+
+// pushPermissions are the default permissions of the tokens pushing commits for an ImageUpdateAutomation
+var pushPermissions = map[string]string{"contents": "write"}
+
+// PushTokenOptionsFor returns the options of the installation tokens issued for an
+// ImageUpdateAutomation. They are read from its annotations like for GitRepositories and grant
+// contents:write unless other permissions are requested.
+func PushTokenOptionsFor(automation metav1.Object) (github.TokenOptions, error) {
+	opts, err := TokenOptionsFor(automation)
+	if err != nil {
+		return opts, err
+	}
+
+	if len(opts.Permissions) == 0 {
+		opts.Permissions = pushPermissions
+	}
+
+	return opts, nil
+}
+
+// providerPermissions are the permissions of the tokens issued for each type of notification
+// Provider posting to GitHub
+var providerPermissions = map[string]map[string]string{
+	"github":         {"statuses": "write"},
+	"githubdispatch": {"contents": "write"},
+}
+
+// ProviderTokenOptionsFor returns the options of the installation tokens issued for a notification
+// Provider of the given type. The token is scoped to the repository of the Provider and grants only
+// what the type needs to post.
+func ProviderTokenOptionsFor(providerType string) (github.TokenOptions, error) {
+	permissions, ok := providerPermissions[providerType]
+	if !ok {
+		return github.TokenOptions{}, fmt.Errorf("unsupported provider type %q", providerType)
+	}
+
+	return github.TokenOptions{Permissions: permissions}, nil
+}
+
+// IsGitHubProviderType checks if notification Providers of the type post to GitHub with a token
+func IsGitHubProviderType(providerType string) bool {
+	_, ok := providerPermissions[providerType]
+	return ok
+}
@@ -0,0 +1,69 @@
+package token
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+var _ workqueue.TypedRateLimiter[string] = (*retryRateLimiter)(nil)
+
+// retryRateLimiter delays the retries of a failing refresh with exponential backoff.
+// Unlike the workqueue's exponential limiter it adds jitter, so secrets failing at the
+// same time don't retry in lockstep.
+type retryRateLimiter struct {
+	mu        sync.Mutex
+	failures  map[string]int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// newRetryRateLimiter creates a rate limiter backing off from baseDelay up to maxDelay
+func newRetryRateLimiter(baseDelay, maxDelay time.Duration) *retryRateLimiter {
+	return &retryRateLimiter{
+		failures:  make(map[string]int),
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// When records a failure of the key and returns the delay before its next attempt
+func (l *retryRateLimiter) When(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failures[key]++
+	return l.backoff(l.failures[key])
+}
+
+// Forget clears the failures of the key
+func (l *retryRateLimiter) Forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
+
+// NumRequeues returns the number of failures recorded for the key
+func (l *retryRateLimiter) NumRequeues(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.failures[key]
+}
+
+// backoff returns the delay before the given retry attempt. The delay doubles with
+// every attempt up to the maximum, with up to 20% jitter so failing jobs spread out.
+func (l *retryRateLimiter) backoff(attempt int) time.Duration {
+	delay := l.maxDelay
+	if attempt < 32 {
+		if backoff := l.baseDelay << (attempt - 1); backoff > 0 && backoff < l.maxDelay {
+			delay = backoff
+		}
+	}
+
+	jitter := time.Duration(rand.Float64() * 0.2 * float64(delay))
+	return delay - jitter
+}
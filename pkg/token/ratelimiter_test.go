@@ -0,0 +1,43 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryRateLimiter_backoff(t *testing.T) {
+	limiter := newRetryRateLimiter(10*time.Second, 5*time.Minute)
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{5, 160 * time.Second},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		delay := limiter.backoff(tt.attempt)
+		assert.LessOrEqual(t, delay, tt.expected, "attempt %d", tt.attempt)
+		assert.GreaterOrEqual(t, delay, tt.expected*8/10, "attempt %d", tt.attempt)
+	}
+}
+
+func TestRetryRateLimiter_WhenAndForget(t *testing.T) {
+	limiter := newRetryRateLimiter(10*time.Second, 5*time.Minute)
+
+	assert.LessOrEqual(t, limiter.When("ns/a"), 10*time.Second)
+	assert.Greater(t, limiter.When("ns/a"), 10*time.Second)
+	assert.Equal(t, 2, limiter.NumRequeues("ns/a"))
+	assert.Equal(t, 0, limiter.NumRequeues("ns/b"))
+
+	limiter.Forget("ns/a")
+	assert.Equal(t, 0, limiter.NumRequeues("ns/a"))
+	assert.LessOrEqual(t, limiter.When("ns/a"), 10*time.Second)
+}
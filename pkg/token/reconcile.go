@@ -0,0 +1,63 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+)
+
+// conditionsObject is a Flux object reporting conditions, like the sources of source-controller
+type conditionsObject interface {
+	client.Object
+	GetConditions() []metav1.Condition
+}
+
+// RequestReconcile asks Flux to reconcile a source after its credentials were replaced, by setting
+// the reconcile.fluxcd.io/requestedAt annotation. source-controller otherwise keeps reporting an
+// authentication failure until the next interval of the source. Reconciliations are requested
+// only for sources that are failing or whose previous token had expired, and at most once per
+// interval: a requestedAt annotation set less than interval ago, by the controller or by the flux
+// CLI, counts as a pending request. Objects without conditions are left alone. It returns whether a
+// reconciliation was requested.
+func RequestReconcile(ctx context.Context, c client.Client, obj client.Object, tokenExpired bool, interval time.Duration) (bool, error) {
+	source, ok := obj.(conditionsObject)
+	if !ok {
+		return false, nil
+	}
+
+	if !tokenExpired && !apimeta.IsStatusConditionFalse(source.GetConditions(), meta.ReadyCondition) {
+		return false, nil
+	}
+
+	if interval <= 0 {
+		interval = config.DefaultReconcileRequestInterval
+	}
+
+	now := time.Now()
+	if value := source.GetAnnotations()[meta.ReconcileRequestAnnotation]; value != "" {
+		if requestedAt, err := time.Parse(time.RFC3339Nano, value); err == nil && now.Sub(requestedAt) < interval {
+			return false, nil
+		}
+	}
+
+	patch := client.MergeFrom(source.DeepCopyObject().(client.Object))
+	annotations := source.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[meta.ReconcileRequestAnnotation] = now.Format(time.RFC3339Nano)
+	source.SetAnnotations(annotations)
+
+	if err := c.Patch(ctx, source, patch); err != nil {
+		return false, fmt.Errorf("failed to request reconciliation: %w", err)
+	}
+
+	return true, nil
+}
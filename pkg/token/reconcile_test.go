@@ -0,0 +1,77 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestRequestReconcile(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	failing := []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionFalse, Reason: "AuthenticationFailed"}}
+	ready := []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Succeeded"}}
+
+	tests := []struct {
+		name         string
+		conditions   []metav1.Condition
+		requestedAt  string
+		tokenExpired bool
+		want         bool
+	}{
+		{name: "ready source", conditions: ready},
+		{name: "failing source", conditions: failing, want: true},
+		{name: "expired token", conditions: ready, tokenExpired: true, want: true},
+		{name: "recently requested", conditions: failing, requestedAt: time.Now().Add(-time.Minute).Format(time.RFC3339Nano)},
+		{name: "requested long ago", conditions: failing, requestedAt: time.Now().Add(-time.Hour).Format(time.RFC3339Nano), want: true},
+		{name: "other request value", conditions: failing, requestedAt: "manual", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitRepo := newTestGitRepository()
+			gitRepo.Status.Conditions = tt.conditions
+			if tt.requestedAt != "" {
+				gitRepo.Annotations = map[string]string{meta.ReconcileRequestAnnotation: tt.requestedAt}
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo).Build()
+
+			ctx := context.Background()
+			requested, err := RequestReconcile(ctx, fakeClient, gitRepo, tt.tokenExpired, 5*time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, requested)
+
+			updated := &sourcev1.GitRepository{}
+			require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(gitRepo), updated))
+			if tt.want {
+				requestedAt, err := time.Parse(time.RFC3339Nano, updated.Annotations[meta.ReconcileRequestAnnotation])
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now(), requestedAt, 5*time.Second)
+			} else {
+				assert.Equal(t, tt.requestedAt, updated.Annotations[meta.ReconcileRequestAnnotation])
+			}
+		})
+	}
+}
+
+func TestRequestReconcile_SkipsObjectsWithoutConditions(t *testing.T) {
+	automation := &unstructured.Unstructured{}
+	automation.SetAPIVersion("image.toolkit.fluxcd.io/v1")
+	automation.SetKind("ImageUpdateAutomation")
+
+	requested, err := RequestReconcile(context.Background(), fake.NewClientBuilder().Build(), automation, true, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, requested)
+}
@@ -2,31 +2,62 @@ package token
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v76/github"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
 	"github.com/nrfcloud/flux-extension-controller/pkg/github"
 	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
 )
 
+// Reasons of the events recorded by the refresh manager
+const (
+	EventReasonTokenRefreshed     = "TokenRefreshed"
+	EventReasonTokenRefreshFailed = "TokenRefreshFailed"
+)
+
 // RefreshManager manages token refresh operations
 type RefreshManager struct {
 	client        client.Client
 	githubClient  github.GitHubClient
 	secretManager *kubernetes.SecretManager
+	deployKeys    *DeployKeyIssuer
+	recorder      record.EventRecorder
 	logger        logr.Logger
 
 	// Refresh tracking
 	refreshJobs  map[string]*RefreshJob
 	refreshMutex sync.RWMutex
 
+	// Refreshes are queued by secret key and executed by a bounded pool of workers
+	queue        workqueue.TypedRateLimitingInterface[string]
+	retryLimiter *retryRateLimiter
+	limiter      *rate.Limiter
+	concurrency  int
+
 	refreshInterval time.Duration
 	refreshBuffer   time.Duration
+
+	// reconcileRequestInterval is the minimum time between two reconciliations requested for a source
+	reconcileRequestInterval time.Duration
 }
 
 // RefreshJob represents a scheduled token refresh
@@ -35,8 +66,22 @@ type RefreshJob struct {
 	SecretName      string
 	RepositoryURL   string
 	NextRefresh     time.Time
-	Timer           *time.Timer
-	Cancel          context.CancelFunc
+
+	// Paused is set when the GitRepository owning the secret has disappeared.
+	// A paused job is resumed by the next ScheduleRefresh call.
+	Paused bool
+
+	// TokenExpiry is when the token currently stored in the secret expires
+	TokenExpiry time.Time
+
+	// Retry state of a failing refresh, reset once the secret holds a new token
+	Attempts    int
+	LastAttempt time.Time
+	LastError   string
+
+	// Abandoned is set when the token expired while its refresh kept failing. An abandoned job is
+	// resumed once the secret holds a new token, e.g. issued by the reconcile of its source.
+	Abandoned bool
 }
 
 // NewRefreshManager creates a new token refresh manager
@@ -44,38 +89,57 @@ func NewRefreshManager(
 	client client.Client,
 	githubClient github.GitHubClient,
 	secretManager *kubernetes.SecretManager,
-	refreshInterval time.Duration,
+	recorder record.EventRecorder,
+	cfg config.TokenRefreshConfig,
 	logger logr.Logger,
 ) *RefreshManager {
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = config.DefaultRefreshConcurrency
+	}
+
+	rateLimit := cfg.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = config.DefaultRefreshRateLimit
+	}
+
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = config.DefaultRefreshBurst
+	}
+
+	retryLimiter := newRetryRateLimiter(10*time.Second, 5*time.Minute)
+
 	return &RefreshManager{
-		client:          client,
-		githubClient:    githubClient,
-		secretManager:   secretManager,
-		logger:          logger,
-		refreshJobs:     make(map[string]*RefreshJob),
-		refreshInterval: refreshInterval,
+		client:        client,
+		githubClient:  githubClient,
+		secretManager: secretManager,
+		deployKeys:    NewDeployKeyIssuer(githubClient, secretManager, cfg.DeployKeyRotation),
+		recorder:      recorder,
+		logger:        logger,
+		refreshJobs:   make(map[string]*RefreshJob),
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig[string](
+			retryLimiter,
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "token_refresh"},
+		),
+		retryLimiter:    retryLimiter,
+		limiter:         rate.NewLimiter(rate.Limit(rateLimit), burst),
+		concurrency:     concurrency,
+		refreshInterval: cfg.RefreshInterval,
 		refreshBuffer:   5 * time.Minute, // Refresh 5 minutes before expiry
+
+		reconcileRequestInterval: cfg.ReconcileRequestInterval,
 	}
 }
 
-// ScheduleRefresh schedules a token refresh for the given secret
+// ScheduleRefresh schedules a token refresh for the given secret. Scheduling the same
+// secret again replaces the previous schedule, unless its refresh is failing or was abandoned
+// and the secret still holds the same token: the backoff is kept until a new token is issued.
 func (rm *RefreshManager) ScheduleRefresh(ctx context.Context, namespace, name, repositoryURL string) error {
-	rm.refreshMutex.Lock()
-	defer rm.refreshMutex.Unlock()
-
 	jobKey := fmt.Sprintf("%s/%s", namespace, name)
 
-	// Cancel existing job if it exists
-	if existingJob, exists := rm.refreshJobs[jobKey]; exists {
-		if existingJob.Cancel != nil {
-			existingJob.Cancel()
-		}
-		if existingJob.Timer != nil {
-			existingJob.Timer.Stop()
-		}
-	}
-
-	// Get current secret to determine refresh time
+	// Get current secret to determine refresh time. This happens before taking the lock,
+	// so concurrent reconciles don't wait for each other's API calls.
 	secret, err := rm.secretManager.GetSecret(ctx, namespace, name)
 	if err != nil {
 		return fmt.Errorf("failed to get secret for refresh scheduling: %w", err)
@@ -93,25 +157,33 @@ func (rm *RefreshManager) ScheduleRefresh(ctx context.Context, namespace, name,
 		nextRefresh = time.Now().Add(1 * time.Minute)
 	}
 
-	// Create job context
-	jobCtx, cancel := context.WithCancel(context.Background())
-
-	// Create refresh job
 	job := &RefreshJob{
 		SecretNamespace: namespace,
 		SecretName:      name,
 		RepositoryURL:   repositoryURL,
 		NextRefresh:     nextRefresh,
-		Cancel:          cancel,
+		TokenExpiry:     expiry,
 	}
 
-	// Schedule the refresh
-	refreshDuration := time.Until(nextRefresh)
-	job.Timer = time.AfterFunc(refreshDuration, func() {
-		rm.executeRefresh(jobCtx, job)
-	})
-
+	rm.refreshMutex.Lock()
+	if current, exists := rm.refreshJobs[jobKey]; exists && !current.Paused && current.TokenExpiry.Equal(expiry) &&
+		(current.Attempts > 0 || current.Abandoned) {
+		rm.refreshMutex.Unlock()
+		rm.logger.V(1).Info("Token refresh is failing, keeping its backoff",
+			"secret", jobKey,
+			"attempts", current.Attempts,
+			"abandoned", current.Abandoned)
+		return nil
+	}
 	rm.refreshJobs[jobKey] = job
+	rm.recordJobMetrics()
+	rm.refreshMutex.Unlock()
+
+	// A new token starts without backoff. The queue holds each key once, so an
+	// earlier entry for this secret is picked up by a worker and moved to the new time.
+	refreshDuration := time.Until(nextRefresh)
+	rm.queue.Forget(jobKey)
+	rm.queue.AddAfter(jobKey, refreshDuration)
 
 	rm.logger.Info("Scheduled token refresh",
 		"secret", jobKey,
@@ -127,19 +199,60 @@ func (rm *RefreshManager) CancelRefresh(namespace, name string) {
 	defer rm.refreshMutex.Unlock()
 
 	jobKey := fmt.Sprintf("%s/%s", namespace, name)
-	if job, exists := rm.refreshJobs[jobKey]; exists {
-		if job.Cancel != nil {
-			job.Cancel()
-		}
-		if job.Timer != nil {
-			job.Timer.Stop()
-		}
+	if _, exists := rm.refreshJobs[jobKey]; exists {
+		// A queued entry for the key is dropped by the worker once the job is gone
 		delete(rm.refreshJobs, jobKey)
+		rm.queue.Forget(jobKey)
+		rm.recordJobMetrics()
 
 		rm.logger.Info("Cancelled token refresh", "secret", jobKey)
 	}
 }
 
+// runWorker processes queued refreshes until the queue is shut down
+func (rm *RefreshManager) runWorker(ctx context.Context) {
+	for rm.processNextItem(ctx) {
+	}
+}
+
+// processNextItem takes the next due secret key off the queue and refreshes its token
+func (rm *RefreshManager) processNextItem(ctx context.Context) bool {
+	jobKey, shutdown := rm.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer rm.queue.Done(jobKey)
+
+	rm.refreshMutex.RLock()
+	job, exists := rm.refreshJobs[jobKey]
+	var paused bool
+	var nextRefresh time.Time
+	if exists {
+		paused = job.Paused || job.Abandoned
+		nextRefresh = job.NextRefresh
+	}
+	rm.refreshMutex.RUnlock()
+
+	// Cancelled, paused and abandoned jobs are queued again by the next ScheduleRefresh
+	if !exists || paused {
+		return true
+	}
+
+	// The job was rescheduled to a later time while its key was queued
+	if wait := time.Until(nextRefresh); wait > 0 {
+		rm.queue.AddAfter(jobKey, wait)
+		return true
+	}
+
+	// Spread refreshes of many tokens expiring at the same moment
+	if err := rm.limiter.Wait(ctx); err != nil {
+		return false
+	}
+
+	rm.executeRefresh(ctx, job)
+	return true
+}
+
 // executeRefresh performs the actual token refresh
 func (rm *RefreshManager) executeRefresh(ctx context.Context, job *RefreshJob) {
 	logger := rm.logger.WithValues(
@@ -149,43 +262,120 @@ func (rm *RefreshManager) executeRefresh(ctx context.Context, job *RefreshJob) {
 
 	logger.Info("Executing token refresh")
 
+	start := time.Now()
+	result := "failure"
+	defer func() {
+		refreshDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
+	// Events are recorded on the owning source once it is known, and on the secret until then
+	var eventTarget runtime.Object = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: job.SecretNamespace, Name: job.SecretName},
+	}
+	fail := func(reason string, err error) {
+		rm.recorder.Eventf(eventTarget, corev1.EventTypeWarning, EventReasonTokenRefreshFailed,
+			"Failed to refresh GitHub token in secret %s (%s): %v", job.SecretName, reason, err)
+		rm.scheduleRetry(ctx, job, reason, err)
+	}
+
 	// Validate repository URL
 	if err := rm.githubClient.ValidateRepositoryURL(job.RepositoryURL); err != nil {
 		logger.Error(err, "Repository URL validation failed")
+		fail("ValidationFailed", err)
 		return
 	}
 
-	// Generate new installation token
-	token, err := rm.githubClient.GenerateInstallationToken(ctx, job.RepositoryURL)
+	// Get the secret to find the source owning it
+	secret, err := rm.secretManager.GetSecret(ctx, job.SecretNamespace, job.SecretName)
 	if err != nil {
-		logger.Error(err, "Failed to generate installation token")
+		logger.Error(err, "Failed to get secret for owner reference")
+		fail("SecretGetFailed", err)
+		return
+	}
+	eventTarget = secret
+
+	// Resolve the owning source, so the refreshed secret keeps its controller reference
+	owner, err := rm.resolveOwner(ctx, secret)
+	if apierrors.IsNotFound(err) {
+		logger.Info("Source owning the secret no longer exists, pausing token refresh", "reason", err.Error())
+		rm.pauseRefresh(job.SecretNamespace, job.SecretName)
+		result = "paused"
 		return
 	}
-
-	// Get the GitRepository object to use as owner
-	secret, err := rm.secretManager.GetSecret(ctx, job.SecretNamespace, job.SecretName)
 	if err != nil {
-		logger.Error(err, "Failed to get secret for owner reference")
+		logger.Error(err, "Failed to get source owning the secret")
+		fail("OwnerGetFailed", err)
 		return
 	}
+	eventTarget = owner
+
+	// A source that failed on the expired token is reconciled once the new token is in place
+	expiry, err := rm.secretManager.GetTokenExpiry(secret)
+	tokenExpired := err == nil && time.Now().After(expiry)
+
+	// The refresh can wait for a low GitHub API rate limit to reset while the token stays valid
+	githubCtx := github.WithDeferrable(ctx, job.TokenExpiry.Add(-time.Minute))
 
-	// Find the owner (GitRepository) from the secret's owner references
-	var owner client.Object
-	for _, ownerRef := range secret.GetOwnerReferences() {
-		if ownerRef.Kind == "GitRepository" {
-			// For simplicity, we'll use the secret itself as owner
-			// In a real implementation, you'd fetch the actual GitRepository object
-			owner = secret
-			break
+	// Secrets of SSH GitRepositories hold a deploy key, which is rotated instead
+	if rm.secretManager.GetDeployKeyID(secret) != 0 {
+		key, err := rm.deployKeys.Issue(githubCtx, job.SecretNamespace, job.SecretName, job.RepositoryURL, owner)
+		if rm.deferIfRateLimited(job, err) {
+			result = "deferred"
+			return
 		}
+		if err != nil {
+			logger.Error(err, "Failed to rotate deploy key")
+			fail("DeployKeyRotationFailed", err)
+			return
+		}
+
+		logger.Info("Deploy key rotation completed successfully", "deployKeyID", key.ID)
+		result = "success"
+		refreshesTotal.Inc()
+		rm.recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonTokenRefreshed,
+			"Rotated deploy key in secret %s, next rotation at %s", job.SecretName, key.RotateAt.Format(time.RFC3339))
+		rm.requestReconcile(ctx, owner, false, logger)
+
+		if err := rm.ScheduleRefresh(ctx, job.SecretNamespace, job.SecretName, job.RepositoryURL); err != nil {
+			logger.Error(err, "Failed to schedule next refresh")
+		}
+		return
 	}
 
-	if owner == nil {
-		owner = secret // Fallback to secret as owner
+	// Secrets of OCI repositories hold registry credentials made of a package token
+	registry := rm.secretManager.IsRegistrySecret(secret)
+
+	// Generate new installation token
+	var token *gogithub.InstallationToken
+	if registry {
+		token, err = rm.githubClient.GeneratePackageToken(githubCtx, job.RepositoryURL)
+	} else {
+		opts, optsErr := ownerTokenOptions(owner)
+		if optsErr != nil {
+			logger.Error(optsErr, "Invalid token options")
+			fail("ValidationFailed", optsErr)
+			return
+		}
+		token, err = rm.githubClient.GenerateInstallationToken(githubCtx, job.RepositoryURL, opts)
+	}
+	if rm.deferIfRateLimited(job, err) {
+		result = "deferred"
+		return
+	}
+	if err != nil {
+		logger.Error(err, "Failed to generate installation token")
+		fail("TokenGenerationFailed", err)
+		return
 	}
 
 	// Update the secret with new token
-	if err := rm.secretManager.CreateOrUpdateSecret(
+	update := rm.secretManager.CreateOrUpdateSecret
+	if registry {
+		update = rm.secretManager.CreateOrUpdateRegistrySecret
+	} else if rm.secretManager.IsProviderSecret(secret) {
+		update = rm.secretManager.CreateOrUpdateProviderSecret
+	}
+	if err := update(
 		ctx,
 		job.SecretNamespace,
 		job.SecretName,
@@ -194,10 +384,16 @@ func (rm *RefreshManager) executeRefresh(ctx context.Context, job *RefreshJob) {
 		owner,
 	); err != nil {
 		logger.Error(err, "Failed to update secret with new token")
+		fail("SecretUpdateFailed", err)
 		return
 	}
 
 	logger.Info("Token refresh completed successfully")
+	result = "success"
+	refreshesTotal.Inc()
+	rm.recorder.Eventf(owner, corev1.EventTypeNormal, EventReasonTokenRefreshed,
+		"Refreshed GitHub token in secret %s, expires at %s", job.SecretName, token.GetExpiresAt().Format(time.RFC3339))
+	rm.requestReconcile(ctx, owner, tokenExpired, logger)
 
 	// Schedule next refresh
 	if err := rm.ScheduleRefresh(ctx, job.SecretNamespace, job.SecretName, job.RepositoryURL); err != nil {
@@ -205,6 +401,208 @@ func (rm *RefreshManager) executeRefresh(ctx context.Context, job *RefreshJob) {
 	}
 }
 
+// requestReconcile asks Flux to reconcile the source owning a refreshed secret when it is failing or
+// its previous token had expired. Failures are logged, the refresh itself succeeded.
+func (rm *RefreshManager) requestReconcile(ctx context.Context, owner client.Object, tokenExpired bool, logger logr.Logger) {
+	requested, err := RequestReconcile(ctx, rm.client, owner, tokenExpired, rm.reconcileRequestInterval)
+	if err != nil {
+		logger.Error(err, "Failed to request reconciliation of source")
+		return
+	}
+	if requested {
+		logger.Info("Requested reconciliation of source with refreshed credentials")
+	}
+}
+
+// scheduleRetry records a failed refresh attempt on the job and requeues it with
+// exponential backoff. The job is abandoned once the token in the secret has expired.
+func (rm *RefreshManager) scheduleRetry(ctx context.Context, job *RefreshJob, reason string, refreshErr error) {
+	refreshFailuresTotal.WithLabelValues(reason).Inc()
+
+	rm.refreshMutex.Lock()
+	defer rm.refreshMutex.Unlock()
+
+	jobKey := fmt.Sprintf("%s/%s", job.SecretNamespace, job.SecretName)
+
+	// The job may have been cancelled or replaced while the refresh was running
+	if current, exists := rm.refreshJobs[jobKey]; !exists || current != job {
+		return
+	}
+
+	now := time.Now()
+	delay := rm.retryLimiter.When(jobKey)
+	job.Attempts = rm.retryLimiter.NumRequeues(jobKey)
+	job.LastAttempt = now
+	job.LastError = refreshErr.Error()
+
+	if !job.TokenExpiry.IsZero() && !now.Before(job.TokenExpiry) {
+		job.Abandoned = true
+		rm.queue.Forget(jobKey)
+		rm.recordJobMetrics()
+		refreshAbandonedTotal.Inc()
+
+		rm.logger.Error(refreshErr, "Token expired while retrying refresh, giving up",
+			"secret", jobKey,
+			"attempts", job.Attempts,
+			"expiredAt", job.TokenExpiry)
+		return
+	}
+
+	nextRefresh := now.Add(delay)
+	if !job.TokenExpiry.IsZero() && nextRefresh.After(job.TokenExpiry) {
+		// Make a last attempt right when the token expires
+		nextRefresh = job.TokenExpiry
+	}
+
+	job.NextRefresh = nextRefresh
+	rm.queue.AddAfter(jobKey, time.Until(nextRefresh))
+	rm.recordJobMetrics()
+	refreshRetriesTotal.WithLabelValues(reason).Inc()
+
+	rm.logger.Info("Scheduled token refresh retry",
+		"secret", jobKey,
+		"reason", reason,
+		"attempt", job.Attempts,
+		"nextRefresh", nextRefresh)
+}
+
+// deferIfRateLimited moves a refresh held back by the GitHub API rate limit to when the rate
+// limit resets, without backing off. Refreshes that would be moved past the expiry of the token
+// are left to the retry handling.
+func (rm *RefreshManager) deferIfRateLimited(job *RefreshJob, err error) bool {
+	var rateLimited *github.RateLimitedError
+	if !errors.As(err, &rateLimited) || !rateLimited.Until.Before(job.TokenExpiry) {
+		return false
+	}
+
+	rm.refreshMutex.Lock()
+	defer rm.refreshMutex.Unlock()
+
+	jobKey := fmt.Sprintf("%s/%s", job.SecretNamespace, job.SecretName)
+
+	// The job may have been cancelled or replaced while the refresh was running
+	if current, exists := rm.refreshJobs[jobKey]; !exists || current != job {
+		return true
+	}
+
+	job.NextRefresh = rateLimited.Until
+	rm.queue.AddAfter(jobKey, time.Until(rateLimited.Until))
+	refreshDeferredTotal.Inc()
+
+	rm.logger.Info("Deferred token refresh until the GitHub API rate limit resets",
+		"secret", jobKey,
+		"nextRefresh", rateLimited.Until)
+
+	return true
+}
+
+// recordJobMetrics updates the metrics of scheduled jobs and jobs backing off.
+// The caller must hold refreshMutex.
+func (rm *RefreshManager) recordJobMetrics() {
+	scheduled, retrying := 0, 0
+	for _, job := range rm.refreshJobs {
+		if job.Abandoned {
+			continue
+		}
+		scheduled++
+		if job.Attempts > 0 {
+			retrying++
+		}
+	}
+	refreshJobsScheduled.Set(float64(scheduled))
+	refreshJobsRetrying.Set(float64(retrying))
+}
+
+// ownerKinds creates an empty object for each kind of Flux object that owns managed secrets. The
+// image automation and notification APIs are not dependencies, so ImageUpdateAutomations and
+// Providers are read as unstructured objects in the version of the owner reference.
+var ownerKinds = map[string]func(apiVersion string) client.Object{
+	sourcev1.GitRepositoryKind:           func(string) client.Object { return &sourcev1.GitRepository{} },
+	sourcev1.HelmRepositoryKind:          func(string) client.Object { return &sourcev1.HelmRepository{} },
+	sourcev1.OCIRepositoryKind:           func(string) client.Object { return &sourcev1.OCIRepository{} },
+	kubernetes.ImageUpdateAutomationKind: unstructuredOwner(kubernetes.ImageUpdateAutomationKind),
+	kubernetes.ProviderKind:              unstructuredOwner(kubernetes.ProviderKind),
+}
+
+// unstructuredOwner creates empty unstructured objects of the kind
+func unstructuredOwner(kind string) func(apiVersion string) client.Object {
+	return func(apiVersion string) client.Object {
+		owner := &unstructured.Unstructured{}
+		owner.SetAPIVersion(apiVersion)
+		owner.SetKind(kind)
+		return owner
+	}
+}
+
+// ownerTokenOptions returns the options of the installation tokens issued for the owner of a secret
+func ownerTokenOptions(owner client.Object) (github.TokenOptions, error) {
+	switch owner.GetObjectKind().GroupVersionKind().Kind {
+	case kubernetes.ImageUpdateAutomationKind:
+		return PushTokenOptionsFor(owner)
+	case kubernetes.ProviderKind:
+		providerType, _, _ := unstructured.NestedString(owner.(*unstructured.Unstructured).Object, "spec", "type")
+		return ProviderTokenOptionsFor(providerType)
+	}
+	return TokenOptionsFor(owner)
+}
+
+// resolveOwner fetches the Flux object referenced by the controller reference of the secret. A
+// NotFound error is returned when the secret has no such reference or the object is gone.
+func (rm *RefreshManager) resolveOwner(ctx context.Context, secret *corev1.Secret) (client.Object, error) {
+	ownerRef := metav1.GetControllerOf(secret)
+	if ownerRef == nil {
+		return nil, apierrors.NewNotFound(sourcev1.GroupVersion.WithResource("gitrepositories").GroupResource(), "")
+	}
+
+	newOwner, supported := ownerKinds[ownerRef.Kind]
+	ownerResource := sourcev1.GroupVersion.WithResource(strings.ToLower(ownerRef.Kind) + "s").GroupResource()
+	if !supported {
+		return nil, apierrors.NewNotFound(ownerResource, ownerRef.Name)
+	}
+
+	owner := newOwner(ownerRef.APIVersion)
+	if err := rm.client.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: ownerRef.Name}, owner); err != nil {
+		return nil, err
+	}
+
+	// An object recreated under the same name is a different owner
+	if owner.GetUID() != ownerRef.UID {
+		return nil, apierrors.NewNotFound(ownerResource, ownerRef.Name)
+	}
+
+	return owner, nil
+}
+
+// pauseRefresh stops a scheduled refresh but keeps the job, so periodic checks leave it alone
+func (rm *RefreshManager) pauseRefresh(namespace, name string) {
+	rm.refreshMutex.Lock()
+	defer rm.refreshMutex.Unlock()
+
+	jobKey := fmt.Sprintf("%s/%s", namespace, name)
+	if job, exists := rm.refreshJobs[jobKey]; exists {
+		job.Paused = true
+		rm.queue.Forget(jobKey)
+	}
+}
+
+// isRefreshPaused checks if the refresh job for the given secret is paused
+func (rm *RefreshManager) isRefreshPaused(namespace, name string) bool {
+	rm.refreshMutex.RLock()
+	defer rm.refreshMutex.RUnlock()
+
+	job, exists := rm.refreshJobs[fmt.Sprintf("%s/%s", namespace, name)]
+	return exists && job.Paused
+}
+
+// isRefreshRetrying checks if the refresh job for the given secret is backing off after a failure
+func (rm *RefreshManager) isRefreshRetrying(namespace, name string) bool {
+	rm.refreshMutex.RLock()
+	defer rm.refreshMutex.RUnlock()
+
+	job, exists := rm.refreshJobs[fmt.Sprintf("%s/%s", namespace, name)]
+	return exists && job.Attempts > 0
+}
+
 // CheckAndRefreshExpiredTokens checks all managed secrets and refreshes expired tokens
 func (rm *RefreshManager) CheckAndRefreshExpiredTokens(ctx context.Context) error {
 	// List all secrets in all namespaces
@@ -213,6 +611,9 @@ func (rm *RefreshManager) CheckAndRefreshExpiredTokens(ctx context.Context) erro
 		return fmt.Errorf("failed to list secrets: %w", err)
 	}
 
+	// Export the token expiry of every managed secret, dropping secrets that were deleted
+	rm.secretManager.RecordManagedSecrets(secretList.Items)
+
 	for _, secret := range secretList.Items {
 		if !rm.secretManager.IsSecretManagedByController(&secret) {
 			continue
@@ -225,6 +626,19 @@ func (rm *RefreshManager) CheckAndRefreshExpiredTokens(ctx context.Context) erro
 			continue
 		}
 
+		if needsRefresh && rm.isRefreshPaused(secret.Namespace, secret.Name) {
+			rm.logger.V(1).Info("Token refresh paused, skipping",
+				"secret", fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
+			continue
+		}
+
+		// Keep the backoff of jobs already retrying
+		if needsRefresh && rm.isRefreshRetrying(secret.Namespace, secret.Name) {
+			rm.logger.V(1).Info("Token refresh already retrying, skipping",
+				"secret", fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
+			continue
+		}
+
 		if needsRefresh {
 			repositoryURL := ""
 			if secret.Annotations != nil {
@@ -250,7 +664,16 @@ func (rm *RefreshManager) CheckAndRefreshExpiredTokens(ctx context.Context) erro
 
 // Start starts the refresh manager background processes
 func (rm *RefreshManager) Start(ctx context.Context) error {
-	rm.logger.Info("Starting token refresh manager")
+	rm.logger.Info("Starting token refresh manager", "concurrency", rm.concurrency)
+
+	for i := 0; i < rm.concurrency; i++ {
+		go wait.UntilWithContext(ctx, rm.runWorker, time.Second)
+	}
+
+	go func() {
+		<-ctx.Done()
+		rm.queue.ShutDown()
+	}()
 
 	// Check for expired tokens on startup
 	if err := rm.CheckAndRefreshExpiredTokens(ctx); err != nil {
@@ -284,13 +707,9 @@ func (rm *RefreshManager) Stop() {
 
 	rm.logger.Info("Stopping token refresh manager")
 
-	for jobKey, job := range rm.refreshJobs {
-		if job.Cancel != nil {
-			job.Cancel()
-		}
-		if job.Timer != nil {
-			job.Timer.Stop()
-		}
+	for jobKey := range rm.refreshJobs {
 		delete(rm.refreshJobs, jobKey)
 	}
+	rm.recordJobMetrics()
+	rm.queue.ShutDown()
 }
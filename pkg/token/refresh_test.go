@@ -7,15 +7,23 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/google/go-github/v76/github"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/nrfcloud/flux-extension-controller/pkg/config"
+	ghclient "github.com/nrfcloud/flux-extension-controller/pkg/github"
 	"github.com/nrfcloud/flux-extension-controller/pkg/kubernetes"
 )
 
@@ -29,11 +37,42 @@ func (m *MockGitHubClient) ValidateRepositoryURL(repoURL string) error {
 	return args.Error(0)
 }
 
-func (m *MockGitHubClient) GenerateInstallationToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
+func (m *MockGitHubClient) GenerateInstallationToken(ctx context.Context, repoURL string, opts ghclient.TokenOptions) (*github.InstallationToken, error) {
+	args := m.Called(ctx, repoURL, opts)
+	return args.Get(0).(*github.InstallationToken), args.Error(1)
+}
+
+func (m *MockGitHubClient) GeneratePackageToken(ctx context.Context, repoURL string) (*github.InstallationToken, error) {
 	args := m.Called(ctx, repoURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
 	return args.Get(0).(*github.InstallationToken), args.Error(1)
 }
 
+func (m *MockGitHubClient) RevokeInstallationToken(ctx context.Context, repoURL, token string) error {
+	args := m.Called(ctx, repoURL, token)
+	return args.Error(0)
+}
+
+func (m *MockGitHubClient) RegisterDeployKey(ctx context.Context, repoURL, title, publicKey string) (int64, error) {
+	args := m.Called(ctx, repoURL, title, publicKey)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockGitHubClient) DeleteDeployKey(ctx context.Context, repoURL string, keyID int64) error {
+	args := m.Called(ctx, repoURL, keyID)
+	return args.Error(0)
+}
+
+func (m *MockGitHubClient) KnownHosts(ctx context.Context, repoURL string) ([]string, error) {
+	args := m.Called(ctx, repoURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 func TestRefreshManager_ScheduleRefresh(t *testing.T) {
 	s := scheme.Scheme
 
@@ -64,7 +103,8 @@ func TestRefreshManager_ScheduleRefresh(t *testing.T) {
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		30*time.Minute,
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
 		logger,
 	)
 
@@ -83,8 +123,7 @@ func TestRefreshManager_ScheduleRefresh(t *testing.T) {
 	assert.Equal(t, "test-namespace", job.SecretNamespace)
 	assert.Equal(t, "test-secret", job.SecretName)
 	assert.Equal(t, "https://github.com/testorg/test-repo", job.RepositoryURL)
-	assert.NotNil(t, job.Timer)
-	assert.NotNil(t, job.Cancel)
+	assert.WithinDuration(t, expiresAt.Add(-5*time.Minute), job.NextRefresh, time.Second)
 
 	// Clean up
 	refreshManager.CancelRefresh("test-namespace", "test-secret")
@@ -100,21 +139,19 @@ func TestRefreshManager_CancelRefresh(t *testing.T) {
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		30*time.Minute,
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
 		logger,
 	)
 
 	// Manually add a job to test cancellation
 	jobKey := "test-namespace/test-secret"
-	jobCtx, cancel := context.WithCancel(context.Background())
-	timer := time.NewTimer(1 * time.Hour)
 
 	refreshManager.refreshMutex.Lock()
 	refreshManager.refreshJobs[jobKey] = &RefreshJob{
 		SecretNamespace: "test-namespace",
 		SecretName:      "test-secret",
-		Timer:           timer,
-		Cancel:          cancel,
+		NextRefresh:     time.Now().Add(1 * time.Hour),
 	}
 	refreshManager.refreshMutex.Unlock()
 
@@ -127,9 +164,6 @@ func TestRefreshManager_CancelRefresh(t *testing.T) {
 	refreshManager.refreshMutex.RUnlock()
 
 	assert.False(t, exists)
-
-	// Clean up context
-	_ = jobCtx
 }
 
 func TestRefreshManager_CheckAndRefreshExpiredTokens(t *testing.T) {
@@ -182,7 +216,8 @@ func TestRefreshManager_CheckAndRefreshExpiredTokens(t *testing.T) {
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		30*time.Minute,
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
 		logger,
 	)
 
@@ -206,26 +241,48 @@ func TestRefreshManager_CheckAndRefreshExpiredTokens(t *testing.T) {
 	assert.False(t, laterExpiresScheduled)
 
 	// Clean up
-	for jobKey := range jobs {
-		if job, exists := jobs[jobKey]; exists {
-			if job.Cancel != nil {
-				job.Cancel()
-			}
-			if job.Timer != nil {
-				job.Timer.Stop()
-			}
-		}
+	refreshManager.Stop()
+}
+
+// newTestGitRepository creates a GitRepository that owns the refreshed secret
+func newTestGitRepository() *sourcev1.GitRepository {
+	return &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repo",
+			Namespace: "test-namespace",
+			UID:       "git-repo-uid",
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL: "https://github.com/testorg/test-repo",
+		},
+	}
+}
+
+// controllerReference creates a controller owner reference to the GitRepository
+func controllerReference(gitRepo *sourcev1.GitRepository) metav1.OwnerReference {
+	isController := true
+	return metav1.OwnerReference{
+		APIVersion: sourcev1.GroupVersion.String(),
+		Kind:       sourcev1.GitRepositoryKind,
+		Name:       gitRepo.Name,
+		UID:        gitRepo.UID,
+		Controller: &isController,
 	}
 }
 
 func TestRefreshManager_executeRefresh(t *testing.T) {
 	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	gitRepo.Annotations = map[string]string{kubernetes.AnnotationPermissions: "contents:read"}
 
 	// Create a secret that needs refresh
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "test-secret",
-			Namespace: "test-namespace",
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
 			Annotations: map[string]string{
 				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
 				kubernetes.AnnotationTokenExpiry:   time.Now().Add(5 * time.Minute).Format(time.RFC3339),
@@ -238,16 +295,18 @@ func TestRefreshManager_executeRefresh(t *testing.T) {
 		},
 	}
 
-	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(secret).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
 	mockGitHubClient := &MockGitHubClient{}
 	secretManager := kubernetes.NewSecretManager(fakeClient)
 	logger := logr.Discard()
 
+	recorder := record.NewFakeRecorder(10)
 	refreshManager := NewRefreshManager(
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		30*time.Minute,
+		recorder,
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
 		logger,
 	)
 
@@ -260,7 +319,9 @@ func TestRefreshManager_executeRefresh(t *testing.T) {
 	}
 
 	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
-	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, repoURL).Return(newToken, nil)
+	// The refresh requests the permissions of the owning GitRepository
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, repoURL,
+		ghclient.TokenOptions{Permissions: map[string]string{"contents": "read"}, Requested: true}).Return(newToken, nil)
 
 	// Create refresh job
 	job := &RefreshJob{
@@ -270,8 +331,10 @@ func TestRefreshManager_executeRefresh(t *testing.T) {
 	}
 
 	// Execute refresh
+	refreshesBefore := testutil.ToFloat64(refreshesTotal)
 	ctx := context.Background()
 	refreshManager.executeRefresh(ctx, job)
+	assert.Equal(t, refreshesBefore+1, testutil.ToFloat64(refreshesTotal))
 
 	// Verify the secret was updated
 	updatedSecret := &corev1.Secret{}
@@ -284,8 +347,288 @@ func TestRefreshManager_executeRefresh(t *testing.T) {
 	assert.Equal(t, []byte("new-refreshed-token"), updatedSecret.Data["password"])
 	assert.Equal(t, newExpiresAt.Format(time.RFC3339), updatedSecret.Annotations[kubernetes.AnnotationTokenExpiry])
 
+	// Verify the controller reference still points at the GitRepository
+	ownerRef := metav1.GetControllerOf(updatedSecret)
+	require.NotNil(t, ownerRef)
+	assert.Equal(t, sourcev1.GitRepositoryKind, ownerRef.Kind)
+	assert.Equal(t, gitRepo.UID, ownerRef.UID)
+
+	// Verify the refresh was recorded on the GitRepository
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenRefreshed Refreshed GitHub token in secret test-secret")
+
 	// Verify mock expectations
 	mockGitHubClient.AssertExpectations(t)
+
+	// Clean up the next scheduled refresh
+	refreshManager.Stop()
+}
+
+func TestRefreshManager_executeRefresh_RequestsReconcileAfterExpiry(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(-time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+			},
+		},
+		Data: map[string][]byte{"username": []byte("git"), "password": []byte("expired-token")},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	refreshManager := NewRefreshManager(fakeClient, mockGitHubClient, kubernetes.NewSecretManager(fakeClient),
+		record.NewFakeRecorder(10), config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute}, logr.Discard())
+
+	repoURL := "https://github.com/testorg/test-repo"
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, repoURL, mock.Anything).Return(&github.InstallationToken{
+		Token:     github.String("new-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}, nil)
+
+	ctx := context.Background()
+	refreshManager.executeRefresh(ctx, &RefreshJob{
+		SecretNamespace: "test-namespace",
+		SecretName:      "test-secret",
+		RepositoryURL:   repoURL,
+	})
+
+	// The source failed on the expired token, so it is reconciled right away
+	updated := &sourcev1.GitRepository{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(gitRepo), updated))
+	assert.NotEmpty(t, updated.Annotations[meta.ReconcileRequestAnnotation])
+
+	mockGitHubClient.AssertExpectations(t)
+	refreshManager.Stop()
+}
+
+func TestRefreshManager_executeRefresh_RegistrySecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	repoURL := "oci://ghcr.io/testorg/charts"
+	isController := true
+	ociRepo := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "charts", Namespace: "test-namespace", UID: "oci-repo-uid"},
+		Spec:       sourcev1.OCIRepositorySpec{URL: repoURL},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ghcr-auth",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.OCIRepositoryKind,
+				Name:       ociRepo.Name,
+				UID:        ociRepo.UID,
+				Controller: &isController,
+			}},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(5 * time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: repoURL,
+			},
+		},
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"ghcr.io":{"username":"x-access-token","password":"old-token"}}}`),
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(ociRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	secretManager := kubernetes.NewSecretManager(fakeClient)
+	recorder := record.NewFakeRecorder(10)
+	refreshManager := NewRefreshManager(fakeClient, mockGitHubClient, secretManager, recorder,
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute}, logr.Discard())
+
+	// Registry secrets are refreshed with a package token
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("GeneratePackageToken", mock.Anything, repoURL).Return(&github.InstallationToken{
+		Token:     github.String("new-package-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}, nil)
+
+	ctx := context.Background()
+	refreshManager.executeRefresh(ctx, &RefreshJob{
+		SecretNamespace: "test-namespace",
+		SecretName:      "ghcr-auth",
+		RepositoryURL:   repoURL,
+	})
+
+	updatedSecret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "test-namespace", Name: "ghcr-auth"}, updatedSecret))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, updatedSecret.Type)
+	assert.Equal(t, "new-package-token", secretManager.GetToken(updatedSecret))
+	assert.True(t, metav1.IsControlledBy(updatedSecret, ociRepo))
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal TokenRefreshed Refreshed GitHub token in secret ghcr-auth")
+
+	mockGitHubClient.AssertExpectations(t)
+	refreshManager.Stop()
+}
+
+func TestRefreshManager_executeRefresh_ProviderSecret(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	providerGVK := schema.GroupVersionKind{Group: kubernetes.NotificationGroup, Version: "v1beta3", Kind: kubernetes.ProviderKind}
+	s.AddKnownTypeWithName(providerGVK, &unstructured.Unstructured{})
+
+	repoURL := "https://github.com/testorg/app"
+	isController := true
+	provider := &unstructured.Unstructured{}
+	provider.SetGroupVersionKind(providerGVK)
+	provider.SetNamespace("test-namespace")
+	provider.SetName("dispatch")
+	provider.SetUID("provider-uid")
+	provider.Object["spec"] = map[string]interface{}{"type": "githubdispatch", "address": repoURL}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dispatch-token",
+			Namespace: "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: providerGVK.GroupVersion().String(),
+				Kind:       kubernetes.ProviderKind,
+				Name:       provider.GetName(),
+				UID:        provider.GetUID(),
+				Controller: &isController,
+			}},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(5 * time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: repoURL,
+			},
+		},
+		Data: map[string][]byte{kubernetes.ProviderTokenKey: []byte("old-token")},
+		Type: corev1.SecretTypeOpaque,
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(provider, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	secretManager := kubernetes.NewSecretManager(fakeClient)
+	recorder := record.NewFakeRecorder(10)
+	refreshManager := NewRefreshManager(fakeClient, mockGitHubClient, secretManager, recorder,
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute}, logr.Discard())
+
+	// Provider secrets are refreshed with the permissions of the provider type
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, repoURL,
+		ghclient.TokenOptions{Permissions: map[string]string{"contents": "write"}}).Return(&github.InstallationToken{
+		Token:     github.String("new-dispatch-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	}, nil)
+
+	ctx := context.Background()
+	refreshManager.executeRefresh(ctx, &RefreshJob{
+		SecretNamespace: "test-namespace",
+		SecretName:      "dispatch-token",
+		RepositoryURL:   repoURL,
+	})
+
+	updatedSecret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "test-namespace", Name: "dispatch-token"}, updatedSecret))
+	assert.Equal(t, corev1.SecretTypeOpaque, updatedSecret.Type)
+	assert.Equal(t, "new-dispatch-token", string(updatedSecret.Data[kubernetes.ProviderTokenKey]))
+	assert.True(t, metav1.IsControlledBy(updatedSecret, provider))
+
+	mockGitHubClient.AssertExpectations(t)
+	refreshManager.Stop()
+}
+
+func TestRefreshManager_executeRefresh_OwnerGone(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	deletedGitRepo := newTestGitRepository()
+	recreatedGitRepo := newTestGitRepository()
+	recreatedGitRepo.UID = "recreated-uid"
+
+	tests := []struct {
+		name      string
+		objects   []client.Object
+		ownerRefs []metav1.OwnerReference
+	}{
+		{
+			name:      "GitRepository deleted",
+			ownerRefs: []metav1.OwnerReference{controllerReference(deletedGitRepo)},
+		},
+		{
+			name:      "GitRepository recreated under the same name",
+			objects:   []client.Object{recreatedGitRepo},
+			ownerRefs: []metav1.OwnerReference{controllerReference(deletedGitRepo)},
+		},
+		{
+			name: "no controller reference",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-secret",
+					Namespace:       "test-namespace",
+					OwnerReferences: tt.ownerRefs,
+					Annotations: map[string]string{
+						kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+						kubernetes.AnnotationTokenExpiry:   time.Now().Add(2 * time.Minute).Format(time.RFC3339),
+						kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+					},
+				},
+				Data: map[string][]byte{
+					"password": []byte("old-token"),
+				},
+			}
+
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(append(tt.objects, secret)...).Build()
+			mockGitHubClient := &MockGitHubClient{}
+			mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repo").Return(nil)
+
+			refreshManager := NewRefreshManager(
+				fakeClient,
+				mockGitHubClient,
+				kubernetes.NewSecretManager(fakeClient),
+				&record.FakeRecorder{},
+				config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+				logr.Discard(),
+			)
+
+			ctx := context.Background()
+			require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+
+			refreshManager.refreshMutex.RLock()
+			job := refreshManager.refreshJobs["test-namespace/test-secret"]
+			refreshManager.refreshMutex.RUnlock()
+
+			refreshManager.executeRefresh(ctx, job)
+
+			// No token is minted for a secret without owner, and the job is paused
+			mockGitHubClient.AssertNotCalled(t, "GenerateInstallationToken", mock.Anything, mock.Anything)
+			assert.True(t, refreshManager.isRefreshPaused("test-namespace", "test-secret"))
+
+			// Periodic checks leave paused jobs alone
+			require.NoError(t, refreshManager.CheckAndRefreshExpiredTokens(ctx))
+			assert.True(t, refreshManager.isRefreshPaused("test-namespace", "test-secret"))
+
+			// Scheduling the refresh again resumes the job
+			require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+			assert.False(t, refreshManager.isRefreshPaused("test-namespace", "test-secret"))
+
+			refreshManager.Stop()
+		})
+	}
 }
 
 func TestRefreshManager_executeRefresh_ValidationFailure(t *testing.T) {
@@ -307,7 +650,8 @@ func TestRefreshManager_executeRefresh_ValidationFailure(t *testing.T) {
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		30*time.Minute,
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
 		logger,
 	)
 
@@ -339,7 +683,8 @@ func TestRefreshManager_Start_And_Stop(t *testing.T) {
 		fakeClient,
 		mockGitHubClient,
 		secretManager,
-		1*time.Second, // Short interval for testing
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 1 * time.Second}, // Short interval for testing
 		logger,
 	)
 
@@ -363,3 +708,328 @@ func TestRefreshManager_Start_And_Stop(t *testing.T) {
 
 	assert.Equal(t, 0, jobCount)
 }
+
+func TestRefreshManager_executeRefresh_RetriesWithBackoff(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(4 * time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repo").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repo", mock.Anything).
+		Return((*github.InstallationToken)(nil), assert.AnError)
+
+	recorder := record.NewFakeRecorder(10)
+	refreshManager := NewRefreshManager(
+		fakeClient,
+		mockGitHubClient,
+		kubernetes.NewSecretManager(fakeClient),
+		recorder,
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+		logr.Discard(),
+	)
+	defer refreshManager.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+
+	refreshManager.refreshMutex.RLock()
+	job := refreshManager.refreshJobs["test-namespace/test-secret"]
+	refreshManager.refreshMutex.RUnlock()
+
+	retriesBefore := testutil.ToFloat64(refreshRetriesTotal.WithLabelValues("TokenGenerationFailed"))
+	failuresBefore := testutil.ToFloat64(refreshFailuresTotal.WithLabelValues("TokenGenerationFailed"))
+
+	// First failure backs off by the base delay
+	refreshManager.executeRefresh(ctx, job)
+
+	refreshManager.refreshMutex.RLock()
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, assert.AnError.Error(), job.LastError)
+	assert.WithinDuration(t, time.Now().Add(9*time.Second), job.NextRefresh, 2*time.Second)
+	refreshManager.refreshMutex.RUnlock()
+
+	// Second failure doubles the delay
+	refreshManager.executeRefresh(ctx, job)
+
+	refreshManager.refreshMutex.RLock()
+	assert.Equal(t, 2, job.Attempts)
+	assert.WithinDuration(t, time.Now().Add(18*time.Second), job.NextRefresh, 3*time.Second)
+	refreshManager.refreshMutex.RUnlock()
+
+	require.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "Warning TokenRefreshFailed Failed to refresh GitHub token in secret test-secret (TokenGenerationFailed)")
+
+	assert.Equal(t, retriesBefore+2, testutil.ToFloat64(refreshRetriesTotal.WithLabelValues("TokenGenerationFailed")))
+	assert.Equal(t, failuresBefore+2, testutil.ToFloat64(refreshFailuresTotal.WithLabelValues("TokenGenerationFailed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(refreshJobsRetrying))
+	assert.Equal(t, float64(1), testutil.ToFloat64(refreshJobsScheduled))
+
+	// Periodic checks and reconciles keep the backoff of retrying jobs
+	nextRefresh := job.NextRefresh
+	require.NoError(t, refreshManager.CheckAndRefreshExpiredTokens(ctx))
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+	refreshManager.refreshMutex.RLock()
+	assert.Same(t, job, refreshManager.refreshJobs["test-namespace/test-secret"])
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, nextRefresh, job.NextRefresh)
+	refreshManager.refreshMutex.RUnlock()
+	assert.Equal(t, 2, refreshManager.retryLimiter.NumRequeues("test-namespace/test-secret"))
+
+	// A new token in the secret starts over without backoff
+	secret.Annotations[kubernetes.AnnotationTokenExpiry] = time.Now().Add(time.Hour).Format(time.RFC3339)
+	require.NoError(t, fakeClient.Update(ctx, secret))
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+	refreshManager.refreshMutex.RLock()
+	assert.Equal(t, 0, refreshManager.refreshJobs["test-namespace/test-secret"].Attempts)
+	refreshManager.refreshMutex.RUnlock()
+	assert.Equal(t, 0, refreshManager.retryLimiter.NumRequeues("test-namespace/test-secret"))
+}
+
+func TestRefreshManager_executeRefresh_DefersWhenRateLimited(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	expiresAt := time.Now().Add(30 * time.Minute)
+	gitRepo := newTestGitRepository()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   expiresAt.Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+			},
+		},
+	}
+
+	resetAt := time.Now().Add(10 * time.Minute)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repo").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.MatchedBy(func(ctx context.Context) bool {
+		// The refresh may wait while the token in the secret stays valid
+		deadline, ok := ghclient.DeferrableUntil(ctx)
+		return ok && deadline.Equal(expiresAt.Truncate(time.Second).Add(-time.Minute))
+	}), "https://github.com/testorg/test-repo", mock.Anything).
+		Return((*github.InstallationToken)(nil), &ghclient.RateLimitedError{Organization: "testorg", Until: resetAt})
+
+	recorder := record.NewFakeRecorder(10)
+	refreshManager := NewRefreshManager(
+		fakeClient,
+		mockGitHubClient,
+		kubernetes.NewSecretManager(fakeClient),
+		recorder,
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+		logr.Discard(),
+	)
+	defer refreshManager.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+
+	refreshManager.refreshMutex.RLock()
+	job := refreshManager.refreshJobs["test-namespace/test-secret"]
+	refreshManager.refreshMutex.RUnlock()
+
+	deferredBefore := testutil.ToFloat64(refreshDeferredTotal)
+
+	refreshManager.executeRefresh(ctx, job)
+
+	// The refresh moves to the reset of the rate limit without counting as a failure
+	refreshManager.refreshMutex.RLock()
+	assert.Equal(t, 0, job.Attempts)
+	assert.Equal(t, resetAt, job.NextRefresh)
+	refreshManager.refreshMutex.RUnlock()
+
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, deferredBefore+1, testutil.ToFloat64(refreshDeferredTotal))
+	mockGitHubClient.AssertExpectations(t)
+}
+
+func TestRefreshManager_executeRefresh_GivesUpAfterExpiry(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(-time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	mockGitHubClient.On("ValidateRepositoryURL", "https://github.com/testorg/test-repo").Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, "https://github.com/testorg/test-repo", mock.Anything).
+		Return((*github.InstallationToken)(nil), assert.AnError)
+
+	refreshManager := NewRefreshManager(
+		fakeClient,
+		mockGitHubClient,
+		kubernetes.NewSecretManager(fakeClient),
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+		logr.Discard(),
+	)
+	defer refreshManager.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+
+	refreshManager.refreshMutex.RLock()
+	job := refreshManager.refreshJobs["test-namespace/test-secret"]
+	refreshManager.refreshMutex.RUnlock()
+
+	abandonedBefore := testutil.ToFloat64(refreshAbandonedTotal)
+
+	refreshManager.executeRefresh(ctx, job)
+
+	refreshManager.refreshMutex.RLock()
+	assert.True(t, job.Abandoned)
+	refreshManager.refreshMutex.RUnlock()
+	assert.Equal(t, abandonedBefore+1, testutil.ToFloat64(refreshAbandonedTotal))
+
+	// Periodic checks and reconciles don't resume the refresh while the secret holds the expired token
+	require.NoError(t, refreshManager.CheckAndRefreshExpiredTokens(ctx))
+	require.NoError(t, refreshManager.ScheduleRefresh(ctx, "test-namespace", "test-secret", "https://github.com/testorg/test-repo"))
+	refreshManager.refreshMutex.RLock()
+	assert.Same(t, job, refreshManager.refreshJobs["test-namespace/test-secret"])
+	refreshManager.refreshMutex.RUnlock()
+	mockGitHubClient.AssertNumberOfCalls(t, "GenerateInstallationToken", 1)
+}
+
+func TestRefreshManager_processNextItem(t *testing.T) {
+	s := scheme.Scheme
+	require.NoError(t, sourcev1.AddToScheme(s))
+
+	gitRepo := newTestGitRepository()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-secret",
+			Namespace:       "test-namespace",
+			OwnerReferences: []metav1.OwnerReference{controllerReference(gitRepo)},
+			Annotations: map[string]string{
+				kubernetes.AnnotationManagedBy:     "flux-extension-controller",
+				kubernetes.AnnotationTokenExpiry:   time.Now().Add(5 * time.Minute).Format(time.RFC3339),
+				kubernetes.AnnotationRepositoryURL: "https://github.com/testorg/test-repo",
+			},
+		},
+		Data: map[string][]byte{
+			"username": []byte("git"),
+			"password": []byte("old-token"),
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithObjects(gitRepo, secret).Build()
+	mockGitHubClient := &MockGitHubClient{}
+	refreshManager := NewRefreshManager(
+		fakeClient,
+		mockGitHubClient,
+		kubernetes.NewSecretManager(fakeClient),
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+		logr.Discard(),
+	)
+	defer refreshManager.Stop()
+
+	repoURL := "https://github.com/testorg/test-repo"
+	mockGitHubClient.On("ValidateRepositoryURL", repoURL).Return(nil)
+	mockGitHubClient.On("GenerateInstallationToken", mock.Anything, repoURL, mock.Anything).Return(&github.InstallationToken{
+		Token:     github.String("new-refreshed-token"),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(1 * time.Hour)},
+	}, nil).Once()
+
+	jobKey := "test-namespace/test-secret"
+	refreshManager.refreshMutex.Lock()
+	refreshManager.refreshJobs[jobKey] = &RefreshJob{
+		SecretNamespace: "test-namespace",
+		SecretName:      "test-secret",
+		RepositoryURL:   repoURL,
+		NextRefresh:     time.Now().Add(-1 * time.Second),
+	}
+	refreshManager.refreshMutex.Unlock()
+
+	// Queueing the same secret twice results in a single refresh
+	refreshManager.queue.Add(jobKey)
+	refreshManager.queue.Add(jobKey)
+	assert.Equal(t, 1, refreshManager.queue.Len())
+
+	ctx := context.Background()
+	require.True(t, refreshManager.processNextItem(ctx))
+
+	updatedSecret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), updatedSecret))
+	assert.Equal(t, []byte("new-refreshed-token"), updatedSecret.Data["password"])
+	mockGitHubClient.AssertExpectations(t)
+
+	// The successful refresh scheduled the next one for later
+	refreshManager.refreshMutex.RLock()
+	job := refreshManager.refreshJobs[jobKey]
+	refreshManager.refreshMutex.RUnlock()
+	require.NotNil(t, job)
+	assert.True(t, job.NextRefresh.After(time.Now().Add(50*time.Minute)))
+	assert.Equal(t, 0, refreshManager.queue.Len())
+}
+
+func TestRefreshManager_processNextItem_SkipsCancelledJob(t *testing.T) {
+	mockGitHubClient := &MockGitHubClient{}
+	refreshManager := NewRefreshManager(
+		nil,
+		mockGitHubClient,
+		nil,
+		&record.FakeRecorder{},
+		config.TokenRefreshConfig{RefreshInterval: 30 * time.Minute},
+		logr.Discard(),
+	)
+	defer refreshManager.Stop()
+
+	refreshManager.queue.Add("test-namespace/test-secret")
+	require.True(t, refreshManager.processNextItem(context.Background()))
+
+	// No refresh was attempted for a secret without a job
+	mockGitHubClient.AssertNotCalled(t, "ValidateRepositoryURL", mock.Anything)
+	assert.Equal(t, 0, refreshManager.queue.Len())
+}
+
+func TestOwnerTokenOptions(t *testing.T) {
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{kubernetes.AnnotationPermissions: "contents:read"},
+		},
+	}
+	opts, err := ownerTokenOptions(gitRepo)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"contents": "read"}, opts.Permissions)
+	assert.True(t, opts.Requested)
+
+	// ImageUpdateAutomations push, so their tokens default to contents:write
+	automation := ownerKinds[kubernetes.ImageUpdateAutomationKind]("image.toolkit.fluxcd.io/v1")
+	opts, err = ownerTokenOptions(automation)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"contents": "write"}, opts.Permissions)
+	assert.False(t, opts.Requested)
+}